@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/cmd/app"
+	"github.com/shodikhuja83/crud/pkg/bulk"
+	"github.com/shodikhuja83/crud/pkg/managers"
+	"go.uber.org/zap"
+	"golang.org/x/term"
+)
+
+var errUsage = errors.New("usage")
+
+const adminUsage = `usage: app admin <command> [--dsn DSN] [flags]
+
+commands:
+  create-admin      --name NAME --phone PHONE        create an admin, the password is prompted
+  reset-password    --phone PHONE                    set the password of a manager, revokes the tokens
+  tokens            [--manager-id ID] [--customer-id ID]
+                                                     list tokens, only their prefixes are shown
+  revoke-tokens     --manager-id ID | --customer-id ID | --prefix PREFIX
+                                                     revoke tokens
+  purge-tokens                                       delete the expired tokens
+  block-customer    --id ID                          block a customer and revoke the tokens
+  unblock-customer  --id ID                          unblock a customer
+  export-sales      [--from DATE] [--to DATE] [--manager-id ID] [--customer-id ID] [--product-id ID]
+                    [--format csv|jsonl|xlsx] [--out FILE]
+                                                     export the positions of the sales, --to is exclusive,
+                                                     dates are 2006-01-02 or RFC 3339, stdout by default
+
+The database is the one of --dsn, of DATABASE_URL or the local one of the server.
+The password is read from the terminal, or from the first line of stdin when it is not a terminal.
+`
+
+var adminCommands = map[string]bool{
+	"create-admin":     true,
+	"reset-password":   true,
+	"tokens":           true,
+	"revoke-tokens":    true,
+	"purge-tokens":     true,
+	"block-customer":   true,
+	"unblock-customer": true,
+	"export-sales":     true,
+}
+
+// admin runs an operational command against the database of dsn, unless --dsn sets another
+func admin(dsn string, args []string, stdin *os.File, stdout io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stdout, adminUsage)
+		return errUsage
+	}
+	command, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("admin "+command, flag.ContinueOnError)
+	flags.StringVar(&dsn, "dsn", dsn, "database of the command")
+	name := flags.String("name", "", "name of the admin")
+	phone := flags.String("phone", "", "phone of the manager")
+	id := flags.Int64("id", 0, "id of the customer")
+	managerID := flags.Int64("manager-id", 0, "id of the manager")
+	customerID := flags.Int64("customer-id", 0, "id of the customer")
+	productID := flags.Int64("product-id", 0, "id of the product")
+	prefix := flags.String("prefix", "", fmt.Sprintf("first %d or more characters of the token", managers.TokenPrefixLength))
+	from := flags.String("from", "", "first day of the export")
+	to := flags.String("to", "", "day after the export")
+	format := flags.String("format", bulk.FormatCSV, "format of the export")
+	out := flags.String("out", "", "file of the export")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	filter := &managers.SalesFilter{ManagerID: *managerID, CustomerID: *customerID, ProductID: *productID}
+	var err error
+	if filter.From, err = app.ParseTime(*from); err != nil {
+		return fmt.Errorf("%w: --from: %v", errUsage, err)
+	}
+	if filter.To, err = app.ParseTime(*to); err != nil {
+		return fmt.Errorf("%w: --to: %v", errUsage, err)
+	}
+
+	// check the flags before connecting to the database
+	switch {
+	case command == "create-admin" && (*name == "" || *phone == ""):
+		return fmt.Errorf("%w: --name and --phone are required", errUsage)
+	case command == "reset-password" && *phone == "":
+		return fmt.Errorf("%w: --phone is required", errUsage)
+	case (command == "block-customer" || command == "unblock-customer") && *id == 0:
+		return fmt.Errorf("%w: --id is required", errUsage)
+	case !adminCommands[command]:
+		fmt.Fprint(stdout, adminUsage)
+		return errUsage
+	}
+
+	timeout := time.Minute
+	if command == "export-sales" {
+		timeout = time.Hour
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	pool, err := pgxpool.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	svc := managers.NewService(pool, zap.NewNop())
+
+	switch command {
+	case "create-admin":
+		password, err := readPassword(stdin, stdout)
+		if err != nil {
+			return err
+		}
+		item, err := svc.CreateAdmin(ctx, *name, *phone, password)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "created admin %d %s %s\n", item.ID, item.Name, item.Phone)
+
+	case "reset-password":
+		password, err := readPassword(stdin, stdout)
+		if err != nil {
+			return err
+		}
+		if err = svc.ResetPassword(ctx, *phone, password); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "password of %s is reset, the tokens are revoked\n", *phone)
+
+	case "tokens":
+		items, err := svc.Tokens(ctx, &managers.TokenFilter{ManagerID: *managerID, CustomerID: *customerID})
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tOWNER\tPREFIX\tCREATED\tEXPIRE")
+		for _, item := range items {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", item.Kind, item.OwnerID, item.Prefix,
+				item.Created.Format(time.RFC3339), item.Expire.Format(time.RFC3339))
+		}
+		return w.Flush()
+
+	case "revoke-tokens":
+		count, err := svc.RevokeTokens(ctx, &managers.TokenFilter{ManagerID: *managerID, CustomerID: *customerID, Prefix: *prefix})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "revoked %d tokens\n", count)
+
+	case "purge-tokens":
+		count, err := svc.PurgeExpiredTokens(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "purged %d expired tokens\n", count)
+
+	case "block-customer", "unblock-customer":
+		item, err := svc.SetCustomerActive(ctx, *id, command == "unblock-customer")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "customer %d %s active: %t\n", item.ID, item.Phone, item.Active)
+
+	case "export-sales":
+		return exportSales(ctx, svc, filter, *format, *out, stdout)
+	}
+	return nil
+}
+
+// exportSales writes the export to the file, which is removed when the export fails
+func exportSales(ctx context.Context, svc *managers.Service, filter *managers.SalesFilter, format string, out string, stdout io.Writer) (err error) {
+	w := stdout
+	if out != "" {
+		// err stays the named result, the deferred func sees the failure of the export
+		file, createErr := os.Create(out)
+		if createErr != nil {
+			return createErr
+		}
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(out)
+			}
+		}()
+		w = file
+	}
+
+	writer, err := bulk.NewWriter(format, w, managers.SaleLineColumns, managers.TextColumns...)
+	if err != nil {
+		return err
+	}
+	if err = svc.ExportSales(ctx, filter, writer.Write); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// readPassword prompts for the password twice on a terminal, reads a line otherwise
+func readPassword(stdin *os.File, stdout io.Writer) (string, error) {
+	fd := int(stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(stdout, "password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(stdout)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(stdout, "repeat password: ")
+	repeated, err := term.ReadPassword(fd)
+	fmt.Fprintln(stdout)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(repeated) {
+		return "", errors.New("passwords don't match")
+	}
+	return string(password), nil
+}
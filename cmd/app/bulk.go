@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/bulk"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/managers"
+	"go.uber.org/zap"
+)
+
+// maxImportSize bounds the body of an import
+const maxImportSize = 32 << 20
+
+type importFunc func(ctx context.Context, reader bulk.Reader, dryRun bool) (*managers.ImportResult, error)
+
+type exportFunc func(ctx context.Context, write func(values []string) error) error
+
+func (s *Server) handleManagerImportProducts(w http.ResponseWriter, r *http.Request) {
+	s.importFile(w, r, s.managerSvc.ImportProducts)
+}
+
+func (s *Server) handleManagerExportProducts(w http.ResponseWriter, r *http.Request) {
+	s.exportFile(w, r, "products", managers.ProductColumns, s.managerSvc.ExportProducts)
+}
+
+func (s *Server) handleManagerImportCustomers(w http.ResponseWriter, r *http.Request) {
+	s.importFile(w, r, s.managerSvc.ImportCustomers)
+}
+
+func (s *Server) handleManagerExportCustomers(w http.ResponseWriter, r *http.Request) {
+	s.exportFile(w, r, "customers", managers.CustomerColumns, s.managerSvc.ExportCustomers)
+}
+
+func (s *Server) handleManagerExportSales(w http.ResponseWriter, r *http.Request) {
+	filter, err := salesFilter(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.exportFile(w, r, "sales", managers.SaleLineColumns, func(ctx context.Context, write func(values []string) error) error {
+		return s.managerSvc.ExportSales(ctx, filter, write)
+	})
+}
+
+// importFile reads the body in the format from the query, the result lists the rejected rows
+func (s *Server) importFile(w http.ResponseWriter, r *http.Request, run importFunc) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+		dryRun = parsed
+	}
+	reader, err := bulk.NewReader(bulkFormat(r), http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := run(r.Context(), reader, dryRun)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, result)
+}
+
+// exportFile streams the rows as an attachment, an error after the first bytes can only be logged
+func (s *Server) exportFile(w http.ResponseWriter, r *http.Request, name string, columns []string, run exportFunc) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	format := bulkFormat(r)
+	counter := &countingWriter{writer: w}
+	writer, err := bulk.NewWriter(format, counter, columns, managers.TextColumns...)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", bulk.ContentType(format))
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("20060102"), format))
+
+	err = run(r.Context(), writer.Write)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		if counter.written == 0 {
+			s.errWriter(w, r, managerErrStatus(err), err)
+			return
+		}
+		logging.Ctx(r.Context(), s.logger).Warn("export interrupted", zap.Int64("written", counter.written), zap.Error(err))
+	}
+}
+
+func bulkFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	return bulk.FormatCSV
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.written += int64(n)
+	return n, err
+}
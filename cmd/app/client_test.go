@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/client"
+	"github.com/shodikhuja83/crud/pkg/customers"
+	"github.com/shodikhuja83/crud/pkg/errcode"
+	"github.com/shodikhuja83/crud/pkg/health"
+	"github.com/shodikhuja83/crud/pkg/managers"
+	"github.com/shodikhuja83/crud/pkg/metrics"
+	"github.com/shodikhuja83/crud/pkg/receipts"
+	"github.com/shodikhuja83/crud/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+func TestErrWriterCode(t *testing.T) {
+	s := newTestServer(t)
+	for _, test := range []struct {
+		status int
+		err    error
+		code   string
+	}{
+		{http.StatusNotFound, managers.ErrNotFound, "managers.not_found"},
+		{http.StatusNotFound, customers.ErrNotFound, "customers.not_found"},
+		{http.StatusBadRequest, errNoID, ""},
+		{http.StatusInternalServerError, managers.ErrInternal, errcode.Internal},
+		{http.StatusInternalServerError, errors.New("connection refused"), errcode.Internal},
+	} {
+		recorder := httptest.NewRecorder()
+		s.errWriter(recorder, httptest.NewRequest(http.MethodGet, "/", nil), test.status, test.err)
+
+		body := &errorResponse{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Status != test.status || body.Code != test.code {
+			t.Errorf("%v: status %d, code %q", test.err, body.Status, body.Code)
+		}
+		if test.status >= http.StatusInternalServerError && body.Error != http.StatusText(test.status) {
+			t.Errorf("%v: exposed %q", test.err, body.Error)
+		}
+	}
+}
+
+// newDatabaseClient serves the api with services on TEST_DATABASE_URL, a database with the schema applied,
+// the test is skipped without it
+func newDatabaseClient(t *testing.T) *client.Client {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	logger := zap.NewNop()
+	s := NewServer(mux.NewRouter(), customers.NewService(pool, logger), managers.NewService(pool, logger),
+		receipts.NewService(pool, logger), logger, metrics.New(nil), health.NewService(pool, logger), webhooks.NewService(pool, logger))
+	if err = s.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return client.New(server.URL, client.WithHTTPClient(server.Client()))
+}
+
+func TestClientCustomerErrors(t *testing.T) {
+	c := newDatabaseClient(t)
+	ctx := context.Background()
+
+	phone := fmt.Sprintf("+992%09d", time.Now().UnixNano()%1000000000)
+	registration := &customers.Registration{Name: "Test", Phone: phone, Password: "secret"}
+	if _, err := c.RegisterCustomer(ctx, registration); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.RegisterCustomer(ctx, registration); !errors.Is(err, customers.ErrPhoneUsed) {
+		t.Errorf("register twice: %v", err)
+	}
+	if _, err := c.LoginCustomer(ctx, phone, "wrong"); !errors.Is(err, customers.ErrInvalidPassword) {
+		t.Errorf("login with a wrong password: %v", err)
+	}
+	if _, err := c.LoginCustomer(ctx, phone, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.SetCartItem(ctx, &customers.CartItem{ProductID: -1, Qty: 1})
+	if !errors.Is(err, customers.ErrNotFound) || errors.Is(err, managers.ErrNotFound) {
+		t.Errorf("set a missing product: %v", err)
+	}
+	if _, err = c.Checkout(ctx, ""); !errors.Is(err, customers.ErrCartEmpty) {
+		t.Errorf("checkout an empty cart: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/shodikhuja83/crud/cmd/app/middleware"
+	"github.com/shodikhuja83/crud/pkg/managers"
+)
+
+// managerCustomerID returns the manager of the request and the customer of the path,
+// writing the error and returning false if they are missing
+func (s *Server) managerCustomerID(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return 0, 0, false
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return 0, 0, false
+	}
+
+	customerID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return 0, 0, false
+	}
+	return id, customerID, true
+}
+
+func (s *Server) handleManagerGetCustomerNotes(w http.ResponseWriter, r *http.Request) {
+	_, customerID, ok := s.managerCustomerID(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := s.managerSvc.CustomerNotes(r.Context(), customerID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerAddCustomerNote(w http.ResponseWriter, r *http.Request) {
+	id, customerID, ok := s.managerCustomerID(w, r)
+	if !ok {
+		return
+	}
+
+	note := &managers.CustomerNote{}
+	if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.AddCustomerNote(r.Context(), id, customerID, note.Text)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerSetCustomerTags(w http.ResponseWriter, r *http.Request) {
+	_, customerID, ok := s.managerCustomerID(w, r)
+	if !ok {
+		return
+	}
+
+	tags := &managers.CustomerTags{}
+	if err := json.NewDecoder(r.Body).Decode(&tags); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.SetCustomerTags(r.Context(), customerID, tags.Tags)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetCustomerTimeline(w http.ResponseWriter, r *http.Request) {
+	_, customerID, ok := s.managerCustomerID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	created, err := ParseTime(query.Get("before"))
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	var before *managers.TimelineCursor
+	if created != nil {
+		before = &managers.TimelineCursor{Created: *created, Kind: query.Get("before_kind")}
+		if value := query.Get("before_id"); value != "" {
+			if before.ID, err = strconv.ParseInt(value, 10, 64); err != nil {
+				s.errWriter(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	items, err := s.managerSvc.CustomerTimeline(r.Context(), customerID, before)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerGetTags(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	items, err := s.managerSvc.Tags(r.Context())
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
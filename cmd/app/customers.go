@@ -2,13 +2,12 @@ package app
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	// "strings"
 
 	"github.com/shodikhuja83/crud/cmd/app/middleware"
 	"github.com/shodikhuja83/crud/pkg/customers"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/shodikhuja83/crud/pkg/money"
 
 )
 
@@ -18,25 +17,17 @@ func (s *Server) handleCustomerRegistration(w http.ResponseWriter, r *http.Reque
 	var item *customers.Registration
 
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(item.Password), bcrypt.DefaultCost)
-
-	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	item.Password = string(hashed)
-
+	// the service hashes the password
 	saved, err := s.customersSvc.Register(r.Context(), item)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, customerErrStatus(err), err)
 		return
 	}
-	resJson(w, saved)
+	s.resJson(w, r, saved)
 
 }
 func (s *Server) handleCustomerGetToken(w http.ResponseWriter, r *http.Request) {
@@ -44,48 +35,174 @@ func (s *Server) handleCustomerGetToken(w http.ResponseWriter, r *http.Request)
 
 
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	token, err := s.customersSvc.Token(r.Context(), item.Login, item.Password)
-	
+	s.metrics.ObserveLogin("customer", err)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, customerErrStatus(err), err)
 		return
 	}
 
 
-	resJson(w, map[string]interface{}{"status": "ok", "token": token})
+	s.resJson(w, r, map[string]interface{}{"status": "ok", "token": token})
 
 }
 
 func (s *Server) handleCustomerGetProducts(w http.ResponseWriter, r *http.Request) {
 	items, err := s.customersSvc.Products(r.Context())
 	if err != nil {
-		log.Print(err)
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
-	resJson(w, items)
+	s.resJson(w, r, items)
 }
 
 
 func (s *Server) handleCustomerGetPurchases(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	items, err := s.customersSvc.Purchases(r.Context(), id)
 
 	if err != nil {
-		log.Print(err)
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.resJson(w, r, items)
+
+}
+
+// reads the id of the authenticated customer, writes an error when there is none
+func (s *Server) customerID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		s.errWriter(w, r, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, middleware.ErrNoAuthentication)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) handleCustomerGetCart(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.customerID(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := s.customersSvc.Cart(r.Context(), id)
+	if err != nil {
+		s.errWriter(w, r, customerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleCustomerSetCartItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.customerID(w, r)
+	if !ok {
+		return
+	}
+
+	item := &customers.CartItem{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.customersSvc.SetCartItem(r.Context(), id, item); err != nil {
+		s.errWriter(w, r, customerErrStatus(err), err)
+		return
+	}
+
+	s.handleCustomerGetCart(w, r)
+}
+
+func (s *Server) handleCustomerRemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.customerID(w, r)
+	if !ok {
+		return
+	}
+
+	productID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = s.customersSvc.RemoveCartItem(r.Context(), id, productID); err != nil {
+		s.errWriter(w, r, customerErrStatus(err), err)
+		return
+	}
+
+	s.handleCustomerGetCart(w, r)
+}
+
+func (s *Server) handleCustomerCheckout(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.customerID(w, r)
+	if !ok {
+		return
+	}
+
+	// the body is optional, it carries the promo code
+	request := &struct {
+		PromoCode string `json:"promo_code"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	order, err := s.customersSvc.Checkout(r.Context(), id, request.PromoCode)
+	if err != nil {
+		s.errWriter(w, r, customerErrStatus(err), err)
 		return
 	}
 
-	resJson(w, items)
+	s.resJson(w, r, order)
+}
 
+func (s *Server) handleCustomerGetOrders(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.customerID(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := s.customersSvc.Orders(r.Context(), id)
+	if err != nil {
+		s.errWriter(w, r, customerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+// maps errors of customers.Service to http statuses
+func customerErrStatus(err error) int {
+	switch err {
+	case customers.ErrNotFound:
+		return http.StatusNotFound
+	case customers.ErrInvalidQty, customers.ErrNotEnoughStock, customers.ErrCartEmpty, customers.ErrInvalidPromoCode,
+		money.ErrCurrencyMismatch:
+		return http.StatusBadRequest
+	case money.ErrOverflow:
+		return http.StatusUnprocessableEntity
+	case customers.ErrNoSuchUser, customers.ErrInvalidPassword:
+		return http.StatusUnauthorized
+	case customers.ErrPhoneUsed:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
 }
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shodikhuja83/crud/pkg/health"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// liveness: the process serves http, the database is not checked so a database outage doesn't restart it
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.resJson(w, r, map[string]interface{}{"status": "ok"})
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	check, err := s.healthSvc.Ready(r.Context())
+	if err == nil {
+		s.resJson(w, r, check)
+		return
+	}
+
+	logging.Ctx(r.Context(), s.logger).Warn("not ready", zap.Error(err))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err = json.NewEncoder(w).Encode(check); err != nil {
+		logging.Ctx(r.Context(), s.logger).Warn("write response", zap.Error(err))
+	}
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.resJson(w, r, health.BuildInfo())
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shodikhuja83/crud/cmd/app/middleware"
+	"github.com/shodikhuja83/crud/pkg/managers"
+)
+
+func (s *Server) handleCustomerGetLoyalty(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.customerID(w, r)
+	if !ok {
+		return
+	}
+
+	item, err := s.customersSvc.Loyalty(r.Context(), id)
+	if err != nil {
+		s.errWriter(w, r, customerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetLoyaltyRules(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.managerSvc.LoyaltyRules(r.Context())
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerSaveLoyaltyRule(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &managers.LoyaltyRule{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.SaveLoyaltyRule(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetCustomerLoyalty(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	customerID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.Loyalty(r.Context(), customerID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerAdjustPoints(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	customerID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	adjustment := &managers.PointsAdjustment{}
+	if err = json.NewDecoder(r.Body).Decode(&adjustment); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	entry, err := s.managerSvc.AdjustPoints(r.Context(), id, customerID, adjustment.Points, adjustment.Reason)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, entry)
+}
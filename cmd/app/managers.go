@@ -7,6 +7,7 @@ import (
 
 	"github.com/shodikhuja83/crud/cmd/app/middleware"
 	"github.com/shodikhuja83/crud/pkg/managers"
+	"github.com/shodikhuja83/crud/pkg/money"
 	"github.com/gorilla/mux"
 
 )
@@ -17,12 +18,12 @@ func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Reques
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
@@ -35,13 +36,13 @@ func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Reques
 
 	err = json.NewDecoder(r.Body).Decode(&registrationItem)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	Admin := s.managerSvc.IsAdmin(r.Context(),id)
 	if Admin != true {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -60,69 +61,70 @@ func (s *Server) handleManagerRegistration(w http.ResponseWriter, r *http.Reques
 
 	token, err := s.managerSvc.Create(r.Context(), item)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
-	resJson(w, map[string]interface{}{"token": token})
+	s.resJson(w, r, map[string]interface{}{"token": token})
 }
 
 func (s *Server) handleManagerGetToken(w http.ResponseWriter, r *http.Request) {
 	var manager *managers.Manager
 	err := json.NewDecoder(r.Body).Decode(&manager)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	token, err := s.managerSvc.Token(r.Context(), manager.Phone, manager.Password)
+	s.metrics.ObserveLogin("manager", err)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 
-	resJson(w, map[string]interface{}{"token": token})
+	s.resJson(w, r, map[string]interface{}{"token": token})
 }
 
 func (s *Server) handleManagerChangeProducts(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	product := &managers.Product{}
 	err = json.NewDecoder(r.Body).Decode(&product)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	product, err = s.managerSvc.SaveProduct(r.Context(),product)
 	if err != nil {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, managerErrStatus(err), err)
 		return
 	}
 
-	resJson(w, product)
+	s.resJson(w, r, product)
 }
 
 func (s *Server) handleManagerMakeSales(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
@@ -130,79 +132,160 @@ func (s *Server) handleManagerMakeSales(w http.ResponseWriter, r *http.Request)
 	sale.ManagerID = id
 	err = json.NewDecoder(r.Body).Decode(&sale)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	sale, err = s.managerSvc.MakeSale(r.Context(), sale)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, managerErrStatus(err), err)
 		return
 	}
+	s.metrics.ObserveSale(sale.Gross)
 
-	resJson(w, sale)
+	s.resJson(w, r, sale)
 }
 
 func (s *Server) handleManagerGetSales(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
-	total, err := s.managerSvc.GetSales(r.Context(), id)
+	filter, err := salesFilter(r)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
-	resJson(w, map[string]interface{}{"manager_id": id, "total": total})
+
+	page, err := s.managerSvc.Sales(r.Context(), id, filter)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, map[string]interface{}{
+		"manager_id": id,
+		"totals":     page.Totals,
+		"items":      page.Items,
+		"count":      page.Count,
+		"limit":      page.Limit,
+		"offset":     page.Offset,
+	})
+}
+
+func (s *Server) handleManagerGetSale(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	sale, err := s.managerSvc.Sale(r.Context(), id, saleID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, sale)
+}
+
+// reads managers.SalesFilter from the query, dates are RFC 3339 or 2006-01-02
+func salesFilter(r *http.Request) (*managers.SalesFilter, error) {
+	query := r.URL.Query()
+	filter := &managers.SalesFilter{}
+
+	var err error
+	for name, value := range map[string]*int64{
+		"manager_id":  &filter.ManagerID,
+		"customer_id": &filter.CustomerID,
+		"product_id":  &filter.ProductID,
+	} {
+		if query.Get(name) == "" {
+			continue
+		}
+		if *value, err = strconv.ParseInt(query.Get(name), 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		if query.Get(name) == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(query.Get(name)); err != nil {
+			return nil, err
+		}
+	}
+	if filter.From, err = ParseTime(query.Get("from")); err != nil {
+		return nil, err
+	}
+	if filter.To, err = ParseTime(query.Get("to")); err != nil {
+		return nil, err
+	}
+	return filter, nil
 }
 
 func (s *Server) handleManagerGetProducts(w http.ResponseWriter, r *http.Request) {
 	items, err := s.managerSvc.Products(r.Context())
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 	
 
-	resJson(w, items)
+	s.resJson(w, r, items)
 }
 
 func (s *Server) handleManagerRemoveProductByID(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	idParam, ok := mux.Vars(r)["id"]
 	if !ok {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	productID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	err = s.managerSvc.RemoveProductByID(r.Context(), productID)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, managerErrStatus(err), err)
 		return
 	}
 }
@@ -211,30 +294,30 @@ func (s *Server) handleManagerRemoveCustomerByID(w http.ResponseWriter, r *http.
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	idParam, ok := mux.Vars(r)["id"]
 	if !ok {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	customerID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	err = s.managerSvc.RemoveCustomerByID(r.Context(), customerID)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
@@ -244,49 +327,422 @@ func (s *Server) handleManagerGetCustomers(w http.ResponseWriter, r *http.Reques
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	filter := &managers.CustomerFilter{Segment: r.URL.Query().Get("segment"), Tags: r.URL.Query()["tag"]}
+	for name, value := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if r.URL.Query().Get(name) == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(r.URL.Query().Get(name)); err != nil {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	items, err := s.managerSvc.Customers(r.Context(), filter)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerGetCustomerSummary(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	customerID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	items, err := s.managerSvc.Customers(r.Context())
+	summary, err := s.managerSvc.CustomerSummary(r.Context(), customerID)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, managerErrStatus(err), err)
 		return
 	}
 
-	resJson(w, items)
+	s.resJson(w, r, summary)
 }
 
 func (s *Server) handleManagerChangeCustomer(w http.ResponseWriter, r *http.Request) {
 	id, err := middleware.Authentication(r.Context())
 
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+	change := &managers.CustomerChange{}
+	err = json.NewDecoder(r.Body).Decode(&change)
+	if err != nil {
+		s.errWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	customer, err := s.managerSvc.ChangeCustomer(r.Context(), change)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, customer)
+
+}
+
+func (s *Server) handleManagerGetMovements(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if id == 0 {
-		errWriter(w, http.StatusForbidden, err)
+		s.errWriter(w, r, http.StatusForbidden, err)
 		return
 	}
-	customer := &managers.Customer{}
-	err = json.NewDecoder(r.Body).Decode(&customer)
+
+	productID, err := paramID(r)
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	customer, err = s.managerSvc.ChangeCustomer(r.Context(), customer)
+	var limit, offset int
+	for name, value := range map[string]*int{"limit": &limit, "offset": &offset} {
+		if r.URL.Query().Get(name) == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(r.URL.Query().Get(name)); err != nil {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	items, err := s.managerSvc.Movements(r.Context(), productID, limit, offset)
 	if err != nil {
-		errWriter(w, http.StatusBadRequest, err)
+		s.errWriter(w, r, managerErrStatus(err), err)
 		return
 	}
 
-	resJson(w, customer)
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerGetAlerts(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	pending := false
+	if value := r.URL.Query().Get("pending"); value != "" {
+		pending, err = strconv.ParseBool(value)
+		if err != nil {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
 
-}
\ No newline at end of file
+	items, err := s.managerSvc.Alerts(r.Context(), pending)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerGetDashboard(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	dashboard, err := s.managerSvc.Dashboard(r.Context())
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, dashboard)
+}
+
+func (s *Server) handleManagerAddReceipt(w http.ResponseWriter, r *http.Request) {
+	s.addMovement(w, r, managers.MovementReceipt)
+}
+
+func (s *Server) handleManagerAddAdjustment(w http.ResponseWriter, r *http.Request) {
+	s.addMovement(w, r, managers.MovementAdjustment)
+}
+
+// posts a stock movement for the product from the path, adjustments may be sent as write-offs
+func (s *Server) addMovement(w http.ResponseWriter, r *http.Request, kind string) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	productID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	movement := &managers.Movement{}
+	err = json.NewDecoder(r.Body).Decode(&movement)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if kind != managers.MovementAdjustment || movement.Kind != managers.MovementWriteOff {
+		movement.Kind = kind
+	}
+	movement.ProductID = productID
+	movement.ManagerID = id
+	movement.SalePositionID = 0
+
+	movement, err = s.managerSvc.AddMovement(r.Context(), movement)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, movement)
+}
+
+// maps errors of managers.Service to http statuses
+func managerErrStatus(err error) int {
+	switch err {
+	case managers.ErrNotFound:
+		return http.StatusNotFound
+	case managers.ErrSKUUsed:
+		return http.StatusConflict
+	case managers.ErrNotEnoughStock, managers.ErrInvalidMovement, managers.ErrInvalidPosition,
+		managers.ErrReturnExceedsSale, managers.ErrOrderNotPending, managers.ErrInvalidDiscount,
+		managers.ErrInvalidPromoCode, managers.ErrInvalidPrice, managers.ErrInvalidTaxRate, managers.ErrInvalidThreshold,
+		managers.ErrInvalidCategory, managers.ErrInvalidSegment, managers.ErrInvalidLoyaltyRule, managers.ErrNotEnoughPoints,
+		managers.ErrInvalidRedemption, managers.ErrInvalidAdjustment, managers.ErrInvalidEmail, managers.ErrInvalidNote,
+		managers.ErrInvalidTag, money.ErrCurrencyMismatch, money.ErrInvalidCurrency:
+		return http.StatusBadRequest
+	case money.ErrOverflow:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) handleManagerMakeReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// a sale the manager can't see is not found for them
+	_, err = s.managerSvc.Sale(r.Context(), id, saleID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	item := &managers.Return{}
+	err = json.NewDecoder(r.Body).Decode(&item)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	item.SaleID = saleID
+	item.ManagerID = id
+
+	item, err = s.managerSvc.MakeReturn(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetReturns(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = s.managerSvc.Sale(r.Context(), id, saleID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	items, err := s.managerSvc.Returns(r.Context(), saleID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerGetOrders(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	filter := &managers.OrderFilter{Status: managers.OrderPending}
+	if values, ok := r.URL.Query()["status"]; ok {
+		filter.Status = values[0]
+	}
+	for name, value := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if r.URL.Query().Get(name) == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(r.URL.Query().Get(name)); err != nil {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	items, err := s.managerSvc.Orders(r.Context(), filter)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerConfirmOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	orderID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	sale, err := s.managerSvc.ConfirmOrder(r.Context(), id, orderID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+	s.metrics.ObserveSale(sale.Gross)
+
+	s.resJson(w, r, sale)
+}
+
+func (s *Server) handleManagerRejectOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	orderID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var item struct {
+		Comment string `json:"comment"`
+	}
+	if r.ContentLength != 0 {
+		if err = json.NewDecoder(r.Body).Decode(&item); err != nil {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	err = s.managerSvc.RejectOrder(r.Context(), id, orderID, item.Comment)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, map[string]interface{}{"id": orderID, "status": managers.OrderRejected})
+}
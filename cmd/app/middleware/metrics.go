@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ObserveFunc records a served request, route is the template of the matched route
+type ObserveFunc func(route string, method string, status int, duration time.Duration)
+
+// Metrics observes every request labeled by the route template, not by the path, to keep the labels bounded
+func Metrics(observe ObserveFunc) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+
+			handler.ServeHTTP(recorder, request)
+
+			route := "unknown"
+			if current := mux.CurrentRoute(request); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			observe(route, request.Method, recorder.status, time.Since(start))
+		})
+	}
+}
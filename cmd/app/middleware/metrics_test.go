@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetricsFlush(t *testing.T) {
+	var status int
+	handler := Metrics(func(route string, method string, code int, duration time.Duration) {
+		status = code
+	})(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			t.Fatal("writer is not a flusher")
+		}
+		writer.WriteHeader(http.StatusAccepted)
+		flusher.Flush()
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !recorder.Flushed {
+		t.Error("the wrapped writer is not flushed")
+	}
+	if status != http.StatusAccepted {
+		t.Errorf("observed status %d, want %d", status, http.StatusAccepted)
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the id of the request to and from the client
+const RequestIDHeader = "X-Request-ID"
+
+// maximal length of a request id accepted from the client
+const maxRequestIDLength = 64
+
+// RequestID puts the id of the request into the context and the response headers.
+// The id from the client is kept when it is sane, otherwise a new one is generated.
+func RequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		writer.Header().Set(RequestIDHeader, id)
+		request = request.WithContext(logging.WithRequestID(request.Context(), id))
+
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// AccessLog logs every request with its status and duration, the Authorization header is never logged
+func AccessLog(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+
+			handler.ServeHTTP(recorder, request)
+
+			logging.Ctx(request.Context(), logger).Info("request",
+				zap.String("method", request.Method),
+				zap.String("path", request.URL.Path),
+				zap.Int("status", recorder.status),
+				zap.Duration("duration", time.Since(start)),
+				zap.String("remote", request.RemoteAddr),
+			)
+		})
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers flush through the recorder when the wrapped writer can
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout cancels the context of a request after timeout, so a request waiting for a connection
+// of an exhausted pool fails instead of blocking, requests for which untimed is true are not limited, e.g. exports
+func Timeout(timeout time.Duration, untimed func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if untimed != nil && untimed(request) {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(request.Context(), timeout)
+			defer cancel()
+			handler.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	var deadline bool
+	handler := Timeout(time.Minute, func(r *http.Request) bool {
+		return strings.HasSuffix(r.URL.Path, "/export")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, deadline = r.Context().Deadline()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/managers/sales", nil))
+	if !deadline {
+		t.Error("request has no deadline")
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/managers/sales/export", nil))
+	if deadline {
+		t.Error("export has a deadline")
+	}
+}
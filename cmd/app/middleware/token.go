@@ -3,9 +3,10 @@ package middleware
 import (
 	"context"
 	"errors"
-	"log"
 	"net/http"
 
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
 )
 
 const (
@@ -35,7 +36,7 @@ func Authenticate(idFunc IDFunc) func(http.Handler) http.Handler {
 
 			id, err := idFunc(request.Context(), token)
 			if err != nil {
-				log.Print(err, "Not Authorization")
+				logging.Ctx(request.Context(), nil).Error("authenticate", zap.Error(err), logging.Secret("token"))
 				http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
@@ -0,0 +1,291 @@
+package app
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/shodikhuja83/crud/pkg/customers"
+	"github.com/shodikhuja83/crud/pkg/health"
+	"github.com/shodikhuja83/crud/pkg/managers"
+	"github.com/shodikhuja83/crud/pkg/openapi"
+	"github.com/shodikhuja83/crud/pkg/receipts"
+	"github.com/shodikhuja83/crud/pkg/webhooks"
+	"github.com/shodikhuja83/crud/pkg/xlsx"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+func query(name string, typ string, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+var receiptQuery = []*openapi.Parameter{
+	query("format", "string", "json (default), text or pdf"),
+	query("width", "integer", "characters per line of text and pdf, 32 to 80, default 42"),
+}
+
+var bulkTypes = []string{"text/csv", "application/x-ndjson"}
+
+var exportTypes = []string{"text/csv", "application/x-ndjson", xlsx.ContentType}
+
+var bulkImportQuery = []*openapi.Parameter{
+	query("format", "string", "csv with a header row (default) or jsonl"),
+	query("dry_run", "boolean", "check every row and roll back"),
+}
+
+var bulkExportQuery = []*openapi.Parameter{query("format", "string", "csv (default), jsonl or xlsx")}
+
+// apiRoutes documents every route registered in Init, TestAPIRoutes fails when they differ
+func apiRoutes() []openapi.Route {
+	return []openapi.Route{
+		{Method: GET, Path: "/healthz", Tag: "service", Summary: "Liveness", Response: statusResponse{}},
+		{Method: GET, Path: "/readyz", Tag: "service", Summary: "Readiness, 503 while the database is unavailable or the server shuts down",
+			Response: health.Check{}},
+		{Method: GET, Path: "/version", Tag: "service", Summary: "Build info", Response: health.Build{}},
+		{Method: GET, Path: "/api/openapi.json", Tag: "service", Summary: "This document", Response: map[string]interface{}{}},
+		{Method: GET, Path: "/api/docs", Tag: "service", Summary: "Docs of the api", Produces: []string{"text/html"}},
+
+		{Method: POST, Path: "/api/customers", Tag: "customers", Summary: "Register a customer",
+			Request: customers.Registration{}, Response: customers.Customer{}},
+		{Method: POST, Path: "/api/customers/token", Tag: "customers", Summary: "Log in",
+			Request: customers.Auth{}, Response: struct {
+				Status string `json:"status"`
+				Token  string `json:"token"`
+			}{}},
+		{Method: GET, Path: "/api/customers/products", Tag: "customers", Summary: "Products on sale",
+			Response: []*customers.Product{}},
+		{Method: GET, Path: "/api/customers/purchases", Tag: "customers", Summary: "Purchased positions", Auth: true,
+			Response: []*customers.Sales{}},
+		{Method: GET, Path: "/api/customers/purchases/{id}/receipt", Tag: "customers", Summary: "Receipt of a purchase", Auth: true,
+			Query: receiptQuery, Response: receipts.Receipt{}, Produces: []string{openapi.Text, openapi.PDF}},
+		{Method: GET, Path: "/api/customers/cart", Tag: "customers", Summary: "Cart", Auth: true,
+			Response: []*customers.CartItem{}},
+		{Method: POST, Path: "/api/customers/cart", Tag: "customers", Summary: "Put a product into the cart, qty 0 removes it", Auth: true,
+			Request: customers.CartItem{}, Response: []*customers.CartItem{}},
+		{Method: DELETE, Path: "/api/customers/cart/{id}", Tag: "customers", Summary: "Remove a product from the cart", Auth: true},
+		{Method: GET, Path: "/api/customers/orders", Tag: "customers", Summary: "Orders", Auth: true,
+			Response: []*customers.Order{}},
+		{Method: POST, Path: "/api/customers/orders", Tag: "customers",
+			Summary: "Order the cart at the prices after the discounts and the promo code, the body is optional", Auth: true,
+			Request: struct {
+				PromoCode string `json:"promo_code"`
+			}{}, Response: customers.Order{}},
+		{Method: GET, Path: "/api/customers/loyalty", Tag: "customers", Summary: "Loyalty points with the newest entries", Auth: true,
+			Response: customers.Loyalty{}},
+
+		{Method: POST, Path: "/api/managers", Tag: "managers", Summary: "Register a manager, admins only", Auth: true,
+			Request: struct {
+				ID    int64    `json:"id"`
+				Name  string   `json:"name"`
+				Phone string   `json:"phone"`
+				Roles []string `json:"roles"`
+			}{}, Response: tokenResponse{}},
+		{Method: POST, Path: "/api/managers/token", Tag: "managers", Summary: "Log in",
+			Request: struct {
+				Phone    string `json:"phone"`
+				Password string `json:"password"`
+			}{}, Response: tokenResponse{}},
+		{Method: GET, Path: "/api/managers/sales", Tag: "sales", Summary: "Page of visible sales with the totals of the ones matching the filter, less the returns", Auth: true,
+			Query: []*openapi.Parameter{
+				query("manager_id", "integer", ""),
+				query("customer_id", "integer", ""),
+				query("product_id", "integer", "sales with a position of the product"),
+				query("from", "string", "RFC 3339 or 2006-01-02, inclusive"),
+				query("to", "string", "RFC 3339 or 2006-01-02, exclusive"),
+				query("limit", "integer", "default 50, at most 500"),
+				query("offset", "integer", ""),
+			},
+			Response: struct {
+				ManagerID int64                  `json:"manager_id"`
+				Totals    []*managers.SalesTotal `json:"totals"`
+				Items     []*managers.Sale       `json:"items"`
+				Count     int64                  `json:"count"`
+				Limit     int                    `json:"limit"`
+				Offset    int                    `json:"offset"`
+			}{}},
+		{Method: POST, Path: "/api/managers/sales", Tag: "sales", Summary: "Make a sale, prices are taken from the price lists", Auth: true,
+			Request: managers.Sale{}, Response: managers.Sale{}},
+		{Method: GET, Path: "/api/managers/sales/export", Tag: "sales",
+			Summary: "Positions of the sales for accounting as a file, read in one snapshot, admins only", Auth: true,
+			Query: []*openapi.Parameter{
+				query("format", "string", "csv (default), jsonl or xlsx"),
+				query("manager_id", "integer", ""),
+				query("customer_id", "integer", ""),
+				query("product_id", "integer", "only the positions of the product"),
+				query("from", "string", "RFC 3339 or 2006-01-02, inclusive"),
+				query("to", "string", "RFC 3339 or 2006-01-02, exclusive"),
+			},
+			Produces: exportTypes},
+		{Method: GET, Path: "/api/managers/sales/{id}", Tag: "sales", Summary: "Sale with its positions", Auth: true,
+			Response: managers.Sale{}},
+		{Method: GET, Path: "/api/managers/sales/{id}/receipt", Tag: "sales", Summary: "Receipt of a sale", Auth: true,
+			Query: receiptQuery, Response: receipts.Receipt{}, Produces: []string{openapi.Text, openapi.PDF}},
+		{Method: GET, Path: "/api/managers/sales/{id}/returns", Tag: "sales", Summary: "Returns of a sale", Auth: true,
+			Response: []*managers.Return{}},
+		{Method: POST, Path: "/api/managers/sales/{id}/returns", Tag: "sales", Summary: "Return positions of a sale", Auth: true,
+			Request: managers.Return{}, Response: managers.Return{}},
+
+		{Method: GET, Path: "/api/managers/products", Tag: "products", Summary: "Products", Auth: true,
+			Response: []*managers.Product{}},
+		{Method: POST, Path: "/api/managers/products", Tag: "products", Summary: "Create or change a product", Auth: true,
+			Request: managers.Product{}, Response: managers.Product{}},
+		{Method: POST, Path: "/api/managers/products/import", Tag: "products",
+			Summary: "Upsert products by sku from a file of the columns of the export, admins only", Auth: true,
+			Query: bulkImportQuery, Consumes: bulkTypes, Response: managers.ImportResult{}},
+		{Method: GET, Path: "/api/managers/products/export", Tag: "products", Summary: "All products as a file, admins only", Auth: true,
+			Query: bulkExportQuery, Produces: exportTypes},
+		{Method: DELETE, Path: "/api/managers/products/{id}", Tag: "products",
+			Summary: "Remove a product from the lists, its sales and stock movements are kept", Auth: true},
+		{Method: GET, Path: "/api/managers/products/{id}/movements", Tag: "products", Summary: "Page of the stock movements of a product, newest first", Auth: true,
+			Query: []*openapi.Parameter{
+				query("limit", "integer", "default 100, at most 500"),
+				query("offset", "integer", ""),
+			},
+			Response: []*managers.Movement{}},
+		{Method: POST, Path: "/api/managers/products/{id}/receipts", Tag: "products", Summary: "Receive stock", Auth: true,
+			Request: managers.Movement{}, Response: managers.Movement{}},
+		{Method: POST, Path: "/api/managers/products/{id}/adjustments", Tag: "products", Summary: "Adjust or write off stock", Auth: true,
+			Request: managers.Movement{}, Response: managers.Movement{}},
+		{Method: GET, Path: "/api/managers/alerts", Tag: "products", Summary: "Low-stock alerts, newest first", Auth: true,
+			Query:    []*openapi.Parameter{query("pending", "boolean", "only the undelivered alerts, oldest first")},
+			Response: []*managers.Alert{}},
+		{Method: GET, Path: "/api/managers/dashboard", Tag: "reports",
+			Summary: "Revenue, top products and customers, new customers and stock value, admins only", Auth: true,
+			Response: managers.Dashboard{}},
+
+		{Method: GET, Path: "/api/managers/orders", Tag: "orders", Summary: "Orders of customers", Auth: true,
+			Query: []*openapi.Parameter{
+				query("status", "string", "pending (default), confirmed or rejected"),
+				query("limit", "integer", "orders with all of their positions, 100 by default, at most 500"),
+				query("offset", "integer", ""),
+			},
+			Response: []*managers.Order{}},
+		{Method: POST, Path: "/api/managers/orders/{id}/confirm", Tag: "orders", Summary: "Confirm an order into a sale", Auth: true,
+			Response: managers.Sale{}},
+		{Method: POST, Path: "/api/managers/orders/{id}/reject", Tag: "orders", Summary: "Reject an order", Auth: true,
+			Request: struct {
+				Comment string `json:"comment"`
+			}{}, Response: struct {
+				ID     int64  `json:"id"`
+				Status string `json:"status"`
+			}{}},
+
+		{Method: GET, Path: "/api/managers/customer-groups", Tag: "pricing", Summary: "Customer groups", Auth: true,
+			Response: []*managers.CustomerGroup{}},
+		{Method: POST, Path: "/api/managers/customer-groups", Tag: "pricing", Summary: "Create or change a customer group, admins only", Auth: true,
+			Request: managers.CustomerGroup{}, Response: managers.CustomerGroup{}},
+		{Method: GET, Path: "/api/managers/customer-groups/{id}/prices", Tag: "pricing", Summary: "Price list of a group", Auth: true,
+			Response: []*managers.PriceListItem{}},
+		{Method: POST, Path: "/api/managers/customer-groups/{id}/prices", Tag: "pricing", Summary: "Set a price of a group, admins only", Auth: true,
+			Request: managers.PriceListItem{}, Response: managers.PriceListItem{}},
+		{Method: GET, Path: "/api/managers/discounts", Tag: "pricing", Summary: "Discounts", Auth: true,
+			Response: []*managers.Discount{}},
+		{Method: POST, Path: "/api/managers/discounts", Tag: "pricing", Summary: "Create or change a discount, admins only", Auth: true,
+			Request: managers.Discount{}, Response: managers.Discount{}},
+		{Method: GET, Path: "/api/managers/promo-codes", Tag: "pricing", Summary: "Promo codes", Auth: true,
+			Response: []*managers.PromoCode{}},
+		{Method: POST, Path: "/api/managers/promo-codes", Tag: "pricing", Summary: "Create or change a promo code, admins only", Auth: true,
+			Request: managers.PromoCode{}, Response: managers.PromoCode{}},
+		{Method: GET, Path: "/api/managers/tax-categories", Tag: "pricing", Summary: "Tax categories", Auth: true,
+			Response: []*managers.TaxCategory{}},
+		{Method: POST, Path: "/api/managers/tax-categories", Tag: "pricing", Summary: "Create or change a tax category, admins only", Auth: true,
+			Request: managers.TaxCategory{}, Response: managers.TaxCategory{}},
+		{Method: GET, Path: "/api/managers/loyalty-rules", Tag: "pricing", Summary: "Loyalty rules, admins only", Auth: true,
+			Response: []*managers.LoyaltyRule{}},
+		{Method: POST, Path: "/api/managers/loyalty-rules", Tag: "pricing", Summary: "Create or change a loyalty rule, admins only", Auth: true,
+			Request: managers.LoyaltyRule{}, Response: managers.LoyaltyRule{}},
+
+		{Method: GET, Path: "/api/managers/customers", Tag: "customers of managers", Summary: "Active customers with their segments and tags", Auth: true,
+			Query: []*openapi.Parameter{
+				query("segment", "string", "new, loyal, regular, at_risk or lost"),
+				query("tag", "string", "repeat for several, customers with every one of them"),
+				query("limit", "integer", "100 by default, at most 500"),
+				query("offset", "integer", ""),
+			},
+			Response: []*managers.Customer{}},
+		{Method: POST, Path: "/api/managers/customers", Tag: "customers of managers",
+			Summary: "Change a customer, the fields left out keep their values", Auth: true,
+			Request: managers.CustomerChange{}, Response: managers.Customer{}},
+		{Method: POST, Path: "/api/managers/customers/import", Tag: "customers of managers",
+			Summary: "Upsert customers by phone from a file of the columns of the export, admins only", Auth: true,
+			Query: bulkImportQuery, Consumes: bulkTypes, Response: managers.ImportResult{}},
+		{Method: GET, Path: "/api/managers/customers/export", Tag: "customers of managers", Summary: "All customers as a file, admins only", Auth: true,
+			Query: bulkExportQuery, Produces: exportTypes},
+		{Method: DELETE, Path: "/api/managers/customers/{id}", Tag: "customers of managers", Summary: "Remove a customer", Auth: true},
+		{Method: GET, Path: "/api/managers/customers/{id}/summary", Tag: "customers of managers",
+			Summary: "Recency, frequency and monetary analysis of a customer", Auth: true, Response: managers.CustomerSummary{}},
+		{Method: GET, Path: "/api/managers/customers/{id}/loyalty", Tag: "customers of managers",
+			Summary: "Loyalty points of a customer with the newest entries", Auth: true, Response: managers.Loyalty{}},
+		{Method: POST, Path: "/api/managers/customers/{id}/loyalty", Tag: "customers of managers",
+			Summary: "Add or take off points manually, with a reason", Auth: true,
+			Request: managers.PointsAdjustment{}, Response: managers.LoyaltyEntry{}},
+		{Method: GET, Path: "/api/managers/customers/{id}/notes", Tag: "customers of managers",
+			Summary: "Notes of the managers about a customer, newest first", Auth: true, Response: []*managers.CustomerNote{}},
+		{Method: POST, Path: "/api/managers/customers/{id}/notes", Tag: "customers of managers",
+			Summary: "Add a note about a customer, only the text is read", Auth: true,
+			Request: managers.CustomerNote{}, Response: managers.CustomerNote{}},
+		{Method: POST, Path: "/api/managers/customers/{id}/tags", Tag: "customers of managers",
+			Summary: "Replace the tags of a customer, they are lowercased", Auth: true,
+			Request: managers.CustomerTags{}, Response: managers.CustomerTags{}},
+		{Method: GET, Path: "/api/managers/customers/{id}/timeline", Tag: "customers of managers",
+			Summary: "Notes and sales of a customer, newest first", Auth: true,
+			Query: []*openapi.Parameter{
+				query("before", "string", "RFC 3339 time or date, the page before it, the created of the last entry"),
+				query("before_kind", "string", "kind of the last entry"),
+				query("before_id", "integer", "id of the last entry"),
+			},
+			Response: []*managers.TimelineEntry{}},
+		{Method: GET, Path: "/api/managers/customer-tags", Tag: "customers of managers",
+			Summary: "Tags in use with the number of their customers", Auth: true, Response: []*managers.TagCount{}},
+
+		{Method: GET, Path: "/api/managers/webhooks", Tag: "webhooks", Summary: "Webhook subscriptions, admins only", Auth: true,
+			Response: []*webhooks.Subscription{}},
+		{Method: POST, Path: "/api/managers/webhooks", Tag: "webhooks",
+			Summary: "Create a subscription (its secret is returned only now) or change one, admins only", Auth: true,
+			Request: webhooks.Subscription{}, Response: webhooks.Subscription{}},
+		{Method: DELETE, Path: "/api/managers/webhooks/{id}", Tag: "webhooks", Summary: "Remove a subscription, admins only", Auth: true},
+		{Method: GET, Path: "/api/managers/webhooks/deliveries", Tag: "webhooks", Summary: "Deliveries, newest first, admins only", Auth: true,
+			Query:    []*openapi.Parameter{query("status", "string", "pending, delivered or dead (the dead letters), all by default")},
+			Response: []*webhooks.Delivery{}},
+		{Method: POST, Path: "/api/managers/webhooks/deliveries/{id}/retry", Tag: "webhooks",
+			Summary: "Send a dead delivery again, admins only", Auth: true, Response: webhooks.Delivery{}},
+	}
+}
+
+// apiDocument builds the document of the api, openapi_test.go checks it against the registered routes
+func apiDocument() *openapi.Document {
+	builder := openapi.NewBuilder("crud", health.BuildInfo().Version, errorResponse{})
+	for _, route := range apiRoutes() {
+		builder.Add(route)
+	}
+	return builder.Document()
+}
+
+// apiSpec is the document of the api served at runtime
+func (s *Server) apiSpec() ([]byte, error) {
+	return json.Marshal(apiDocument())
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(s.spec); err != nil {
+		s.errWriter(w, r, http.StatusInternalServerError, err)
+	}
+}
+
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(docsPage); err != nil {
+		s.errWriter(w, r, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shodikhuja83/crud/pkg/metrics"
+	"github.com/shodikhuja83/crud/pkg/openapi"
+	"go.uber.org/zap"
+)
+
+// newTestServer registers the routes without services, enough for the requests that don't reach them
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := NewServer(mux.NewRouter(), nil, nil, nil, zap.NewNop(), metrics.New(nil), nil, nil)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAPIRoutes(t *testing.T) {
+	s := newTestServer(t)
+	if err := openapi.Verify(apiDocument(), s.mux); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeAPISpec(t *testing.T) {
+	s := newTestServer(t)
+	recorder := httptest.NewRecorder()
+	s.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d", recorder.Code)
+	}
+
+	doc := &openapi.Document{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Paths) == 0 {
+		t.Error("spec has no paths")
+	}
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shodikhuja83/crud/cmd/app/middleware"
+	"github.com/shodikhuja83/crud/pkg/managers"
+)
+
+// reads the id of the authenticated manager and checks that he is an admin, writes an error otherwise
+func (s *Server) adminID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := middleware.Authentication(r.Context())
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	if id == 0 || !s.managerSvc.IsAdmin(r.Context(), id) {
+		s.errWriter(w, r, http.StatusForbidden, middleware.ErrNoAuthentication)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) handleManagerGetCustomerGroups(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.managerSvc.CustomerGroups(r.Context())
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerSaveCustomerGroup(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &managers.CustomerGroup{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.SaveCustomerGroup(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetPriceList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	groupID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	items, err := s.managerSvc.PriceList(r.Context(), groupID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerSetPrice(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	groupID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item := &managers.PriceListItem{}
+	if err = json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+	item.GroupID = groupID
+
+	item, err = s.managerSvc.SetPrice(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetDiscounts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.managerSvc.Discounts(r.Context())
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerSaveDiscount(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &managers.Discount{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.SaveDiscount(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetPromoCodes(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.managerSvc.PromoCodes(r.Context())
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerSavePromoCode(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &managers.PromoCode{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.SavePromoCode(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerGetTaxCategories(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.managerSvc.TaxCategories(r.Context())
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerSaveTaxCategory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &managers.TaxCategory{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.managerSvc.SaveTaxCategory(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
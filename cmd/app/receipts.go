@@ -0,0 +1,118 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/shodikhuja83/crud/cmd/app/middleware"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/receipts"
+	"go.uber.org/zap"
+)
+
+func (s *Server) handleManagerGetReceipt(w http.ResponseWriter, r *http.Request) {
+	id, err := middleware.Authentication(r.Context())
+
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if id == 0 {
+		s.errWriter(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	saleID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = s.managerSvc.Sale(r.Context(), id, saleID)
+	if err != nil {
+		s.errWriter(w, r, managerErrStatus(err), err)
+		return
+	}
+
+	receipt, err := s.receiptsSvc.ByID(r.Context(), saleID)
+	if err != nil {
+		s.errWriter(w, r, receiptErrStatus(err), err)
+		return
+	}
+
+	s.writeReceipt(w, r, receipt)
+}
+
+func (s *Server) handleCustomerGetReceipt(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.customerID(w, r)
+	if !ok {
+		return
+	}
+
+	saleID, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	receipt, err := s.receiptsSvc.ByID(r.Context(), saleID)
+	if err == nil && receipt.CustomerID != id {
+		err = receipts.ErrNotFound
+	}
+	if err != nil {
+		s.errWriter(w, r, receiptErrStatus(err), err)
+		return
+	}
+
+	s.writeReceipt(w, r, receipt)
+}
+
+// writes the receipt in the format from the query: json (default), text or pdf
+func (s *Server) writeReceipt(w http.ResponseWriter, r *http.Request, receipt *receipts.Receipt) {
+	width := receipts.WideWidth
+	if value := r.URL.Query().Get("width"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < receipts.NarrowWidth || parsed > 80 {
+			s.errWriter(w, r, http.StatusBadRequest, err)
+			return
+		}
+		width = parsed
+	}
+
+	buf := &bytes.Buffer{}
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		s.resJson(w, r, receipt)
+		return
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = receipts.WriteText(buf, receipt, width)
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", "inline; filename=receipt-"+strconv.FormatInt(receipt.SaleID, 10)+".pdf")
+		err = receipts.WritePDF(buf, receipt, width)
+	default:
+		s.errWriter(w, r, http.StatusBadRequest, nil)
+		return
+	}
+	if err != nil {
+		s.errWriter(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		logging.Ctx(r.Context(), s.logger).Warn("write receipt", zap.Error(err))
+	}
+}
+
+// maps errors of receipts.Service to http statuses
+func receiptErrStatus(err error) int {
+	if err == receipts.ErrNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -2,13 +2,25 @@ package app
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/shodikhuja83/crud/cmd/app/middleware"
 	"github.com/shodikhuja83/crud/pkg/customers"
+	"github.com/shodikhuja83/crud/pkg/errcode"
+	"github.com/shodikhuja83/crud/pkg/health"
+	"github.com/shodikhuja83/crud/pkg/logging"
 	"github.com/shodikhuja83/crud/pkg/managers"
+	"github.com/shodikhuja83/crud/pkg/metrics"
+	"github.com/shodikhuja83/crud/pkg/receipts"
+	"github.com/shodikhuja83/crud/pkg/tracing"
+	"github.com/shodikhuja83/crud/pkg/webhooks"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.uber.org/zap"
 
 )
 
@@ -17,14 +29,25 @@ type Server struct {
 	mux          *mux.Router
 	customersSvc *customers.Service
 	managerSvc   *managers.Service
+	receiptsSvc  *receipts.Service
+	logger       *zap.Logger
+	metrics      *metrics.Metrics
+	healthSvc    *health.Service
+	webhooksSvc  *webhooks.Service
+	spec         []byte
 }
 
 //NewServer: Create new Server
-func NewServer(mux *mux.Router, customersSvc *customers.Service, mSvc *managers.Service) *Server {
+func NewServer(mux *mux.Router, customersSvc *customers.Service, mSvc *managers.Service, receiptsSvc *receipts.Service, logger *zap.Logger, metrics *metrics.Metrics, healthSvc *health.Service, webhooksSvc *webhooks.Service) *Server {
 	return &Server{
 		mux:          mux,
 		customersSvc: customersSvc,
 		managerSvc:   mSvc,
+		receiptsSvc:  receiptsSvc,
+		logger:       logger,
+		metrics:      metrics,
+		healthSvc:    healthSvc,
+		webhooksSvc:  webhooksSvc,
 	}
 }
 
@@ -33,14 +56,25 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
 }
 
+// RequestTimeout limits the requests but the streams of files, see streaming
+const RequestTimeout = 30 * time.Second
+
 const (
 	GET    = "GET"
 	POST   = "POST"
 	DELETE = "DELETE"
 )
 
-//Init ... server initialization
-func (s *Server) Init() {
+//Init ... server initialization, fails when the api spec can't be encoded, TestAPIRoutes checks it against the routes
+func (s *Server) Init() error {
+	s.mux.Use(otelmux.Middleware(tracing.ServiceName), middleware.RequestID, middleware.AccessLog(s.logger), middleware.Metrics(s.metrics.ObserveRequest),
+		middleware.Timeout(RequestTimeout, streaming))
+
+	s.mux.HandleFunc("/healthz", s.handleHealthz).Methods(GET)
+	s.mux.HandleFunc("/readyz", s.handleReadyz).Methods(GET)
+	s.mux.HandleFunc("/version", s.handleVersion).Methods(GET)
+	s.mux.HandleFunc("/api/openapi.json", s.handleOpenAPI).Methods(GET)
+	s.mux.HandleFunc("/api/docs", s.handleDocs).Methods(GET)
 
 	customerAuthMd := middleware.Authenticate(s.customersSvc.IDByToken)
 	customersSubrouter := s.mux.PathPrefix("/api/customers").Subrouter()
@@ -50,6 +84,13 @@ func (s *Server) Init() {
 	customersSubrouter.HandleFunc("/token", s.handleCustomerGetToken).Methods(POST)
 	customersSubrouter.HandleFunc("/products", s.handleCustomerGetProducts).Methods(GET)
 	customersSubrouter.HandleFunc("/purchases", s.handleCustomerGetPurchases).Methods(GET)
+	customersSubrouter.HandleFunc("/purchases/{id}/receipt", s.handleCustomerGetReceipt).Methods(GET)
+	customersSubrouter.HandleFunc("/cart", s.handleCustomerGetCart).Methods(GET)
+	customersSubrouter.HandleFunc("/cart", s.handleCustomerSetCartItem).Methods(POST)
+	customersSubrouter.HandleFunc("/cart/{id}", s.handleCustomerRemoveCartItem).Methods(DELETE)
+	customersSubrouter.HandleFunc("/orders", s.handleCustomerGetOrders).Methods(GET)
+	customersSubrouter.HandleFunc("/orders", s.handleCustomerCheckout).Methods(POST)
+	customersSubrouter.HandleFunc("/loyalty", s.handleCustomerGetLoyalty).Methods(GET)
 
 	managersAuthenticateMd := middleware.Authenticate(s.managerSvc.IDByToken)
 	managersSubRouter := s.mux.PathPrefix("/api/managers").Subrouter()
@@ -59,22 +100,72 @@ func (s *Server) Init() {
 	managersSubRouter.HandleFunc("/token", s.handleManagerGetToken).Methods(POST)
 	managersSubRouter.HandleFunc("/sales", s.handleManagerGetSales).Methods(GET)
 	managersSubRouter.HandleFunc("/sales", s.handleManagerMakeSales).Methods(POST)
+	managersSubRouter.HandleFunc("/sales/export", s.handleManagerExportSales).Methods(GET)
+	managersSubRouter.HandleFunc("/sales/{id}", s.handleManagerGetSale).Methods(GET)
+	managersSubRouter.HandleFunc("/sales/{id}/receipt", s.handleManagerGetReceipt).Methods(GET)
+	managersSubRouter.HandleFunc("/sales/{id}/returns", s.handleManagerGetReturns).Methods(GET)
+	managersSubRouter.HandleFunc("/sales/{id}/returns", s.handleManagerMakeReturn).Methods(POST)
 	managersSubRouter.HandleFunc("/products", s.handleManagerGetProducts).Methods(GET)
 	managersSubRouter.HandleFunc("/products", s.handleManagerChangeProducts).Methods(POST)
+	managersSubRouter.HandleFunc("/products/import", s.handleManagerImportProducts).Methods(POST)
+	managersSubRouter.HandleFunc("/products/export", s.handleManagerExportProducts).Methods(GET)
 	managersSubRouter.HandleFunc("/products/{id}", s.handleManagerRemoveProductByID).Methods(DELETE)
+	managersSubRouter.HandleFunc("/products/{id}/movements", s.handleManagerGetMovements).Methods(GET)
+	managersSubRouter.HandleFunc("/products/{id}/receipts", s.handleManagerAddReceipt).Methods(POST)
+	managersSubRouter.HandleFunc("/products/{id}/adjustments", s.handleManagerAddAdjustment).Methods(POST)
+	managersSubRouter.HandleFunc("/alerts", s.handleManagerGetAlerts).Methods(GET)
+	managersSubRouter.HandleFunc("/dashboard", s.handleManagerGetDashboard).Methods(GET)
+	managersSubRouter.HandleFunc("/orders", s.handleManagerGetOrders).Methods(GET)
+	managersSubRouter.HandleFunc("/orders/{id}/confirm", s.handleManagerConfirmOrder).Methods(POST)
+	managersSubRouter.HandleFunc("/orders/{id}/reject", s.handleManagerRejectOrder).Methods(POST)
+	managersSubRouter.HandleFunc("/customer-groups", s.handleManagerGetCustomerGroups).Methods(GET)
+	managersSubRouter.HandleFunc("/customer-groups", s.handleManagerSaveCustomerGroup).Methods(POST)
+	managersSubRouter.HandleFunc("/customer-groups/{id}/prices", s.handleManagerGetPriceList).Methods(GET)
+	managersSubRouter.HandleFunc("/customer-groups/{id}/prices", s.handleManagerSetPrice).Methods(POST)
+	managersSubRouter.HandleFunc("/discounts", s.handleManagerGetDiscounts).Methods(GET)
+	managersSubRouter.HandleFunc("/discounts", s.handleManagerSaveDiscount).Methods(POST)
+	managersSubRouter.HandleFunc("/promo-codes", s.handleManagerGetPromoCodes).Methods(GET)
+	managersSubRouter.HandleFunc("/promo-codes", s.handleManagerSavePromoCode).Methods(POST)
+	managersSubRouter.HandleFunc("/tax-categories", s.handleManagerGetTaxCategories).Methods(GET)
+	managersSubRouter.HandleFunc("/tax-categories", s.handleManagerSaveTaxCategory).Methods(POST)
+	managersSubRouter.HandleFunc("/loyalty-rules", s.handleManagerGetLoyaltyRules).Methods(GET)
+	managersSubRouter.HandleFunc("/loyalty-rules", s.handleManagerSaveLoyaltyRule).Methods(POST)
 	managersSubRouter.HandleFunc("/customers", s.handleManagerGetCustomers).Methods(GET)
 	managersSubRouter.HandleFunc("/customers", s.handleManagerChangeCustomer).Methods(POST)
+	managersSubRouter.HandleFunc("/customers/import", s.handleManagerImportCustomers).Methods(POST)
+	managersSubRouter.HandleFunc("/customers/export", s.handleManagerExportCustomers).Methods(GET)
 	managersSubRouter.HandleFunc("/customers/{id}", s.handleManagerRemoveCustomerByID).Methods(DELETE)
+	managersSubRouter.HandleFunc("/customers/{id}/summary", s.handleManagerGetCustomerSummary).Methods(GET)
+	managersSubRouter.HandleFunc("/customers/{id}/loyalty", s.handleManagerGetCustomerLoyalty).Methods(GET)
+	managersSubRouter.HandleFunc("/customers/{id}/loyalty", s.handleManagerAdjustPoints).Methods(POST)
+	managersSubRouter.HandleFunc("/customers/{id}/notes", s.handleManagerGetCustomerNotes).Methods(GET)
+	managersSubRouter.HandleFunc("/customers/{id}/notes", s.handleManagerAddCustomerNote).Methods(POST)
+	managersSubRouter.HandleFunc("/customers/{id}/tags", s.handleManagerSetCustomerTags).Methods(POST)
+	managersSubRouter.HandleFunc("/customers/{id}/timeline", s.handleManagerGetCustomerTimeline).Methods(GET)
+	managersSubRouter.HandleFunc("/customer-tags", s.handleManagerGetTags).Methods(GET)
+	managersSubRouter.HandleFunc("/webhooks", s.handleManagerGetWebhooks).Methods(GET)
+	managersSubRouter.HandleFunc("/webhooks", s.handleManagerSaveWebhook).Methods(POST)
+	managersSubRouter.HandleFunc("/webhooks/{id}", s.handleManagerRemoveWebhook).Methods(DELETE)
+	managersSubRouter.HandleFunc("/webhooks/deliveries", s.handleManagerGetWebhookDeliveries).Methods(GET)
+	managersSubRouter.HandleFunc("/webhooks/deliveries/{id}/retry", s.handleManagerRetryWebhookDelivery).Methods(POST)
+
+	var err error
+	s.spec, err = s.apiSpec()
+	return err
+}
 
+// streaming reports the imports and exports, which take as long as their files
+func streaming(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, "/import") || strings.HasSuffix(r.URL.Path, "/export")
 }
 
 // function for the JSON response
-func resJson(w http.ResponseWriter, iData interface{}) {
+func (s *Server) resJson(w http.ResponseWriter, r *http.Request, iData interface{}) {
 
 	data, err := json.Marshal(iData)
 
 	if err != nil {
-		errWriter(w, http.StatusInternalServerError, err)
+		s.errWriter(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -82,12 +173,67 @@ func resJson(w http.ResponseWriter, iData interface{}) {
 
 	if err != nil {
 
-		log.Print(err)
+		logging.Ctx(r.Context(), s.logger).Warn("write response", zap.Error(err))
 	}
 }
 
-// function for writing an error in responseWriter
-func errWriter(w http.ResponseWriter, httpSts int, err error) {
-	log.Print(err)
-	http.Error(w, http.StatusText(httpSts), httpSts)
+// function for writing an error in responseWriter, client errors are logged as warnings
+func (s *Server) errWriter(w http.ResponseWriter, r *http.Request, httpSts int, err error) {
+	logger := logging.Ctx(r.Context(), s.logger).With(zap.Int("status", httpSts), zap.Error(err))
+	if httpSts >= http.StatusInternalServerError {
+		logger.Error("request failed")
+	} else {
+		logger.Warn("request rejected")
+	}
+
+	// the message of client errors is the sentinel error of the services, internal ones are not exposed,
+	// the code names the sentinel error for clients
+	body := &errorResponse{Status: httpSts, Error: http.StatusText(httpSts), Code: errcode.Internal}
+	if httpSts < http.StatusInternalServerError {
+		body.Code = errcode.Of(err)
+		if err != nil {
+			body.Error = err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(httpSts)
+	if err = json.NewEncoder(w).Encode(body); err != nil {
+		logger.Warn("write response", zap.Error(err))
+	}
+}
+
+// errorResponse is the body of every error
+type errorResponse struct {
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error"`
+}
+
+var errNoID = errors.New("no id in path")
+var errInvalidStatus = errors.New("invalid status")
+
+// function for reading the {id} path variable
+func paramID(r *http.Request) (int64, error) {
+	idParam, ok := mux.Vars(r)["id"]
+	if !ok {
+		return 0, errNoID
+	}
+	return strconv.ParseInt(idParam, 10, 64)
+}
+
+// ParseTime parses a time in RFC 3339 or a date, nil when value is empty,
+// the format of times in the query and of the admin commands
+func ParseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
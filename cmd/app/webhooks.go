@@ -0,0 +1,111 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shodikhuja83/crud/pkg/webhooks"
+)
+
+func webhookErrStatus(err error) int {
+	switch err {
+	case webhooks.ErrNotFound:
+		return http.StatusNotFound
+	case webhooks.ErrInvalidURL, webhooks.ErrInvalidEvent:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) handleManagerGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	items, err := s.webhooksSvc.Subscriptions(r.Context())
+	if err != nil {
+		s.errWriter(w, r, webhookErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerSaveWebhook(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	item := &webhooks.Subscription{}
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.webhooksSvc.SaveSubscription(r.Context(), item)
+	if err != nil {
+		s.errWriter(w, r, webhookErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
+
+func (s *Server) handleManagerRemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	id, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = s.webhooksSvc.RemoveSubscription(r.Context(), id); err != nil {
+		s.errWriter(w, r, webhookErrStatus(err), err)
+		return
+	}
+}
+
+func (s *Server) handleManagerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", webhooks.DeliveryPending, webhooks.DeliveryDelivered, webhooks.DeliveryDead:
+	default:
+		s.errWriter(w, r, http.StatusBadRequest, errInvalidStatus)
+		return
+	}
+
+	items, err := s.webhooksSvc.Deliveries(r.Context(), status)
+	if err != nil {
+		s.errWriter(w, r, webhookErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, items)
+}
+
+func (s *Server) handleManagerRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.adminID(w, r); !ok {
+		return
+	}
+
+	id, err := paramID(r)
+	if err != nil {
+		s.errWriter(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := s.webhooksSvc.RetryDelivery(r.Context(), id)
+	if err != nil {
+		s.errWriter(w, r, webhookErrStatus(err), err)
+		return
+	}
+
+	s.resJson(w, r, item)
+}
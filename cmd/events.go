@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+// newBus creates the event bus with the subscribers of the process
+func newBus(logger *zap.Logger, webhooksSvc *webhooks.Service) *events.Bus {
+	bus := events.NewBus(logger)
+	bus.SubscribeAll("audit", func(ctx context.Context, tx pgx.Tx, envelope *events.Envelope) error {
+		logging.Ctx(ctx, logger).Info("event", zap.Int64("event_id", envelope.ID), zap.String("event", envelope.Name),
+			zap.ByteString("payload", envelope.Payload))
+		return nil
+	})
+	bus.SubscribeAll("webhooks", webhooksSvc.Enqueue)
+	return bus
+}
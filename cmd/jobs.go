@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/managers"
+	"github.com/shodikhuja83/crud/pkg/metrics"
+	"github.com/shodikhuja83/crud/pkg/notify"
+	"github.com/shodikhuja83/crud/pkg/scheduler"
+	"github.com/shodikhuja83/crud/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+// newScheduler creates the scheduler with the maintenance jobs
+func newScheduler(pool *pgxpool.Pool, logger *zap.Logger, m *metrics.Metrics, managersSvc *managers.Service,
+	notifier notify.Notifier, webhooksSvc *webhooks.Service) (*scheduler.Scheduler, error) {
+	s := scheduler.New(pool, logger, m.ObserveJob)
+	jobs := []struct {
+		name string
+		spec string
+		run  scheduler.Job
+	}{
+		{"purge-expired-tokens", "*/15 * * * *", func(ctx context.Context) error {
+			count, err := managersSvc.PurgeExpiredTokens(ctx)
+			if err != nil {
+				return err
+			}
+			logging.Ctx(ctx, logger).Info("purged expired tokens", zap.Int64("count", count))
+			return nil
+		}},
+		{"low-stock-alerts", "* * * * *", func(ctx context.Context) error {
+			return sendAlerts(ctx, managersSvc, notifier)
+		}},
+		{"refresh-report-aggregates", "*/10 * * * *", managersSvc.RefreshReports},
+		{"deliver-webhooks", "@every 5s", func(ctx context.Context) error {
+			_, err := webhooksSvc.Deliver(ctx)
+			return err
+		}},
+	}
+	for _, job := range jobs {
+		if err := s.Add(job.name, job.spec, job.run); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// sendAlerts delivers the pending stock alerts oldest first, a failed one is sent again on the next run
+func sendAlerts(ctx context.Context, managersSvc *managers.Service, notifier notify.Notifier) error {
+	alerts, err := managersSvc.Alerts(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		err = notifier.Notify(ctx, &notify.Message{
+			Event:   "stock.low",
+			Subject: "low stock: " + alert.ProductName,
+			Text: fmt.Sprintf("%s (#%d) has %d items available, the reorder threshold is %d",
+				alert.ProductName, alert.ProductID, alert.Available, alert.Threshold),
+			Data:    alert,
+			Created: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if err = managersSvc.MarkAlertNotified(ctx, alert.ID); err != nil && err != managers.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
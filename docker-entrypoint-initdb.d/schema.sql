@@ -65,4 +65,426 @@ create table if not exists sales_positions
     price integer not null check(price >= 0),
     qty     integer not null default 0 check(qty >=0),
     created     timestamp not null default current_timestamp 
-);
\ No newline at end of file
+);
+
+create table if not exists stock_movements
+(
+    id               bigserial primary key,
+    product_id       bigint not null references products,
+    kind             text not null check(kind in ('receipt', 'sale', 'return', 'adjustment', 'write_off')),
+    qty              integer not null check(qty <> 0),
+    manager_id       bigint references managers,
+    sale_position_id bigint references sales_positions,
+    comment          text not null default '',
+    created          timestamp not null default current_timestamp
+);
+
+create index if not exists stock_movements_product_idx on stock_movements (product_id, id);
+
+insert into stock_movements (product_id, kind, qty, comment)
+select p.id, 'adjustment', p.qty, 'opening balance'
+from products p
+where p.qty <> 0
+  and not exists (select 1 from stock_movements sm where sm.product_id = p.id);
+
+create table if not exists sales_returns
+(
+    id          bigserial primary key,
+    sale_id     bigint not null references sales,
+    manager_id  bigint not null references managers,
+    reason      text not null default '',
+    created     timestamp not null default current_timestamp
+);
+
+create table if not exists sales_returns_positions
+(
+    id               bigserial primary key,
+    return_id        bigint not null references sales_returns,
+    sale_position_id bigint not null references sales_positions,
+    qty              integer not null check(qty > 0),
+    price            integer not null check(price >= 0),
+    created          timestamp not null default current_timestamp
+);
+
+create index if not exists sales_returns_positions_sale_position_idx on sales_returns_positions (sale_position_id);
+
+alter table products add column if not exists reserved integer not null default 0 check(reserved >= 0);
+
+create table if not exists carts
+(
+    customer_id bigint not null references customers,
+    product_id  bigint not null references products,
+    qty         integer not null check(qty > 0),
+    created     timestamp not null default current_timestamp,
+    primary key (customer_id, product_id)
+);
+
+create table if not exists orders
+(
+    id          bigserial primary key,
+    customer_id bigint not null references customers,
+    status      text not null default 'pending' check(status in ('pending', 'confirmed', 'rejected')),
+    manager_id  bigint references managers,
+    sale_id     bigint references sales,
+    comment     text not null default '',
+    created     timestamp not null default current_timestamp,
+    updated     timestamp not null default current_timestamp
+);
+
+create table if not exists orders_positions
+(
+    id          bigserial primary key,
+    order_id    bigint not null references orders,
+    product_id  bigint not null references products,
+    qty         integer not null check(qty > 0),
+    price       integer not null check(price >= 0),
+    created     timestamp not null default current_timestamp
+);
+
+create table if not exists customer_groups
+(
+    id      bigserial primary key,
+    name    text not null unique,
+    created timestamp not null default current_timestamp
+);
+
+alter table customers add column if not exists group_id bigint references customer_groups;
+
+create table if not exists price_lists
+(
+    group_id   bigint not null references customer_groups,
+    product_id bigint not null references products,
+    price      integer not null check(price >= 0),
+    created    timestamp not null default current_timestamp,
+    primary key (group_id, product_id)
+);
+
+create table if not exists discounts
+(
+    id         bigserial primary key,
+    name       text not null,
+    kind       text not null check(kind in ('percent', 'fixed')),
+    value      integer not null check(value > 0),
+    group_id   bigint references customer_groups,
+    product_id bigint references products,
+    starts     timestamp,
+    ends       timestamp,
+    active     boolean not null default true,
+    created    timestamp not null default current_timestamp
+);
+
+create table if not exists promo_codes
+(
+    id          bigserial primary key,
+    code        text not null unique,
+    kind        text not null check(kind in ('percent', 'fixed')),
+    value       integer not null check(value > 0),
+    starts      timestamp,
+    ends        timestamp,
+    usage_limit integer not null default 0 check(usage_limit >= 0),
+    used        integer not null default 0,
+    active      boolean not null default true,
+    created     timestamp not null default current_timestamp
+);
+
+alter table sales add column if not exists promo_code_id bigint references promo_codes;
+alter table sales_positions add column if not exists base_price integer not null default 0 check(base_price >= 0);
+alter table sales_positions add column if not exists discount integer not null default 0 check(discount >= 0);
+
+alter table products alter column price type bigint;
+alter table products add column if not exists currency text not null default 'TJS' check(currency ~ '^[A-Z]{3}$');
+alter table sales_positions alter column price type bigint;
+alter table sales_positions alter column base_price type bigint;
+alter table sales_positions alter column discount type bigint;
+alter table sales_positions add column if not exists currency text not null default 'TJS' check(currency ~ '^[A-Z]{3}$');
+alter table sales_returns_positions alter column price type bigint;
+alter table sales_returns_positions add column if not exists currency text not null default 'TJS' check(currency ~ '^[A-Z]{3}$');
+alter table orders_positions alter column price type bigint;
+alter table orders_positions add column if not exists currency text not null default 'TJS' check(currency ~ '^[A-Z]{3}$');
+alter table price_lists alter column price type bigint;
+alter table discounts alter column value type bigint;
+alter table promo_codes alter column value type bigint;
+
+create table if not exists tax_categories
+(
+    id        bigserial primary key,
+    name      text not null unique,
+    rate      integer not null check(rate >= 0 and rate <= 100000),
+    inclusive boolean not null default true,
+    created   timestamp not null default current_timestamp
+);
+
+alter table products add column if not exists category_id bigint references tax_categories;
+alter table sales_positions add column if not exists tax_rate integer not null default 0;
+alter table sales_positions add column if not exists net bigint not null default 0;
+alter table sales_positions add column if not exists tax bigint not null default 0;
+alter table sales_positions add column if not exists gross bigint not null default 0;
+alter table sales_returns_positions add column if not exists net bigint not null default 0;
+alter table sales_returns_positions add column if not exists tax bigint not null default 0;
+alter table sales_returns_positions add column if not exists gross bigint not null default 0;
+
+update sales_positions set net = price * qty, gross = price * qty where gross = 0 and price > 0;
+update sales_returns_positions set net = price * qty, gross = price * qty where gross = 0 and price > 0;
+
+-- every change of the schema appends its version, the service is ready only on the version it expects
+create table if not exists schema_migrations
+(
+    version bigint primary key,
+    applied timestamp not null default current_timestamp
+);
+
+insert into schema_migrations (version) values (1) on conflict do nothing;
+
+-- last run of every scheduled job, whichever instance took its lock
+create table if not exists scheduled_jobs
+(
+    name          text primary key,
+    last_started  timestamp,
+    last_finished timestamp,
+    last_result   text not null default '',
+    last_error    text not null default '',
+    runs          bigint not null default 0,
+    failures      bigint not null default 0
+);
+
+-- sales and returns by day and currency, refreshed by the refresh-report-aggregates job
+create materialized view if not exists sales_daily as
+select day, currency, sum(sales)::bigint as sales, sum(items)::bigint as items,
+       sum(net)::bigint as net, sum(tax)::bigint as tax, sum(gross)::bigint as gross, sum(returned)::bigint as returned
+from (
+    select s.created::date as day, sp.currency, count(distinct s.id) as sales, sum(sp.qty) as items,
+           sum(sp.net) as net, sum(sp.tax) as tax, sum(sp.gross) as gross, 0 as returned
+    from sales s join sales_positions sp on sp.sale_id = s.id
+    group by 1, 2
+    union all
+    select r.created::date, rp.currency, 0, -sum(rp.qty), -sum(rp.net), -sum(rp.tax), -sum(rp.gross), sum(rp.gross)
+    from sales_returns r join sales_returns_positions rp on rp.return_id = r.id
+    group by 1, 2
+) t
+group by day, currency;
+
+create unique index if not exists sales_daily_day_currency_idx on sales_daily (day, currency);
+
+insert into schema_migrations (version) values (2) on conflict do nothing;
+
+-- an alert is raised when a movement takes the available stock (qty - reserved) to the reorder threshold
+alter table products add column if not exists reorder_threshold integer check(reorder_threshold >= 0);
+
+create table if not exists stock_alerts
+(
+    id          bigserial primary key,
+    product_id  bigint not null references products,
+    movement_id bigint references stock_movements,
+    threshold   integer not null,
+    available   integer not null,
+    notified    timestamp,
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists stock_alerts_pending_idx on stock_alerts (id) where notified is null;
+
+insert into schema_migrations (version) values (3) on conflict do nothing;
+
+-- events are written in the transaction of the change, the dispatcher fans them out to the webhook subscriptions
+create table if not exists outbox_events
+(
+    id         bigserial primary key,
+    event      text not null,
+    payload    jsonb not null,
+    dispatched timestamp,
+    created    timestamp not null default current_timestamp
+);
+
+create index if not exists outbox_events_pending_idx on outbox_events (id) where dispatched is null;
+
+create table if not exists webhook_subscriptions
+(
+    id      bigserial primary key,
+    url     text not null,
+    events  text[] not null,
+    secret  text not null,
+    active  boolean not null default true,
+    created timestamp not null default current_timestamp
+);
+
+create table if not exists webhook_deliveries
+(
+    id              bigserial primary key,
+    subscription_id bigint not null references webhook_subscriptions on delete cascade,
+    event_id        bigint not null references outbox_events,
+    status          text not null default 'pending' check(status in ('pending', 'delivered', 'dead')),
+    attempts        integer not null default 0,
+    next_attempt    timestamp not null default current_timestamp,
+    last_status     integer,
+    last_error      text not null default '',
+    delivered       timestamp,
+    created         timestamp not null default current_timestamp,
+    unique (subscription_id, event_id)
+);
+
+create index if not exists webhook_deliveries_due_idx on webhook_deliveries (next_attempt) where status = 'pending';
+
+insert into schema_migrations (version) values (4) on conflict do nothing;
+
+-- the relay publishes the outbox to the in-process event bus (dispatched is the time of publishing),
+-- an event failing max attempts is given up with its last error
+alter table outbox_events add column if not exists attempts integer not null default 0;
+alter table outbox_events add column if not exists last_error text not null default '';
+
+insert into schema_migrations (version) values (5) on conflict do nothing;
+
+-- products are upserted by sku on import, products without one are matched by id only
+alter table products add column if not exists sku text;
+create unique index if not exists products_sku_idx on products (sku);
+
+insert into schema_migrations (version) values (6) on conflict do nothing;
+
+-- the dashboard and the exports read sales by time and their positions by sale
+create index if not exists sales_created_idx on sales (created);
+create index if not exists sales_positions_sale_idx on sales_positions (sale_id);
+create index if not exists sales_returns_created_idx on sales_returns (created);
+create index if not exists customers_created_idx on customers (created);
+
+insert into schema_migrations (version) values (7) on conflict do nothing;
+
+-- recency, frequency and monetary scores (1 to 5, 5 is best) of the customers with sales,
+-- refreshed by the refresh-report-aggregates job. The monetary score is the best one of the currencies.
+create materialized view if not exists customer_rfm as
+with stats as (
+    select customer_id, min(created) first_sale, max(created) last_sale, count(*) sales
+    from sales
+    where customer_id <> 0
+    group by customer_id
+), gross as (
+    select customer_id, currency, sum(gross) gross
+    from (
+        select s.customer_id, sp.currency, sp.gross
+        from sales s join sales_positions sp on sp.sale_id = s.id
+        union all
+        select s.customer_id, rp.currency, -rp.gross
+        from sales_returns r
+        join sales_returns_positions rp on rp.return_id = r.id
+        join sales s on s.id = r.sale_id
+    ) t
+    group by customer_id, currency
+), monetary as (
+    select customer_id, max(score) score
+    from (select customer_id, ntile(5) over (partition by currency order by gross) score from gross) t
+    group by customer_id
+)
+select st.customer_id, st.first_sale, st.last_sale, st.sales,
+       ntile(5) over (order by st.last_sale) recency_score,
+       ntile(5) over (order by st.sales) frequency_score,
+       coalesce(m.score, 1) monetary_score
+from stats st
+left join monetary m on m.customer_id = st.customer_id;
+
+create unique index if not exists customer_rfm_customer_idx on customer_rfm (customer_id);
+create index if not exists sales_customer_idx on sales (customer_id);
+
+insert into schema_migrations (version) values (8) on conflict do nothing;
+
+-- loyalty points: a rule earns points for every spend (minor units) of a sale in its currency,
+-- and a point redeemed on a sale takes point_value off it. Group rules win over the ones of every customer.
+create table if not exists loyalty_rules
+(
+    id          bigserial primary key,
+    name        text not null,
+    currency    text not null check(currency ~ '^[A-Z]{3}$'),
+    group_id    bigint references customer_groups,
+    spend       bigint not null check(spend > 0),
+    points      integer not null check(points > 0),
+    point_value bigint not null check(point_value > 0),
+    active      boolean not null default true,
+    created     timestamp not null default current_timestamp
+);
+
+-- the ledger of the points, balance is the one after the entry and the sum of the ledger of the customer
+alter table customers add column if not exists loyalty_points integer not null default 0 check(loyalty_points >= 0);
+
+create table if not exists loyalty_ledger
+(
+    id          bigserial primary key,
+    customer_id bigint not null references customers on delete cascade,
+    kind        text not null check(kind in ('earn', 'redeem', 'adjust')),
+    points      integer not null check(points <> 0),
+    balance     integer not null check(balance >= 0),
+    sale_id     bigint references sales,
+    manager_id  bigint references managers,
+    reason      text not null default '',
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists loyalty_ledger_customer_idx on loyalty_ledger (customer_id, id);
+
+alter table sales add column if not exists points_earned integer not null default 0;
+alter table sales add column if not exists points_redeemed integer not null default 0;
+
+insert into schema_migrations (version) values (9) on conflict do nothing;
+
+-- contacts of the customers, notes of the managers about them and tags to group them
+alter table customers add column if not exists email text not null default '';
+alter table customers add column if not exists address text not null default '';
+
+create table if not exists customer_notes
+(
+    id          bigserial primary key,
+    customer_id bigint not null references customers on delete cascade,
+    manager_id  bigint not null references managers,
+    text        text not null check(text <> ''),
+    created     timestamp not null default current_timestamp
+);
+
+create index if not exists customer_notes_customer_idx on customer_notes (customer_id, created);
+
+create table if not exists customer_tags
+(
+    customer_id bigint not null references customers on delete cascade,
+    tag         text not null check(tag <> ''),
+    created     timestamp not null default current_timestamp,
+    primary key (customer_id, tag)
+);
+
+create index if not exists customer_tags_tag_idx on customer_tags (tag);
+
+insert into schema_migrations (version) values (10) on conflict do nothing;
+
+-- a product may be given away for free, as it can be in a price list
+alter table products drop constraint if exists products_price_check;
+alter table products add constraint products_price_check check(price >= 0);
+
+insert into schema_migrations (version) values (11) on conflict do nothing;
+
+-- a run claims the tick of its job with a lease, so every tick runs once on one instance
+alter table scheduled_jobs add column if not exists last_tick timestamp;
+alter table scheduled_jobs add column if not exists locked_until timestamp;
+
+insert into schema_migrations (version) values (12) on conflict do nothing;
+
+-- a return takes back its share of the points earned on the sale and refunds its share of the redeemed ones
+alter table loyalty_ledger drop constraint if exists loyalty_ledger_kind_check;
+alter table loyalty_ledger add constraint loyalty_ledger_kind_check
+    check(kind in ('earn', 'redeem', 'adjust', 'reverse', 'refund'));
+
+insert into schema_migrations (version) values (13) on conflict do nothing;
+
+-- a fixed discount or promo code is a number of minor units of its currency, existing ones were priced in the default
+alter table discounts add column if not exists currency text check(currency ~ '^[A-Z]{3}$');
+alter table promo_codes add column if not exists currency text check(currency ~ '^[A-Z]{3}$');
+update discounts set currency = 'TJS' where kind = 'fixed' and currency is null;
+update promo_codes set currency = 'TJS' where kind = 'fixed' and currency is null;
+alter table discounts drop constraint if exists discounts_currency_kind_check;
+alter table discounts add constraint discounts_currency_kind_check check((kind = 'fixed') = (currency is not null));
+alter table promo_codes drop constraint if exists promo_codes_currency_kind_check;
+alter table promo_codes add constraint promo_codes_currency_kind_check check((kind = 'fixed') = (currency is not null));
+
+insert into schema_migrations (version) values (14) on conflict do nothing;
+
+-- orders are priced at the checkout like sales, with the discounts and a promo code
+alter table orders add column if not exists promo_code_id bigint references promo_codes;
+alter table orders_positions add column if not exists base_price bigint check(base_price >= 0);
+alter table orders_positions add column if not exists discount bigint not null default 0 check(discount >= 0);
+update orders_positions set base_price = price where base_price is null;
+alter table orders_positions alter column base_price set not null;
+
+insert into schema_migrations (version) values (15) on conflict do nothing;
@@ -0,0 +1,227 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shodikhuja83/crud/pkg/xlsx"
+)
+
+// formats of the files
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	// FormatXLSX is written only
+	FormatXLSX = "xlsx"
+)
+
+var ErrFormat = errors.New("unsupported format")
+
+// maxLine bounds a line of json
+const maxLine = 1 << 20
+
+// Record is a row of a file by column, Row counts the data rows from 1
+type Record struct {
+	Row    int
+	Values map[string]string
+}
+
+// Has reports whether the record has a non empty value of the column
+func (r *Record) Has(column string) bool {
+	return r.Values[column] != ""
+}
+
+// Reader reads the records of a file one at a time, io.EOF after the last one
+type Reader interface {
+	Read() (*Record, error)
+}
+
+// NewReader reads csv with a header row, or json lines of flat objects
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.ReuseRecord = true
+		reader.TrimLeadingSpace = true
+		return &csvReader{reader: reader}, nil
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64<<10), maxLine)
+		return &jsonReader{scanner: scanner}, nil
+	}
+	return nil, ErrFormat
+}
+
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+	row    int
+}
+
+func (c *csvReader) Read() (*Record, error) {
+	if c.header == nil {
+		header, err := c.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		c.header = make([]string, len(header))
+		for i, column := range header {
+			c.header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		}
+	}
+
+	values, err := c.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	c.row++
+	record := &Record{Row: c.row, Values: make(map[string]string, len(values))}
+	for i, value := range values {
+		record.Values[c.header[i]] = strings.TrimSpace(value)
+	}
+	return record, nil
+}
+
+type jsonReader struct {
+	scanner *bufio.Scanner
+	row     int
+}
+
+func (j *jsonReader) Read() (*Record, error) {
+	for j.scanner.Scan() {
+		line := bytes.TrimSpace(j.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		j.row++
+
+		object := make(map[string]interface{})
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil, fmt.Errorf("row %d: %w", j.row, err)
+		}
+		record := &Record{Row: j.row, Values: make(map[string]string, len(object))}
+		for key, value := range object {
+			switch value := value.(type) {
+			case nil:
+				record.Values[key] = ""
+			case string:
+				record.Values[key] = strings.TrimSpace(value)
+			case json.Number, bool:
+				record.Values[key] = fmt.Sprint(value)
+			default:
+				return nil, fmt.Errorf("row %d: %s is not a string, number or boolean", j.row, key)
+			}
+		}
+		return record, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Writer writes rows of the columns given to NewWriter
+type Writer interface {
+	Write(values []string) error
+	Flush() error
+}
+
+// NewWriter writes csv or a worksheet starting with the header, or json lines of objects of strings.
+// The cells of the text columns of a worksheet stay strings even when they look like numbers.
+// Flush ends an xlsx workbook, so it is called once after the last row.
+func NewWriter(format string, w io.Writer, columns []string, text ...string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{writer: writer}, nil
+	case FormatJSONL:
+		return &jsonWriter{writer: bufio.NewWriter(w), columns: columns}, nil
+	case FormatXLSX:
+		writer := xlsx.NewWriter(w, "data")
+		for i, column := range columns {
+			for _, name := range text {
+				if column == name {
+					writer.Text(i)
+				}
+			}
+		}
+		if err := writer.Write(columns); err != nil {
+			return nil, err
+		}
+		return &xlsxWriter{writer: writer}, nil
+	}
+	return nil, ErrFormat
+}
+
+// ContentType returns the media type of the format
+func ContentType(format string) string {
+	switch format {
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return xlsx.ContentType
+	}
+	return "text/csv"
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvWriter) Write(values []string) error {
+	return c.writer.Write(values)
+}
+
+func (c *csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type jsonWriter struct {
+	writer  *bufio.Writer
+	columns []string
+}
+
+func (j *jsonWriter) Write(values []string) error {
+	// written by hand to keep the order of the columns
+	j.writer.WriteByte('{')
+	for i, column := range j.columns {
+		if i > 0 {
+			j.writer.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		value, _ := json.Marshal(values[i])
+		j.writer.Write(key)
+		j.writer.WriteByte(':')
+		j.writer.Write(value)
+	}
+	_, err := j.writer.WriteString("}\n")
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return j.writer.Flush()
+}
+
+type xlsxWriter struct {
+	writer *xlsx.Writer
+}
+
+func (x *xlsxWriter) Write(values []string) error {
+	return x.writer.Write(values)
+}
+
+func (x *xlsxWriter) Flush() error {
+	return x.writer.Close()
+}
@@ -0,0 +1,197 @@
+package bulk
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// readAll reads the records until io.EOF or an error
+func readAll(t *testing.T, format string, input string) ([]*Record, error) {
+	t.Helper()
+	reader, err := NewReader(format, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make([]*Record, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	records, err := readAll(t, FormatCSV, "\ufeffSKU, Name ,price\nA-1, Tea ,12.50\n\"B,2\",,0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records", len(records))
+	}
+
+	first, second := records[0], records[1]
+	if first.Row != 1 || first.Values["sku"] != "A-1" || first.Values["name"] != "Tea" || first.Values["price"] != "12.50" {
+		t.Errorf("first record %+v", first)
+	}
+	if second.Row != 2 || second.Values["sku"] != "B,2" {
+		t.Errorf("second record %+v", second)
+	}
+	// the reader reuses its record, the values of the first one must stay
+	if first.Values["sku"] != "A-1" {
+		t.Errorf("first record changed to %+v", first)
+	}
+	if !second.Has("price") || second.Has("name") || second.Has("missing") {
+		t.Errorf("Has of %+v", second.Values)
+	}
+}
+
+func TestCSVReaderErrors(t *testing.T) {
+	_, err := readAll(t, FormatCSV, "sku,name\nA,Tea\nB\n")
+	parseErr := &csv.ParseError{}
+	if !errors.As(err, &parseErr) || parseErr.Line != 3 {
+		t.Errorf("short row: %v", err)
+	}
+
+	records, err := readAll(t, FormatCSV, "")
+	if err != nil || len(records) != 0 {
+		t.Errorf("empty file: %d records, %v", len(records), err)
+	}
+}
+
+func TestJSONReader(t *testing.T) {
+	records, err := readAll(t, FormatJSONL, `{"sku":" A-1 ","price":12.50,"qty":3,"active":false,"name":null}`+"\n\n"+
+		`{"sku":"B","price":1e2}`+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records", len(records))
+	}
+
+	first, second := records[0], records[1]
+	for column, want := range map[string]string{"sku": "A-1", "price": "12.50", "qty": "3", "active": "false", "name": ""} {
+		if got, ok := first.Values[column]; !ok || got != want {
+			t.Errorf("%s = %q, want %q", column, got, want)
+		}
+	}
+	if first.Has("name") || !first.Has("active") {
+		t.Errorf("Has of %+v", first.Values)
+	}
+	// the blank line isn't a row
+	if second.Row != 2 || second.Values["price"] != "1e2" {
+		t.Errorf("second record %+v", second)
+	}
+}
+
+func TestJSONReaderErrors(t *testing.T) {
+	for input, want := range map[string]string{
+		"{\"sku\":\"A\"}\n\n{\"sku\":\n":        "row 2:",
+		"{\"sku\":\"A\"}\n{\"tags\":[\"a\"]}\n": "row 2: tags is not a string, number or boolean",
+		"{\"sku\":{\"id\":1}}\n":                "row 1: sku is not a string, number or boolean",
+		"[1,2]\n":                               "row 1:",
+		strings.Repeat(" ", maxLine+1) + "{}\n": "too long",
+	} {
+		_, err := readAll(t, FormatJSONL, input)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%.40q: %v, want %q", input, err, want)
+		}
+	}
+}
+
+func TestWriters(t *testing.T) {
+	columns := []string{"sku", "name", "price"}
+	rows := [][]string{{"007", `Tea "green", 100g`, "12.50"}, {"B", "", "0"}}
+
+	for format, want := range map[string]string{
+		FormatCSV: "sku,name,price\n007,\"Tea \"\"green\"\", 100g\",12.50\nB,,0\n",
+		FormatJSONL: `{"sku":"007","name":"Tea \"green\", 100g","price":"12.50"}` + "\n" +
+			`{"sku":"B","name":"","price":"0"}` + "\n",
+	} {
+		out := &bytes.Buffer{}
+		writer, err := NewWriter(format, out, columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err = writer.Write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = writer.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("%s:\n%s\nwant\n%s", format, out, want)
+		}
+
+		// what is written reads back
+		records, err := readAll(t, format, out.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != len(rows) || records[0].Values["name"] != rows[0][1] || records[1].Values["sku"] != "B" {
+			t.Errorf("%s read back %+v", format, records)
+		}
+	}
+}
+
+func TestXLSXTextColumns(t *testing.T) {
+	out := &bytes.Buffer{}
+	writer, err := NewWriter(FormatXLSX, out, []string{"id", "phone"}, "phone", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Write([]string{"1", "992900000001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range archive.File {
+		if file.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheet, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(sheet), `<c r="A2"><v>1</v></c>`) ||
+			!strings.Contains(string(sheet), `<c r="B2" t="inlineStr"><is><t xml:space="preserve">992900000001</t>`) {
+			t.Errorf("phone is not text:\n%s", sheet)
+		}
+		return
+	}
+	t.Error("no worksheet")
+}
+
+func TestFormat(t *testing.T) {
+	if _, err := NewReader(FormatXLSX, strings.NewReader("")); err != ErrFormat {
+		t.Errorf("xlsx reader: %v", err)
+	}
+	if _, err := NewWriter("xml", &bytes.Buffer{}, nil); err != ErrFormat {
+		t.Errorf("xml writer: %v", err)
+	}
+	if ContentType(FormatJSONL) != "application/x-ndjson" || ContentType("") != "text/csv" {
+		t.Errorf("content types")
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/shodikhuja83/crud/pkg/bulk"
+	"github.com/shodikhuja83/crud/pkg/managers"
+)
+
+// ImportProducts upserts the products of the file in the format (bulk.FormatCSV or bulk.FormatJSONL), admins only.
+// The file is committed only when the result has no errors and dryRun is false.
+func (c *Client) ImportProducts(ctx context.Context, format string, file io.Reader, dryRun bool) (*managers.ImportResult, error) {
+	return c.importFile(ctx, "/api/managers/products/import", format, file, dryRun)
+}
+
+// ExportProducts writes every product in the format to out, admins only
+func (c *Client) ExportProducts(ctx context.Context, format string, out io.Writer) error {
+	return c.exportFile(ctx, "/api/managers/products/export", format, out)
+}
+
+// ImportCustomers upserts the customers of the file like ImportProducts, admins only
+func (c *Client) ImportCustomers(ctx context.Context, format string, file io.Reader, dryRun bool) (*managers.ImportResult, error) {
+	return c.importFile(ctx, "/api/managers/customers/import", format, file, dryRun)
+}
+
+// ExportCustomers writes every customer in the format to out, admins only
+func (c *Client) ExportCustomers(ctx context.Context, format string, out io.Writer) error {
+	return c.exportFile(ctx, "/api/managers/customers/export", format, out)
+}
+
+// ExportSales writes the positions of the sales of the manager, the customer, the product and the period of filter in the format
+// (bulk.FormatCSV, bulk.FormatJSONL or bulk.FormatXLSX) to out, admins only
+func (c *Client) ExportSales(ctx context.Context, format string, filter *managers.SalesFilter, out io.Writer) error {
+	query := salesQuery(filter)
+	query.Set("format", format)
+	return c.stream(ctx, http.MethodGet, "/api/managers/sales/export", query, "", nil, func(body io.Reader) error {
+		_, err := io.Copy(out, body)
+		return err
+	})
+}
+
+func (c *Client) importFile(ctx context.Context, path string, format string, file io.Reader, dryRun bool) (*managers.ImportResult, error) {
+	query := url.Values{"format": {format}}
+	if dryRun {
+		query.Set("dry_run", strconv.FormatBool(dryRun))
+	}
+	result := &managers.ImportResult{}
+	err := c.stream(ctx, http.MethodPost, path, query, bulk.ContentType(format), file, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) exportFile(ctx context.Context, path string, format string, out io.Writer) error {
+	return c.stream(ctx, http.MethodGet, path, url.Values{"format": {format}}, "", nil, func(body io.Reader) error {
+		_, err := io.Copy(out, body)
+		return err
+	})
+}
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/errcode"
+)
+
+// defaults of retries of idempotent calls
+const (
+	DefaultRetries = 3
+	DefaultBackoff = 200 * time.Millisecond
+)
+
+var ErrNoToken = errors.New("no auth token, log in first")
+
+// Client calls the api of the service
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+// Option configures the client
+type Option func(*Client)
+
+// WithHTTPClient sets the http client, e.g. with a timeout or the one of httptest
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sets a token from an earlier login
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries sets how often GET and DELETE calls are retried and the backoff before the first retry,
+// the backoff doubles on every retry
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// New creates a client of the service at baseURL, e.g. http://localhost:9999
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		retries:    DefaultRetries,
+		backoff:    DefaultBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Token returns the token the client sends, set by the login methods
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// SetToken ...
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Error is an error response of the service.
+// errors.Is matches it against the sentinel errors of the service packages by their code,
+// e.g. errors.Is(err, managers.ErrNotEnoughStock), and against an *Error by its status and code if set,
+// e.g. errors.Is(err, &client.Error{Status: http.StatusForbidden}).
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// Is ...
+func (e *Error) Is(target error) bool {
+	if apiErr, ok := target.(*Error); ok {
+		return apiErr.Status == e.Status && (apiErr.Code == "" || apiErr.Code == e.Code)
+	}
+	code := errcode.Of(target)
+	return code != "" && code == e.Code
+}
+
+// call sends the request with the json of in and decodes the response into out, both may be nil
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, auth bool, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	token := c.Token()
+	if auth && token == "" {
+		return ErrNoToken
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	attempts := 1
+	if method == http.MethodGet || method == http.MethodDelete {
+		attempts += c.retries
+	}
+
+	backoff := c.backoff
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = c.do(ctx, method, target, token, body, out)
+		if !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// do sends the request once, retry reports whether the failure is temporary
+func (c *Client) do(ctx context.Context, method string, target string, token string, body []byte, out interface{}) (retry bool, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return false, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		// the context is done or the network failed
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		apiErr := responseError(res)
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true, apiErr
+		}
+		return false, apiErr
+	}
+
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, res.Body)
+		return false, err
+	}
+	return false, json.NewDecoder(res.Body).Decode(out)
+}
+
+// stream sends body once with the content type and passes the response body to read, e.g. for files
+func (c *Client) stream(ctx context.Context, method string, path string, query url.Values, contentType string, body io.Reader, read func(io.Reader) error) error {
+	token := c.Token()
+	if token == "" {
+		return ErrNoToken
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", token)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return responseError(res)
+	}
+	return read(res.Body)
+}
+
+func responseError(res *http.Response) *Error {
+	apiErr := &Error{Status: res.StatusCode}
+	data, _ := ioutil.ReadAll(res.Body)
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	// plain text failures, e.g. of the authentication middleware or a proxy
+	if apiErr.Code == "" && apiErr.Status >= http.StatusInternalServerError {
+		apiErr.Code = errcode.Internal
+	}
+	return apiErr
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/customers"
+	"github.com/shodikhuja83/crud/pkg/managers"
+)
+
+// newTestClient calls handler with a token and a short backoff
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL, WithHTTPClient(server.Client()), WithToken("token"), WithRetries(2, time.Millisecond))
+}
+
+func writeError(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+func TestErrorIsByCode(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, `{"status":404,"code":"managers.not_found","error":"item not found"}`)
+	})
+
+	_, err := c.Sale(context.Background(), 1)
+	if !errors.Is(err, managers.ErrNotFound) {
+		t.Errorf("%v is not managers.ErrNotFound", err)
+	}
+	if errors.Is(err, customers.ErrNotFound) {
+		t.Errorf("%v is customers.ErrNotFound", err)
+	}
+	if !errors.Is(err, &Error{Status: http.StatusNotFound}) {
+		t.Errorf("%v is not a 404", err)
+	}
+	if errors.Is(err, &Error{Status: http.StatusNotFound, Code: "customers.not_found"}) {
+		t.Errorf("%v matches another code", err)
+	}
+}
+
+func TestErrorIsInternal(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"json": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusInternalServerError, `{"status":500,"code":"internal","error":"Internal Server Error"}`)
+		},
+		"plain": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := newTestClient(t, handler).Sale(context.Background(), 1)
+			if !errors.Is(err, managers.ErrInternal) || !errors.Is(err, customers.ErrInternal) {
+				t.Errorf("%v is not internal", err)
+			}
+			if errors.Is(err, managers.ErrNotFound) {
+				t.Errorf("%v is managers.ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			writeError(w, http.StatusServiceUnavailable, `{"status":503,"error":"Service Unavailable"}`)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1}`))
+	})
+
+	sale, err := c.Sale(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sale.ID != 1 || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("sale %d after %d calls", sale.ID, calls)
+	}
+}
+
+func TestNoRetryOfPost(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeError(w, http.StatusServiceUnavailable, `{"status":503,"error":"Service Unavailable"}`)
+	})
+
+	_, err := c.SetCartItem(context.Background(), &customers.CartItem{ProductID: 1, Qty: 1})
+	if !errors.Is(err, &Error{Status: http.StatusServiceUnavailable}) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("%d calls", calls)
+	}
+}
+
+func TestNoToken(t *testing.T) {
+	c := New("http://localhost")
+	if _, err := c.Sale(context.Background(), 1); err != ErrNoToken {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/shodikhuja83/crud/pkg/customers"
+	"github.com/shodikhuja83/crud/pkg/receipts"
+)
+
+// RegisterCustomer ...
+func (c *Client) RegisterCustomer(ctx context.Context, registration *customers.Registration) (*customers.Customer, error) {
+	item := &customers.Customer{}
+	if err := c.call(ctx, http.MethodPost, "/api/customers", nil, false, registration, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// LoginCustomer gets a token of the customer, the client sends it from now on
+func (c *Client) LoginCustomer(ctx context.Context, phone string, password string) (string, error) {
+	var res struct {
+		Token string `json:"token"`
+	}
+	err := c.call(ctx, http.MethodPost, "/api/customers/token", nil, false, &customers.Auth{Login: phone, Password: password}, &res)
+	if err != nil {
+		return "", err
+	}
+	c.SetToken(res.Token)
+	return res.Token, nil
+}
+
+// CustomerProducts returns the products on sale
+func (c *Client) CustomerProducts(ctx context.Context) ([]*customers.Product, error) {
+	items := make([]*customers.Product, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/customers/products", nil, false, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Purchases returns the purchased positions of the customer
+func (c *Client) Purchases(ctx context.Context) ([]*customers.Sales, error) {
+	items := make([]*customers.Sales, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/customers/purchases", nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// PurchaseReceipt returns the receipt of a purchase of the customer
+func (c *Client) PurchaseReceipt(ctx context.Context, saleID int64) (*receipts.Receipt, error) {
+	item := &receipts.Receipt{}
+	path := "/api/customers/purchases/" + strconv.FormatInt(saleID, 10) + "/receipt"
+	if err := c.call(ctx, http.MethodGet, path, nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Cart ...
+func (c *Client) Cart(ctx context.Context) ([]*customers.CartItem, error) {
+	items := make([]*customers.CartItem, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/customers/cart", nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SetCartItem puts the product into the cart, qty 0 removes it, returns the cart
+func (c *Client) SetCartItem(ctx context.Context, item *customers.CartItem) ([]*customers.CartItem, error) {
+	items := make([]*customers.CartItem, 0)
+	if err := c.call(ctx, http.MethodPost, "/api/customers/cart", nil, true, item, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// RemoveCartItem ...
+func (c *Client) RemoveCartItem(ctx context.Context, productID int64) error {
+	return c.call(ctx, http.MethodDelete, "/api/customers/cart/"+strconv.FormatInt(productID, 10), nil, true, nil, nil)
+}
+
+// Checkout orders the cart at the prices after the discounts and the promo code, which may be empty
+func (c *Client) Checkout(ctx context.Context, promoCode string) (*customers.Order, error) {
+	request := &struct {
+		PromoCode string `json:"promo_code"`
+	}{promoCode}
+	item := &customers.Order{}
+	if err := c.call(ctx, http.MethodPost, "/api/customers/orders", nil, true, request, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// CustomerOrders ...
+func (c *Client) CustomerOrders(ctx context.Context) ([]*customers.Order, error) {
+	items := make([]*customers.Order, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/customers/orders", nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Loyalty returns the points of the customer with the newest entries of the ledger
+func (c *Client) Loyalty(ctx context.Context) (*customers.Loyalty, error) {
+	item := &customers.Loyalty{}
+	if err := c.call(ctx, http.MethodGet, "/api/customers/loyalty", nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
@@ -0,0 +1,312 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/managers"
+	"github.com/shodikhuja83/crud/pkg/receipts"
+)
+
+// ManagerRegistration is a new manager, Roles may hold "ADMIN"
+type ManagerRegistration struct {
+	ID    int64    `json:"id"`
+	Name  string   `json:"name"`
+	Phone string   `json:"phone"`
+	Roles []string `json:"roles"`
+}
+
+// SalesPage is a page of sales with the totals of all the sales matching the filter, less the returns
+type SalesPage struct {
+	ManagerID int64                  `json:"manager_id"`
+	Totals    []*managers.SalesTotal `json:"totals"`
+	Items     []*managers.Sale       `json:"items"`
+	Count     int64                  `json:"count"`
+	Limit     int                    `json:"limit"`
+	Offset    int                    `json:"offset"`
+}
+
+// RegisterManager registers a manager, only admins may, returns the token of the new manager
+func (c *Client) RegisterManager(ctx context.Context, registration *ManagerRegistration) (string, error) {
+	var res struct {
+		Token string `json:"token"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/api/managers", nil, true, registration, &res); err != nil {
+		return "", err
+	}
+	return res.Token, nil
+}
+
+// LoginManager gets a token of the manager, the client sends it from now on
+func (c *Client) LoginManager(ctx context.Context, phone string, password string) (string, error) {
+	var res struct {
+		Token string `json:"token"`
+	}
+	in := &managers.Manager{Phone: phone, Password: password}
+	if err := c.call(ctx, http.MethodPost, "/api/managers/token", nil, false, in, &res); err != nil {
+		return "", err
+	}
+	c.SetToken(res.Token)
+	return res.Token, nil
+}
+
+// Sales returns a page of the sales visible to the manager, filter may be nil
+func (c *Client) Sales(ctx context.Context, filter *managers.SalesFilter) (*SalesPage, error) {
+	page := &SalesPage{}
+	if err := c.call(ctx, http.MethodGet, "/api/managers/sales", salesQuery(filter), true, nil, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func salesQuery(filter *managers.SalesFilter) url.Values {
+	query := url.Values{}
+	if filter == nil {
+		return query
+	}
+	for name, value := range map[string]int64{
+		"manager_id":  filter.ManagerID,
+		"customer_id": filter.CustomerID,
+		"product_id":  filter.ProductID,
+		"limit":       int64(filter.Limit),
+		"offset":      int64(filter.Offset),
+	} {
+		if value != 0 {
+			query.Set(name, strconv.FormatInt(value, 10))
+		}
+	}
+	if filter.From != nil {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if filter.To != nil {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+	return query
+}
+
+// MakeSale saves the sale, the service prices it
+func (c *Client) MakeSale(ctx context.Context, sale *managers.Sale) (*managers.Sale, error) {
+	item := &managers.Sale{}
+	if err := c.call(ctx, http.MethodPost, "/api/managers/sales", nil, true, sale, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Sale returns the sale with its positions
+func (c *Client) Sale(ctx context.Context, id int64) (*managers.Sale, error) {
+	item := &managers.Sale{}
+	if err := c.call(ctx, http.MethodGet, "/api/managers/sales/"+strconv.FormatInt(id, 10), nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// SaleReceipt ...
+func (c *Client) SaleReceipt(ctx context.Context, id int64) (*receipts.Receipt, error) {
+	item := &receipts.Receipt{}
+	path := "/api/managers/sales/" + strconv.FormatInt(id, 10) + "/receipt"
+	if err := c.call(ctx, http.MethodGet, path, nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Alerts returns the low-stock alerts, only the undelivered ones when pending
+func (c *Client) Alerts(ctx context.Context, pending bool) ([]*managers.Alert, error) {
+	query := url.Values{}
+	if pending {
+		query.Set("pending", "true")
+	}
+	items := make([]*managers.Alert, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/managers/alerts", query, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Products ...
+func (c *Client) Products(ctx context.Context) ([]*managers.Product, error) {
+	items := make([]*managers.Product, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/managers/products", nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SaveProduct creates the product when its ID is 0, changes it otherwise
+func (c *Client) SaveProduct(ctx context.Context, product *managers.Product) (*managers.Product, error) {
+	item := &managers.Product{}
+	if err := c.call(ctx, http.MethodPost, "/api/managers/products", nil, true, product, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// RemoveProduct ...
+func (c *Client) RemoveProduct(ctx context.Context, id int64) error {
+	return c.call(ctx, http.MethodDelete, "/api/managers/products/"+strconv.FormatInt(id, 10), nil, true, nil, nil)
+}
+
+// Customers returns a page of the active customers with their segments and tags, filter may be nil
+func (c *Client) Customers(ctx context.Context, filter *managers.CustomerFilter) ([]*managers.Customer, error) {
+	query := url.Values{}
+	if filter != nil && filter.Segment != "" {
+		query.Set("segment", filter.Segment)
+	}
+	if filter != nil {
+		for _, tag := range filter.Tags {
+			query.Add("tag", tag)
+		}
+		if filter.Limit > 0 {
+			query.Set("limit", strconv.Itoa(filter.Limit))
+		}
+		if filter.Offset > 0 {
+			query.Set("offset", strconv.Itoa(filter.Offset))
+		}
+	}
+	items := make([]*managers.Customer, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/managers/customers", query, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SaveCustomer changes every field of the customer
+func (c *Client) SaveCustomer(ctx context.Context, customer *managers.Customer) (*managers.Customer, error) {
+	item := &managers.Customer{}
+	if err := c.call(ctx, http.MethodPost, "/api/managers/customers", nil, true, customer, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ChangeCustomer changes the fields of the customer set in change
+func (c *Client) ChangeCustomer(ctx context.Context, change *managers.CustomerChange) (*managers.Customer, error) {
+	item := &managers.Customer{}
+	if err := c.call(ctx, http.MethodPost, "/api/managers/customers", nil, true, change, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// RemoveCustomer ...
+func (c *Client) RemoveCustomer(ctx context.Context, id int64) error {
+	return c.call(ctx, http.MethodDelete, "/api/managers/customers/"+strconv.FormatInt(id, 10), nil, true, nil, nil)
+}
+
+// Dashboard returns the overview of the shop, admins only
+func (c *Client) Dashboard(ctx context.Context) (*managers.Dashboard, error) {
+	item := &managers.Dashboard{}
+	if err := c.call(ctx, http.MethodGet, "/api/managers/dashboard", nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// CustomerSummary returns the RFM analysis of the customer
+func (c *Client) CustomerSummary(ctx context.Context, id int64) (*managers.CustomerSummary, error) {
+	item := &managers.CustomerSummary{}
+	path := "/api/managers/customers/" + strconv.FormatInt(id, 10) + "/summary"
+	if err := c.call(ctx, http.MethodGet, path, nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// CustomerLoyalty returns the points of the customer with the newest entries of the ledger
+func (c *Client) CustomerLoyalty(ctx context.Context, id int64) (*managers.Loyalty, error) {
+	item := &managers.Loyalty{}
+	path := "/api/managers/customers/" + strconv.FormatInt(id, 10) + "/loyalty"
+	if err := c.call(ctx, http.MethodGet, path, nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// AdjustPoints adds points to the customer, or takes them off when negative
+func (c *Client) AdjustPoints(ctx context.Context, id int64, adjustment *managers.PointsAdjustment) (*managers.LoyaltyEntry, error) {
+	item := &managers.LoyaltyEntry{}
+	path := "/api/managers/customers/" + strconv.FormatInt(id, 10) + "/loyalty"
+	if err := c.call(ctx, http.MethodPost, path, nil, true, adjustment, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// LoyaltyRules returns the rules of earning and redeeming points, admins only
+func (c *Client) LoyaltyRules(ctx context.Context) ([]*managers.LoyaltyRule, error) {
+	items := make([]*managers.LoyaltyRule, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/managers/loyalty-rules", nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SaveLoyaltyRule creates the rule when its ID is 0, changes it otherwise, admins only
+func (c *Client) SaveLoyaltyRule(ctx context.Context, rule *managers.LoyaltyRule) (*managers.LoyaltyRule, error) {
+	item := &managers.LoyaltyRule{}
+	if err := c.call(ctx, http.MethodPost, "/api/managers/loyalty-rules", nil, true, rule, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// CustomerNotes returns the notes about the customer, newest first
+func (c *Client) CustomerNotes(ctx context.Context, id int64) ([]*managers.CustomerNote, error) {
+	items := make([]*managers.CustomerNote, 0)
+	path := "/api/managers/customers/" + strconv.FormatInt(id, 10) + "/notes"
+	if err := c.call(ctx, http.MethodGet, path, nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// AddCustomerNote saves a note about the customer, signed by the manager of the token
+func (c *Client) AddCustomerNote(ctx context.Context, id int64, text string) (*managers.CustomerNote, error) {
+	item := &managers.CustomerNote{}
+	path := "/api/managers/customers/" + strconv.FormatInt(id, 10) + "/notes"
+	if err := c.call(ctx, http.MethodPost, path, nil, true, &managers.CustomerNote{Text: text}, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// SetCustomerTags replaces the tags of the customer, and returns them normalized
+func (c *Client) SetCustomerTags(ctx context.Context, id int64, tags []string) ([]string, error) {
+	item := &managers.CustomerTags{}
+	path := "/api/managers/customers/" + strconv.FormatInt(id, 10) + "/tags"
+	if err := c.call(ctx, http.MethodPost, path, nil, true, &managers.CustomerTags{Tags: tags}, item); err != nil {
+		return nil, err
+	}
+	return item.Tags, nil
+}
+
+// CustomerTimeline returns a page of the notes and the sales of the customer after the cursor, nil is from now,
+// the cursor of the next page is the one of the last entry
+func (c *Client) CustomerTimeline(ctx context.Context, id int64, before *managers.TimelineCursor) ([]*managers.TimelineEntry, error) {
+	query := url.Values{}
+	if before != nil {
+		query.Set("before", before.Created.Format(time.RFC3339Nano))
+		query.Set("before_kind", before.Kind)
+		query.Set("before_id", strconv.FormatInt(before.ID, 10))
+	}
+	items := make([]*managers.TimelineEntry, 0)
+	path := "/api/managers/customers/" + strconv.FormatInt(id, 10) + "/timeline"
+	if err := c.call(ctx, http.MethodGet, path, query, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Tags returns the tags in use with the number of their customers
+func (c *Client) Tags(ctx context.Context) ([]*managers.TagCount, error) {
+	items := make([]*managers.TagCount, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/managers/customer-tags", nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/shodikhuja83/crud/pkg/webhooks"
+)
+
+// Webhooks returns the webhook subscriptions, admins only
+func (c *Client) Webhooks(ctx context.Context) ([]*webhooks.Subscription, error) {
+	items := make([]*webhooks.Subscription, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/managers/webhooks", nil, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SaveWebhook creates the subscription when its ID is 0, the secret is only in the result of the creation
+func (c *Client) SaveWebhook(ctx context.Context, subscription *webhooks.Subscription) (*webhooks.Subscription, error) {
+	item := &webhooks.Subscription{}
+	if err := c.call(ctx, http.MethodPost, "/api/managers/webhooks", nil, true, subscription, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// RemoveWebhook ...
+func (c *Client) RemoveWebhook(ctx context.Context, id int64) error {
+	return c.call(ctx, http.MethodDelete, "/api/managers/webhooks/"+strconv.FormatInt(id, 10), nil, true, nil, nil)
+}
+
+// WebhookDeliveries returns the deliveries with the status, all of them when it is empty
+func (c *Client) WebhookDeliveries(ctx context.Context, status string) ([]*webhooks.Delivery, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	items := make([]*webhooks.Delivery, 0)
+	if err := c.call(ctx, http.MethodGet, "/api/managers/webhooks/deliveries", query, true, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// RetryWebhookDelivery sends the dead delivery again
+func (c *Client) RetryWebhookDelivery(ctx context.Context, id int64) (*webhooks.Delivery, error) {
+	item := &webhooks.Delivery{}
+	path := "/api/managers/webhooks/deliveries/" + strconv.FormatInt(id, 10) + "/retry"
+	if err := c.call(ctx, http.MethodPost, path, nil, true, nil, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
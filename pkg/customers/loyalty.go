@@ -0,0 +1,65 @@
+package customers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// LoyaltyEntry is an earned, redeemed or adjusted amount of points, Balance is the one after it
+type LoyaltyEntry struct {
+	Kind    string    `json:"kind"`
+	Points  int       `json:"points"`
+	Balance int       `json:"balance"`
+	SaleID  int64     `json:"sale_id"`
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+}
+
+// Loyalty ...
+type Loyalty struct {
+	Balance int             `json:"balance"`
+	History []*LoyaltyEntry `json:"history"`
+}
+
+// Loyalty returns the points of the customer with the newest 100 entries of the ledger
+func (s *Service) Loyalty(ctx context.Context, customerID int64) (*Loyalty, error) {
+	ctx, span := tracer.Start(ctx, "customers.Loyalty")
+	defer span.End()
+
+	item := &Loyalty{History: make([]*LoyaltyEntry, 0)}
+	err := s.pool.QueryRow(ctx, `select loyalty_points from customers where id = $1`, customerID).Scan(&item.Balance)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	rows, err := s.pool.Query(ctx, `
+	select kind, points, balance, coalesce(sale_id, 0), reason, created
+	from loyalty_ledger where customer_id = $1 order by id desc limit 100`, customerID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &LoyaltyEntry{}
+		if err = rows.Scan(&entry.Kind, &entry.Points, &entry.Balance, &entry.SaleID, &entry.Reason, &entry.Created); err != nil {
+			logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+			return nil, ErrInternal
+		}
+		item.History = append(item.History, entry)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
@@ -0,0 +1,307 @@
+package customers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"github.com/shodikhuja83/crud/pkg/pricing"
+	"go.uber.org/zap"
+)
+
+// CartItem is a product the customer is going to order
+type CartItem struct {
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Price     money.Money `json:"price"`
+	Qty       int         `json:"qty"`
+}
+
+// Order ...
+type Order struct {
+	ID        int64            `json:"id"`
+	Status    string           `json:"status"`
+	SaleID    int64            `json:"sale_id"`
+	Comment   string           `json:"comment"`
+	PromoCode string           `json:"promo_code"`
+	Created   time.Time        `json:"created"`
+	Updated   time.Time        `json:"updated"`
+	Positions []*OrderPosition `json:"positions"`
+}
+
+// OrderPosition is priced at the checkout, Price is BasePrice less Discount per unit
+type OrderPosition struct {
+	ID        int64       `json:"id"`
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Qty       int         `json:"qty"`
+	BasePrice money.Money `json:"base_price"`
+	Discount  money.Money `json:"discount"`
+	Price     money.Money `json:"price"`
+}
+
+// Cart returns the cart of the customer
+func (s *Service) Cart(ctx context.Context, customerID int64) ([]*CartItem, error) {
+	ctx, span := tracer.Start(ctx, "customers.Cart")
+	defer span.End()
+
+	items := make([]*CartItem, 0)
+
+	rows, err := s.pool.Query(ctx, `
+	SELECT c.product_id, p.name, coalesce(pl.price, p.price), p.currency, c.qty
+	FROM carts c
+	JOIN products p ON p.id = c.product_id
+	JOIN customers cu ON cu.id = c.customer_id
+	LEFT JOIN price_lists pl ON pl.product_id = p.id AND pl.group_id = cu.group_id
+	WHERE c.customer_id = $1 ORDER BY c.created, c.product_id
+	`, customerID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("cart", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &CartItem{}
+		if err = rows.Scan(&item.ProductID, &item.Name, &item.Price.Amount, &item.Price.Currency, &item.Qty); err != nil {
+			logging.Ctx(ctx, s.logger).Error("cart", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("cart", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SetCartItem puts the product into the cart with the given qty, zero qty removes it
+func (s *Service) SetCartItem(ctx context.Context, customerID int64, item *CartItem) error {
+	ctx, span := tracer.Start(ctx, "customers.SetCartItem")
+	defer span.End()
+
+	if item.Qty < 0 {
+		return ErrInvalidQty
+	}
+	if item.Qty == 0 {
+		return s.RemoveCartItem(ctx, customerID, item.ProductID)
+	}
+
+	var active bool
+	err := s.pool.QueryRow(ctx, `SELECT active FROM products WHERE id = $1`, item.ProductID).Scan(&active)
+	if err == pgx.ErrNoRows || (err == nil && !active) {
+		return ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set cart item", zap.Error(err))
+		return ErrInternal
+	}
+
+	_, err = s.pool.Exec(ctx, `
+	INSERT INTO carts (customer_id, product_id, qty) VALUES ($1, $2, $3)
+	ON CONFLICT (customer_id, product_id) DO UPDATE SET qty = excluded.qty
+	`, customerID, item.ProductID, item.Qty)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set cart item", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// RemoveCartItem ...
+func (s *Service) RemoveCartItem(ctx context.Context, customerID int64, productID int64) error {
+	ctx, span := tracer.Start(ctx, "customers.RemoveCartItem")
+	defer span.End()
+
+	_, err := s.pool.Exec(ctx, `DELETE FROM carts WHERE customer_id = $1 AND product_id = $2`, customerID, productID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("remove cart item", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// Checkout turns the cart into a pending order and reserves its products. The positions are priced like the sales
+// of managers, from the price list of the group of the customer, the best discount and the promo code, which may be
+// empty. A manager confirms the order at these prices.
+func (s *Service) Checkout(ctx context.Context, customerID int64, promoCode string) (*Order, error) {
+	ctx, span := tracer.Start(ctx, "customers.Checkout")
+	defer span.End()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	var groupID int64
+	err = tx.QueryRow(ctx, `SELECT coalesce(group_id, 0) FROM customers WHERE id = $1`, customerID).Scan(&groupID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	rows, err := tx.Query(ctx, `
+	SELECT c.product_id, p.name, c.qty, p.qty - p.reserved, p.active
+	FROM carts c
+	JOIN products p ON p.id = c.product_id
+	WHERE c.customer_id = $1 ORDER BY c.product_id
+	FOR UPDATE OF p
+	`, customerID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+		return nil, ErrInternal
+	}
+	order := &Order{Status: "pending"}
+	for rows.Next() {
+		var available int
+		var active bool
+		position := &OrderPosition{}
+		if err = rows.Scan(&position.ProductID, &position.Name, &position.Qty, &available, &active); err != nil {
+			rows.Close()
+			logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+			return nil, ErrInternal
+		}
+		if !active || available < position.Qty {
+			rows.Close()
+			return nil, ErrNotEnoughStock
+		}
+		order.Positions = append(order.Positions, position)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+		return nil, ErrInternal
+	}
+	if len(order.Positions) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	promo := &pricing.Promo{}
+	if promoCode != "" {
+		if promo, err = pricing.ClaimPromoCode(ctx, tx, promoCode); err != nil {
+			logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+			return nil, ErrInternal
+		}
+		if promo == nil {
+			return nil, ErrInvalidPromoCode
+		}
+		order.PromoCode = strings.TrimSpace(promoCode)
+	}
+
+	for _, position := range order.Positions {
+		quote, err := pricing.Unit(ctx, tx, position.ProductID, groupID)
+		if err == money.ErrOverflow {
+			return nil, err
+		}
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+			return nil, ErrInternal
+		}
+		if promo.ID != 0 {
+			if err = quote.Apply(promo); err != nil {
+				return nil, err
+			}
+		}
+		position.BasePrice, position.Discount, position.Price = quote.BasePrice, quote.Discount, quote.Price
+
+		// an order becomes one sale, which is paid in one currency
+		if order.Positions[0].Price.Currency != position.Price.Currency {
+			return nil, money.ErrCurrencyMismatch
+		}
+		// a fixed promo code is only worth its value in its own currency
+		if promo.ID != 0 && !promo.Applies(position.Price.Currency) {
+			return nil, ErrInvalidPromoCode
+		}
+	}
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO orders (customer_id, promo_code_id) VALUES ($1, nullif($2, 0)) RETURNING id, status, created, updated
+	`, customerID, promo.ID).Scan(&order.ID, &order.Status, &order.Created, &order.Updated)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	for _, position := range order.Positions {
+		err = tx.QueryRow(ctx, `
+		INSERT INTO orders_positions (order_id, product_id, qty, base_price, discount, price, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+		`, order.ID, position.ProductID, position.Qty, position.BasePrice.Amount, position.Discount.Amount,
+			position.Price.Amount, position.Price.Currency).Scan(&position.ID)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+			return nil, ErrInternal
+		}
+		_, err = tx.Exec(ctx, `UPDATE products SET reserved = reserved + $1 WHERE id = $2`, position.Qty, position.ProductID)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+			return nil, ErrInternal
+		}
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM carts WHERE customer_id = $1`, customerID); err != nil {
+		logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("checkout", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return order, nil
+}
+
+// Orders returns the orders of the customer with their statuses
+func (s *Service) Orders(ctx context.Context, customerID int64) ([]*Order, error) {
+	ctx, span := tracer.Start(ctx, "customers.Orders")
+	defer span.End()
+
+	items := make([]*Order, 0)
+
+	rows, err := s.pool.Query(ctx, `
+	SELECT o.id, o.status, coalesce(o.sale_id, 0), o.comment, coalesce(pc.code, ''), o.created, o.updated,
+		op.id, op.product_id, p.name, op.qty, op.base_price, op.discount, op.price, op.currency
+	FROM orders o
+	JOIN orders_positions op ON op.order_id = o.id
+	JOIN products p ON p.id = op.product_id
+	LEFT JOIN promo_codes pc ON pc.id = o.promo_code_id
+	WHERE o.customer_id = $1
+	ORDER BY o.id DESC, op.id
+	`, customerID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("orders", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	var item *Order
+	for rows.Next() {
+		order := &Order{}
+		position := &OrderPosition{}
+		err = rows.Scan(&order.ID, &order.Status, &order.SaleID, &order.Comment, &order.PromoCode, &order.Created,
+			&order.Updated, &position.ID, &position.ProductID, &position.Name, &position.Qty,
+			&position.BasePrice.Amount, &position.Discount.Amount, &position.Price.Amount, &position.Price.Currency)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("orders", zap.Error(err))
+			return nil, ErrInternal
+		}
+		position.BasePrice.Currency = position.Price.Currency
+		position.Discount.Currency = position.Price.Currency
+		if item == nil || item.ID != order.ID {
+			item = order
+			items = append(items, item)
+		}
+		item.Positions = append(item.Positions, position)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("orders", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
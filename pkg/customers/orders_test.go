@@ -0,0 +1,83 @@
+package customers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// newDatabaseService uses TEST_DATABASE_URL, a database with the schema applied, the test is skipped without it
+func newDatabaseService(t *testing.T) *Service {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return NewService(pool, zap.NewNop())
+}
+
+func TestCheckoutPricing(t *testing.T) {
+	s := newDatabaseService(t)
+	ctx := context.Background()
+	suffix := fmt.Sprint(time.Now().UnixNano())
+
+	var groupID, customerID, productID int64
+	err := s.pool.QueryRow(ctx, `insert into customer_groups (name) values ($1) returning id`, "test "+suffix).Scan(&groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.pool.QueryRow(ctx, `
+	insert into customers (name, phone, password, group_id) values ('Test', $1, '', $2) returning id`,
+		"+992"+suffix, groupID).Scan(&customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.pool.QueryRow(ctx, `
+	insert into products (name, sku, price, currency, qty) values ('Test', $1, 2000, 'TJS', 10) returning id`,
+		"T"+suffix).Scan(&productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.pool.Exec(ctx, `
+	insert into discounts (name, kind, value, group_id, product_id) values ('test', 'percent', 10, $1, $2);
+	insert into promo_codes (code, kind, value, currency, usage_limit) values ('T' || $3, 'fixed', 100, 'TJS', 1),
+		('J' || $3, 'fixed', 100, 'JPY', 0)`, groupID, productID, suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.SetCartItem(ctx, customerID, &CartItem{ProductID: productID, Qty: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Checkout(ctx, customerID, "J"+suffix); err != ErrInvalidPromoCode {
+		t.Errorf("checkout with a promo code in another currency: %v", err)
+	}
+	order, err := s.Checkout(ctx, customerID, "T"+suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := order.Positions[0]
+	if position.BasePrice != money.New(2000, "TJS") || position.Discount != money.New(300, "TJS") ||
+		position.Price != money.New(1700, "TJS") || order.PromoCode != "T"+suffix {
+		t.Errorf("order %+v, position %+v", order, position)
+	}
+
+	if err = s.SetCartItem(ctx, customerID, &CartItem{ProductID: productID, Qty: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Checkout(ctx, customerID, "T"+suffix); err != ErrInvalidPromoCode {
+		t.Errorf("checkout with a used up promo code: %v", err)
+	}
+}
@@ -6,15 +6,21 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
-	"log"
 	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"github.com/shodikhuja83/crud/pkg/outbox"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
-
 )
 
+var tracer = otel.Tracer("github.com/shodikhuja83/crud/pkg/customers")
+
 var ErrNotFound = errors.New("item not found")
 
 var ErrInternal = errors.New("internal error")
@@ -23,20 +29,25 @@ var ErrPhoneUsed = errors.New("phone already registered")
 var ErrInvalidPassword = errors.New("invalid password")
 var ErrTokenNotFound = errors.New("token not found")
 var ErrTokenExpired = errors.New("token expired")
+var ErrInvalidQty = errors.New("invalid qty")
+var ErrNotEnoughStock = errors.New("not enough stock")
+var ErrCartEmpty = errors.New("cart is empty")
+var ErrInvalidPromoCode = errors.New("invalid promo code")
 
 type Service struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	logger *zap.Logger
 }
 
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+func NewService(pool *pgxpool.Pool, logger *zap.Logger) *Service {
+	return &Service{pool: pool, logger: logger}
 }
 
 type Customer struct {
 	ID       int64     `json:"id"`
 	Name     string    `json:"name"`
 	Phone    string    `json:"phone"`
-	Password string    `json:"password"`
+	Password string    `json:"password,omitempty"`
 	Active   bool      `json:"active"`
 	Created  time.Time `json:"created"`
 }
@@ -48,16 +59,27 @@ type Registration struct {
 }
 
 func (s *Service) Register(ctx context.Context, registration *Registration) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "customers.Register")
+	defer span.End()
+
 	var err error
 	item := &Customer{}
 
+	_, hashSpan := tracer.Start(ctx, "bcrypt.GenerateFromPassword")
 	hash, err := bcrypt.GenerateFromPassword([]byte(registration.Password), bcrypt.DefaultCost)
+	hashSpan.End()
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("register", zap.Error(err))
 		return nil, ErrInternal
 	}
-	log.Print(hash)
+	defer tx.Rollback(ctx)
 
-	err = s.pool.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 	INSERT INTO customers (name, phone, password)
 	VALUES ($1,$2,$3)
 	ON CONFLICT (phone) DO NOTHING RETURNING id,name,phone, active, created
@@ -65,12 +87,25 @@ func (s *Service) Register(ctx context.Context, registration *Registration) (*Cu
 		&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created,
 	)
 	if err == pgx.ErrNoRows {
+		return nil, ErrPhoneUsed
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("register", zap.Error(err))
 		return nil, ErrInternal
 	}
+
+	err = outbox.Write(ctx, tx, &events.CustomerRegistered{
+		CustomerID: item.ID, Name: item.Name, Phone: item.Phone, Created: item.Created,
+	})
 	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("register", zap.Error(err))
 		return nil, ErrInternal
 	}
 
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("register", zap.Error(err))
+		return nil, ErrInternal
+	}
 	return item, nil
 }
 
@@ -85,9 +120,11 @@ type Token struct {
 
 type Sales struct {
 	 ID 	       int64  		`json:"id"`
+	 SaleID        int64  		`json:"sale_id"`
 	 Name          string 		`json:"name"`
-	 Price         int    		`json:"price"`
+	 Price         money.Money 	`json:"price"`
 	 Qty           int 	  		`json:"qty"`
+	 Returned      int 	  		`json:"returned"`
 	 Created       time.Time 	`json:"created"`
 }
 
@@ -96,15 +133,18 @@ type Sales struct {
 type Product struct{
 	ID 		int64	`json:"id"`
 	Name 	string  `json:"name"`
-	Price   int 	`json:"price"`
+	Price   money.Money `json:"price"`
 	Qty		int 	`json:"qty"`
 }
 
 func (s *Service) Products(ctx context.Context) ([]*Product, error) {
+	ctx, span := tracer.Start(ctx, "customers.Products")
+	defer span.End()
+
 	items :=make([]*Product, 0)
 
 	rows, err := s.pool.Query(ctx, `
-	SELECT id,name, price,qty FROM products WHERE active ORDER BY id LIMIT 500
+	SELECT id,name, price, currency, qty FROM products WHERE active ORDER BY id LIMIT 500
 	`)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return items, nil 
@@ -116,16 +156,16 @@ func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 
 	for rows.Next() {
 		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
+		err = rows.Scan(&item.ID, &item.Name, &item.Price.Amount, &item.Price.Currency, &item.Qty)
 		if err != nil {
-			log.Print(err)
+			logging.Ctx(ctx, s.logger).Error("products", zap.Error(err))
 			return nil, err
 		}
 		items = append(items, item)
 	}
 	err = rows.Err()
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("products", zap.Error(err))
 		return nil,err
 	}
 	return items, nil 
@@ -133,6 +173,9 @@ func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 
 //find Id customers via Token
 func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "customers.IDByToken")
+	defer span.End()
+
 	var id int64
 	err := s.pool.QueryRow(ctx,`
 	SELECT customer_id FROM customers_tokens WHERE token =$1
@@ -148,13 +191,21 @@ func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
 }
 
 func (s *Service) Purchases(ctx context.Context, id int64) ([]*Sales, error) {
+	ctx, span := tracer.Start(ctx, "customers.Purchases")
+	defer span.End()
+
 	sales :=make([]*Sales, 0)
 
 	rows, err := s.pool.Query(ctx, `
-	SELECT sp.id, sp.name, sp.price,sp.qty,sp.created 
-	FROM sale_positions sp 
+	SELECT sp.id, sp.sale_id, p.name, sp.price, sp.currency, sp.qty - coalesce(rp.qty, 0), coalesce(rp.qty, 0), sp.created
+	FROM sales_positions sp
 	JOIN sales s on s.id = sp.sale_id
-	WHERE s.customer_id = $1;
+	JOIN products p on p.id = sp.product_id
+	LEFT JOIN (
+		SELECT sale_position_id, sum(qty) qty FROM sales_returns_positions GROUP BY sale_position_id
+	) rp on rp.sale_position_id = sp.id
+	WHERE s.customer_id = $1
+	ORDER BY sp.id;
 	`,id)
 	if err != nil {
 		return nil, ErrInternal
@@ -163,16 +214,16 @@ func (s *Service) Purchases(ctx context.Context, id int64) ([]*Sales, error) {
 
 	for rows.Next() {
 		sale := &Sales{}
-		err = rows.Scan(&sale.ID, &sale.Name, &sale.Price, &sale.Qty, &sale.Created)
+		err = rows.Scan(&sale.ID, &sale.SaleID, &sale.Name, &sale.Price.Amount, &sale.Price.Currency, &sale.Qty, &sale.Returned, &sale.Created)
 		if err != nil {
-			log.Print(err)
+			logging.Ctx(ctx, s.logger).Error("purchases", zap.Error(err))
 			return nil, err
 		}
 		sales = append(sales, sale)
 	}
 	err = rows.Err()
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("purchases", zap.Error(err))
 		return nil,err
 	}
 	return sales, nil
@@ -180,10 +231,13 @@ func (s *Service) Purchases(ctx context.Context, id int64) ([]*Sales, error) {
 
 // method for generating a token
 func (s *Service) Token(ctx context.Context, phone string, password string) (token string, err error) {
+	ctx, span := tracer.Start(ctx, "customers.Token")
+	defer span.End()
+
 	var hash string
 	var id int64
 
-	err = s.pool.QueryRow(ctx, `SELECT id,password FROM customers WHERE phone =$1`, phone).Scan(&id, &hash)
+	err = s.pool.QueryRow(ctx, `SELECT id,password FROM customers WHERE phone =$1 AND active`, phone).Scan(&id, &hash)
 
 	if err == pgx.ErrNoRows {
 		return "", ErrNoSuchUser
@@ -192,7 +246,9 @@ func (s *Service) Token(ctx context.Context, phone string, password string) (tok
 		return "", ErrInternal
 	}
 
+	_, hashSpan := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	hashSpan.End()
 	if err != nil {
 		return "", ErrInvalidPassword
 	}
@@ -217,6 +273,9 @@ func (s *Service) Token(ctx context.Context, phone string, password string) (tok
 
 
 func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "customers.ByID")
+	defer span.End()
+
 	item := &Customer{}
 
 	err := s.pool.QueryRow(ctx, `
@@ -228,7 +287,7 @@ func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
 	}
 
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("by id", zap.Error(err))
 		return nil, ErrInternal
 	}
 
@@ -237,6 +296,8 @@ func (s *Service) ByID(ctx context.Context, id int64) (*Customer, error) {
 }
 
 func (s *Service) All(ctx context.Context) (items []*Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customers.All")
+	defer span.End()
 
 	rows, err := s.pool.Query(ctx, `
 		SELECT * FROM customers
@@ -251,7 +312,7 @@ func (s *Service) All(ctx context.Context) (items []*Customer, err error) {
 			&item.Active,
 			&item.Created)
 		if err != nil {
-			log.Print(err)
+			logging.Ctx(ctx, s.logger).Error("all", zap.Error(err))
 		}
 
 		items = append(items, item)
@@ -259,6 +320,8 @@ func (s *Service) All(ctx context.Context) (items []*Customer, err error) {
 	return items, nil
 }
 func (s *Service) AllActive(ctx context.Context) (items []*Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customers.AllActive")
+	defer span.End()
 
 	rows, err := s.pool.Query(ctx, `
 		SELECT * FROM customers WHERE active
@@ -273,7 +336,7 @@ func (s *Service) AllActive(ctx context.Context) (items []*Customer, err error)
 			&item.Active,
 			&item.Created)
 		if err != nil {
-			log.Print(err)
+			logging.Ctx(ctx, s.logger).Error("all active", zap.Error(err))
 		}
 
 		items = append(items, item)
@@ -283,6 +346,8 @@ func (s *Service) AllActive(ctx context.Context) (items []*Customer, err error)
 
 // //Save method
 func (s *Service) Save(ctx context.Context, customer *Customer) (c *Customer, err error) {
+	ctx, span := tracer.Start(ctx, "customers.Save")
+	defer span.End()
 
 	item := &Customer{}
 
@@ -307,7 +372,7 @@ func (s *Service) Save(ctx context.Context, customer *Customer) (c *Customer, er
 	}
 
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("save", zap.Error(err))
 		return nil, ErrInternal
 	}
 	return item, nil
@@ -315,6 +380,9 @@ func (s *Service) Save(ctx context.Context, customer *Customer) (c *Customer, er
 }
 
 func (s *Service) RemoveById(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "customers.RemoveById")
+	defer span.End()
+
 	item := &Customer{}
 	err := s.pool.QueryRow(ctx, `
 	DELETE FROM customers WHERE id=$1 RETURNING id,name,phone,active,created
@@ -325,7 +393,7 @@ func (s *Service) RemoveById(ctx context.Context, id int64) (*Customer, error) {
 	}
 
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("remove by id", zap.Error(err))
 		return nil, ErrInternal
 	}
 
@@ -334,6 +402,9 @@ func (s *Service) RemoveById(ctx context.Context, id int64) (*Customer, error) {
 }
 
 func (s *Service) BlockByID(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "customers.BlockByID")
+	defer span.End()
+
 	item := &Customer{}
 	err := s.pool.QueryRow(ctx, `
 		UPDATE customers SET active = false WHERE id = $1 RETURNING id, name, phone, active, created
@@ -344,7 +415,7 @@ func (s *Service) BlockByID(ctx context.Context, id int64) (*Customer, error) {
 	}
 
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("block by id", zap.Error(err))
 		return nil, ErrInternal
 	}
 
@@ -352,6 +423,9 @@ func (s *Service) BlockByID(ctx context.Context, id int64) (*Customer, error) {
 
 }
 func (s *Service) UnBlockByID(ctx context.Context, id int64) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "customers.UnBlockByID")
+	defer span.End()
+
 	item := &Customer{}
 	err := s.pool.QueryRow(ctx, `
 		UPDATE customers SET active = true WHERE id = $1 RETURNING id, name, phone, active, created
@@ -362,7 +436,7 @@ func (s *Service) UnBlockByID(ctx context.Context, id int64) (*Customer, error)
 	}
 
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("un block by id", zap.Error(err))
 		return nil, ErrInternal
 	}
 
@@ -0,0 +1,67 @@
+// Package errcode names the sentinel errors of the services, the api sends the name as the code of an error,
+// so clients tell apart errors with the same message, e.g. managers.ErrNotFound and customers.ErrNotFound
+package errcode
+
+import (
+	"github.com/shodikhuja83/crud/pkg/customers"
+	"github.com/shodikhuja83/crud/pkg/managers"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"github.com/shodikhuja83/crud/pkg/webhooks"
+)
+
+// Internal is the code of every failure of the server, its message is never sent
+const Internal = "internal"
+
+var codes = map[error]string{
+	managers.ErrInternal:           Internal,
+	customers.ErrInternal:          Internal,
+	webhooks.ErrInternal:           Internal,
+	managers.ErrNotFound:           "managers.not_found",
+	managers.ErrTokenNotFound:      "managers.token_not_found",
+	managers.ErrNoSuchUser:         "managers.no_such_user",
+	managers.ErrInvalidPassword:    "managers.invalid_password",
+	managers.ErrPhoneUsed:          "managers.phone_used",
+	managers.ErrTokenExpired:       "managers.token_expired",
+	managers.ErrNotEnoughStock:     "managers.not_enough_stock",
+	managers.ErrInvalidMovement:    "managers.invalid_movement",
+	managers.ErrInvalidPosition:    "managers.invalid_position",
+	managers.ErrReturnExceedsSale:  "managers.return_exceeds_sale",
+	managers.ErrOrderNotPending:    "managers.order_not_pending",
+	managers.ErrInvalidDiscount:    "managers.invalid_discount",
+	managers.ErrInvalidPromoCode:   "managers.invalid_promo_code",
+	managers.ErrInvalidPrice:       "managers.invalid_price",
+	managers.ErrInvalidTaxRate:     "managers.invalid_tax_rate",
+	managers.ErrInvalidManager:     "managers.invalid_manager",
+	managers.ErrInvalidThreshold:   "managers.invalid_threshold",
+	managers.ErrInvalidCategory:    "managers.invalid_category",
+	managers.ErrSKUUsed:            "managers.sku_used",
+	managers.ErrInvalidSegment:     "managers.invalid_segment",
+	managers.ErrInvalidLoyaltyRule: "managers.invalid_loyalty_rule",
+	managers.ErrNotEnoughPoints:    "managers.not_enough_points",
+	managers.ErrInvalidRedemption:  "managers.invalid_redemption",
+	managers.ErrInvalidAdjustment:  "managers.invalid_adjustment",
+	managers.ErrInvalidEmail:       "managers.invalid_email",
+	managers.ErrInvalidNote:        "managers.invalid_note",
+	managers.ErrInvalidTag:         "managers.invalid_tag",
+	customers.ErrNotFound:          "customers.not_found",
+	customers.ErrNoSuchUser:        "customers.no_such_user",
+	customers.ErrPhoneUsed:         "customers.phone_used",
+	customers.ErrInvalidPassword:   "customers.invalid_password",
+	customers.ErrTokenNotFound:     "customers.token_not_found",
+	customers.ErrTokenExpired:      "customers.token_expired",
+	customers.ErrInvalidQty:        "customers.invalid_qty",
+	customers.ErrNotEnoughStock:    "customers.not_enough_stock",
+	customers.ErrCartEmpty:         "customers.cart_empty",
+	customers.ErrInvalidPromoCode:  "customers.invalid_promo_code",
+	webhooks.ErrNotFound:           "webhooks.not_found",
+	webhooks.ErrInvalidURL:         "webhooks.invalid_url",
+	webhooks.ErrInvalidEvent:       "webhooks.invalid_event",
+	money.ErrCurrencyMismatch:      "money.currency_mismatch",
+	money.ErrInvalidCurrency:       "money.invalid_currency",
+	money.ErrOverflow:              "money.overflow",
+}
+
+// Of returns the code of the error, empty for errors that are not sentinel errors of the services
+func Of(err error) string {
+	return codes[err]
+}
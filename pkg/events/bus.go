@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/shodikhuja83/crud/pkg/events")
+
+// Handler reacts to a published event, events are delivered at least once so handlers must be idempotent.
+// tx is the one marking the event published, handlers write through it instead of taking other connections
+type Handler func(ctx context.Context, tx pgx.Tx, envelope *Envelope) error
+
+type subscription struct {
+	name    string
+	handler Handler
+}
+
+// Bus passes the events of the outbox to the subscribers in the process
+type Bus struct {
+	logger *zap.Logger
+
+	mu   sync.RWMutex
+	subs map[string][]*subscription
+	all  []*subscription
+}
+
+func NewBus(logger *zap.Logger) *Bus {
+	return &Bus{logger: logger, subs: make(map[string][]*subscription)}
+}
+
+// Subscribe calls the handler, named for the logs, with every event of the name
+func (b *Bus) Subscribe(event string, name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[event] = append(b.subs[event], &subscription{name: name, handler: handler})
+}
+
+// SubscribeAll calls the handler with every event
+func (b *Bus) SubscribeAll(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.all = append(b.all, &subscription{name: name, handler: handler})
+}
+
+// Publish calls the subscribers of the event with tx in the order of subscription, stopping at the first error
+func (b *Bus) Publish(ctx context.Context, tx pgx.Tx, envelope *Envelope) error {
+	ctx, span := tracer.Start(ctx, "events.Publish")
+	defer span.End()
+	span.SetAttributes(attribute.String("event.name", envelope.Name), attribute.Int64("event.id", envelope.ID))
+
+	b.mu.RLock()
+	subs := make([]*subscription, 0, len(b.all)+len(b.subs[envelope.Name]))
+	subs = append(subs, b.subs[envelope.Name]...)
+	subs = append(subs, b.all...)
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if err := sub.handler(ctx, tx, envelope); err != nil {
+			logging.Ctx(ctx, b.logger).Warn("event handler failed", zap.String("subscriber", sub.name),
+				zap.String("event", envelope.Name), zap.Int64("event_id", envelope.ID), zap.Error(err))
+			return fmt.Errorf("%s: %w", sub.name, err)
+		}
+	}
+	return nil
+}
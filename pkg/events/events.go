@@ -0,0 +1,109 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/money"
+)
+
+// names of the events, also the event names of the webhooks
+const (
+	NameCustomerRegistered  = "customer.registered"
+	NameSaleCompleted       = "sale.completed"
+	NameProductSaved        = "product.saved"
+	NameProductStockChanged = "product.stock_changed"
+)
+
+// Event is a domain event, written to the outbox with the change and published after the commit
+type Event interface {
+	EventName() string
+}
+
+// CustomerRegistered ...
+type CustomerRegistered struct {
+	CustomerID int64     `json:"customer_id"`
+	Name       string    `json:"name"`
+	Phone      string    `json:"phone"`
+	Created    time.Time `json:"created"`
+}
+
+// SaleCompleted is a saved sale, made by a manager or confirmed from an order
+type SaleCompleted struct {
+	SaleID     int64       `json:"sale_id"`
+	ManagerID  int64       `json:"manager_id"`
+	CustomerID int64       `json:"customer_id"`
+	PromoCode  string      `json:"promo_code"`
+	Gross      money.Money `json:"gross"`
+	Lines      []*SaleLine `json:"lines"`
+	Created    time.Time   `json:"created"`
+}
+
+// SaleLine is a position of a completed sale
+type SaleLine struct {
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Qty       int         `json:"qty"`
+	Price     money.Money `json:"price"`
+	Gross     money.Money `json:"gross"`
+}
+
+// ProductSaved is a created or changed product
+type ProductSaved struct {
+	ProductID        int64       `json:"product_id"`
+	SKU              string      `json:"sku"`
+	Name             string      `json:"name"`
+	Price            money.Money `json:"price"`
+	CategoryID       int64       `json:"category_id"`
+	ReorderThreshold *int        `json:"reorder_threshold"`
+	Active           bool        `json:"active"`
+}
+
+// ProductStockChanged is a movement of the stock, Qty and Reserved are the stock after it
+type ProductStockChanged struct {
+	ProductID  int64     `json:"product_id"`
+	MovementID int64     `json:"movement_id"`
+	Kind       string    `json:"kind"`
+	Delta      int       `json:"delta"`
+	Qty        int       `json:"qty"`
+	Reserved   int       `json:"reserved"`
+	Created    time.Time `json:"created"`
+}
+
+func (CustomerRegistered) EventName() string  { return NameCustomerRegistered }
+func (SaleCompleted) EventName() string       { return NameSaleCompleted }
+func (ProductSaved) EventName() string        { return NameProductSaved }
+func (ProductStockChanged) EventName() string { return NameProductStockChanged }
+
+// Names lists every event
+var Names = []string{NameCustomerRegistered, NameSaleCompleted, NameProductSaved, NameProductStockChanged}
+
+// Envelope is a published event, Event is nil when the name is unknown to this version
+type Envelope struct {
+	ID      int64
+	Name    string
+	Payload json.RawMessage
+	Created time.Time
+	Event   Event
+}
+
+// Decode returns the typed event of the payload, nil for an unknown name
+func Decode(name string, payload []byte) (Event, error) {
+	var event Event
+	switch name {
+	case NameCustomerRegistered:
+		event = &CustomerRegistered{}
+	case NameSaleCompleted:
+		event = &SaleCompleted{}
+	case NameProductSaved:
+		event = &ProductSaved{}
+	case NameProductStockChanged:
+		event = &ProductStockChanged{}
+	default:
+		return nil, nil
+	}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// SchemaVersion is the lowest version of schema_migrations the service needs, migrations only add
+// to the schema, so a newer one applied during a rolling deploy keeps the running instances ready
+const SchemaVersion = 15
+
+var ErrShuttingDown = errors.New("shutting down")
+var ErrDatabase = errors.New("database unavailable")
+var ErrSchemaVersion = errors.New("unexpected schema version")
+
+// Service checks whether the application can serve requests
+type Service struct {
+	pool         *pgxpool.Pool
+	logger       *zap.Logger
+	shuttingDown int32
+}
+
+func NewService(pool *pgxpool.Pool, logger *zap.Logger) *Service {
+	return &Service{pool: pool, logger: logger}
+}
+
+// Check is the result of a readiness check
+type Check struct {
+	Status        string `json:"status"`
+	Database      string `json:"database"`
+	SchemaVersion int64  `json:"schema_version"`
+	Expected      int64  `json:"expected_schema_version"`
+}
+
+// ShutDown makes the service report not ready, so no new traffic is sent while requests drain
+func (s *Service) ShutDown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
+// ShuttingDown ...
+func (s *Service) ShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+// Ready pings the database and checks the version of its schema
+func (s *Service) Ready(ctx context.Context) (*Check, error) {
+	check := &Check{Status: "ok", Database: "ok", Expected: SchemaVersion}
+	if s.ShuttingDown() {
+		check.Status = "shutting down"
+		return check, ErrShuttingDown
+	}
+
+	if err := s.pool.Ping(ctx); err != nil {
+		s.logger.Warn("ping database", zap.Error(err))
+		check.Status = "unavailable"
+		check.Database = "unavailable"
+		return check, ErrDatabase
+	}
+
+	err := s.pool.QueryRow(ctx, `select coalesce(max(version), 0) from schema_migrations`).Scan(&check.SchemaVersion)
+	if err != nil {
+		s.logger.Warn("schema version", zap.Error(err))
+		check.Status = "unavailable"
+		return check, ErrSchemaVersion
+	}
+	if check.SchemaVersion < SchemaVersion {
+		check.Status = fmt.Sprintf("schema version %d, want at least %d", check.SchemaVersion, SchemaVersion)
+		return check, ErrSchemaVersion
+	}
+
+	return check, nil
+}
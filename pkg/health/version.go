@@ -0,0 +1,34 @@
+package health
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// build info, set with -ldflags "-X github.com/shodikhuja83/crud/pkg/health.Version=..."
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Build describes the running binary
+type Build struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module"`
+}
+
+// BuildInfo returns the build of the running binary
+func BuildInfo() *Build {
+	build := &Build{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		build.Module = info.Main.Path
+		if build.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			build.Version = info.Main.Version
+		}
+	}
+	return build
+}
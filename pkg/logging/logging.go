@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces secrets (password hashes, tokens) in logs
+const Redacted = "[REDACTED]"
+
+var requestIDContextKey = &contextKey{"request id"}
+
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return c.name
+}
+
+// Config of the logger, Level is one of debug, info, warn, error and Format is json or console
+type Config struct {
+	Level  string
+	Format string
+}
+
+// New creates the logger of the application
+func New(config Config) (*zap.Logger, error) {
+	level := zap.NewAtomicLevel()
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(strings.ToLower(config.Level))); err != nil {
+			return nil, err
+		}
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = level
+	zapConfig.EncoderConfig.TimeKey = "time"
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	if config.Format == "console" {
+		zapConfig.Encoding = "console"
+		zapConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+
+	return zapConfig.Build()
+}
+
+// WithRequestID returns the context carrying the id of the request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// RequestID returns the id of the request from the context, empty if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// Ctx adds the request id and the trace id from the context to the logger
+func Ctx(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if logger == nil {
+		logger = zap.L()
+	}
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With(zap.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		logger = logger.With(zap.String("trace_id", span.TraceID().String()))
+	}
+	return logger
+}
+
+// Secret logs the key without its value
+func Secret(key string) zap.Field {
+	return zap.String(key, Redacted)
+}
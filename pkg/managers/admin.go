@@ -0,0 +1,234 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// owners of tokens
+const (
+	TokenManager  = "manager"
+	TokenCustomer = "customer"
+)
+
+// length of the token prefix shown to operators and accepted to revoke a token
+const TokenPrefixLength = 12
+
+// TokenInfo describes a token without exposing it, Prefix is its first TokenPrefixLength characters
+type TokenInfo struct {
+	Kind    string    `json:"kind"`
+	OwnerID int64     `json:"owner_id"`
+	Prefix  string    `json:"prefix"`
+	Expire  time.Time `json:"expire"`
+	Created time.Time `json:"created"`
+}
+
+// TokenFilter selects tokens, the zero filter selects all of them
+type TokenFilter struct {
+	ManagerID  int64
+	CustomerID int64
+	Prefix     string
+}
+
+// CreateAdmin creates an admin with the password
+func (s *Service) CreateAdmin(ctx context.Context, name string, phone string, password string) (*Manager, error) {
+	ctx, span := tracer.Start(ctx, "managers.CreateAdmin")
+	defer span.End()
+
+	if name == "" || phone == "" {
+		return nil, ErrInvalidManager
+	}
+	if password == "" {
+		return nil, ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	item := &Manager{Name: name, Phone: phone, IsAdmin: true}
+	err = s.db.QueryRow(ctx, `
+	insert into managers (name, phone, password, is_admin) values ($1, $2, $3, true)
+	on conflict (phone) do nothing returning id, created`, name, phone, hash).Scan(&item.ID, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, ErrPhoneUsed
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("create admin", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// ResetPassword sets the password of the manager and revokes the tokens of the manager
+func (s *Service) ResetPassword(ctx context.Context, phone string, password string) error {
+	ctx, span := tracer.Start(ctx, "managers.ResetPassword")
+	defer span.End()
+
+	if password == "" {
+		return ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return ErrInternal
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("reset password", zap.Error(err))
+		return ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx, `update managers set password = $2 where phone = $1 returning id`, phone, hash).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return ErrNoSuchUser
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("reset password", zap.Error(err))
+		return ErrInternal
+	}
+	if _, err = tx.Exec(ctx, `delete from managers_tokens where manager_id = $1`, id); err != nil {
+		logging.Ctx(ctx, s.logger).Error("reset password", zap.Error(err))
+		return ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("reset password", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// tokensSQL selects the tokens of managers and customers matching $1 manager, $2 customer and $3 prefix
+const tokensSQL = `
+	select 'manager' kind, manager_id owner_id, token, expire, created from managers_tokens
+	where ($1::bigint = 0 or manager_id = $1) and $2::bigint = 0
+	union all
+	select 'customer', customer_id, token, expire, created from customers_tokens
+	where ($2::bigint = 0 or customer_id = $2) and $1::bigint = 0`
+
+// Tokens lists the tokens matching the filter
+func (s *Service) Tokens(ctx context.Context, filter *TokenFilter) ([]*TokenInfo, error) {
+	ctx, span := tracer.Start(ctx, "managers.Tokens")
+	defer span.End()
+
+	items := make([]*TokenInfo, 0)
+	rows, err := s.db.Query(ctx, `
+	select kind, owner_id, left(token, $4), expire, created from (`+tokensSQL+`) t
+	where $3 = '' or left(token, length($3)) = $3
+	order by created desc`, filter.ManagerID, filter.CustomerID, filter.Prefix, TokenPrefixLength)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("tokens", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &TokenInfo{}
+		if err = rows.Scan(&item.Kind, &item.OwnerID, &item.Prefix, &item.Expire, &item.Created); err != nil {
+			logging.Ctx(ctx, s.logger).Error("tokens", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("tokens", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// RevokeTokens deletes the tokens matching the filter, a filter must select something,
+// a prefix must be at least TokenPrefixLength long
+func (s *Service) RevokeTokens(ctx context.Context, filter *TokenFilter) (int64, error) {
+	ctx, span := tracer.Start(ctx, "managers.RevokeTokens")
+	defer span.End()
+
+	if filter.ManagerID == 0 && filter.CustomerID == 0 && len(filter.Prefix) < TokenPrefixLength {
+		return 0, ErrTokenNotFound
+	}
+
+	var count int64
+	err := s.db.QueryRow(ctx, `
+	with m as (
+		delete from managers_tokens
+		where ($1::bigint = 0 or manager_id = $1) and $2::bigint = 0 and ($3 = '' or left(token, length($3)) = $3)
+		returning 1
+	), c as (
+		delete from customers_tokens
+		where ($2::bigint = 0 or customer_id = $2) and $1::bigint = 0 and ($3 = '' or left(token, length($3)) = $3)
+		returning 1
+	)
+	select (select count(*) from m) + (select count(*) from c)`, filter.ManagerID, filter.CustomerID, filter.Prefix).Scan(&count)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("revoke tokens", zap.Error(err))
+		return 0, ErrInternal
+	}
+	return count, nil
+}
+
+// PurgeExpiredTokens deletes the expired tokens of managers and customers
+func (s *Service) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "managers.PurgeExpiredTokens")
+	defer span.End()
+
+	var count int64
+	err := s.db.QueryRow(ctx, `
+	with m as (
+		delete from managers_tokens where expire < current_timestamp returning 1
+	), c as (
+		delete from customers_tokens where expire < current_timestamp returning 1
+	)
+	select (select count(*) from m) + (select count(*) from c)`).Scan(&count)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("purge expired tokens", zap.Error(err))
+		return 0, ErrInternal
+	}
+	return count, nil
+}
+
+// SetCustomerActive blocks or unblocks the customer, blocking revokes the tokens of the customer
+func (s *Service) SetCustomerActive(ctx context.Context, customerID int64, active bool) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "managers.SetCustomerActive")
+	defer span.End()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set customer active", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	item := &Customer{}
+	err = tx.QueryRow(ctx, `
+	update customers set active = $2 where id = $1
+	returning id, name, phone, coalesce(group_id, 0), active, created`, customerID, active).
+		Scan(&item.ID, &item.Name, &item.Phone, &item.GroupID, &item.Active, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set customer active", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	if !active {
+		if _, err = tx.Exec(ctx, `delete from customers_tokens where customer_id = $1`, customerID); err != nil {
+			logging.Ctx(ctx, s.logger).Error("set customer active", zap.Error(err))
+			return nil, ErrInternal
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("set customer active", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
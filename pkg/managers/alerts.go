@@ -0,0 +1,91 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Alert is raised when a movement takes the available stock of a product to its reorder threshold,
+// Notified is set once the alert is delivered to the notifiers
+type Alert struct {
+	ID          int64      `json:"id"`
+	ProductID   int64      `json:"product_id"`
+	ProductName string     `json:"product_name"`
+	MovementID  int64      `json:"movement_id"`
+	Threshold   int        `json:"threshold"`
+	Available   int        `json:"available"`
+	Notified    *time.Time `json:"notified"`
+	Created     time.Time  `json:"created"`
+}
+
+// raiseAlert records the alert inside the tx of the movement, it is delivered after the commit
+func (s *Service) raiseAlert(ctx context.Context, tx pgx.Tx, movement *Movement, threshold int, available int) error {
+	_, err := tx.Exec(ctx, `
+	insert into stock_alerts (product_id, movement_id, threshold, available) values ($1, $2, $3, $4)`,
+		movement.ProductID, movement.ID, threshold, available)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("raise alert", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// Alerts returns the newest stock alerts, only the undelivered ones oldest first when pending
+func (s *Service) Alerts(ctx context.Context, pending bool) ([]*Alert, error) {
+	ctx, span := tracer.Start(ctx, "managers.Alerts")
+	defer span.End()
+
+	items := make([]*Alert, 0)
+
+	sqlstmt := `
+	select a.id, a.product_id, p.name, coalesce(a.movement_id, 0), a.threshold, a.available, a.notified, a.created
+	from stock_alerts a join products p on p.id = a.product_id`
+	if pending {
+		sqlstmt += ` where a.notified is null order by a.id limit 500`
+	} else {
+		sqlstmt += ` order by a.id desc limit 500`
+	}
+	rows, err := s.db.Query(ctx, sqlstmt)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("alerts", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Alert{}
+		err = rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.MovementID, &item.Threshold,
+			&item.Available, &item.Notified, &item.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("alerts", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("alerts", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return items, nil
+}
+
+// MarkAlertNotified records the delivery of the alert
+func (s *Service) MarkAlertNotified(ctx context.Context, id int64) error {
+	ctx, span := tracer.Start(ctx, "managers.MarkAlertNotified")
+	defer span.End()
+
+	tag, err := s.db.Exec(ctx, `update stock_alerts set notified = current_timestamp where id = $1 and notified is null`, id)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("mark alert notified", zap.Error(err))
+		return ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/bulk"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"github.com/shodikhuja83/crud/pkg/outbox"
+	"go.uber.org/zap"
+)
+
+// columns of the files of products and customers, price is in major units of the currency and is required
+// with a currency other than the one of the product
+var (
+	ProductColumns  = []string{"sku", "name", "price", "currency", "qty", "category_id", "reorder_threshold", "active"}
+	CustomerColumns = []string{"phone", "name", "email", "address", "group_id", "active"}
+)
+
+// an import stops collecting errors after MaxImportErrors
+const MaxImportErrors = 100
+
+var errRequired = errors.New("required")
+
+// ImportError is a rejected row, Column is empty when the whole row is rejected
+type ImportError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ImportResult of an import, the rows are committed only when there is no error and it is not a dry run
+type ImportResult struct {
+	DryRun    bool           `json:"dry_run"`
+	Committed bool           `json:"committed"`
+	Rows      int            `json:"rows"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Errors    []*ImportError `json:"errors"`
+}
+
+// ImportProducts upserts the products by sku in one tx, a column missing from the file or an empty value
+// keeps the value of an existing product. Changes of qty are posted to the stock ledger as adjustments.
+func (s *Service) ImportProducts(ctx context.Context, reader bulk.Reader, dryRun bool) (*ImportResult, error) {
+	ctx, span := tracer.Start(ctx, "managers.ImportProducts")
+	defer span.End()
+
+	return s.importRows(ctx, reader, dryRun, s.importProduct)
+}
+
+// ImportCustomers upserts the customers by phone in one tx like ImportProducts,
+// imported customers have no password until they reset it
+func (s *Service) ImportCustomers(ctx context.Context, reader bulk.Reader, dryRun bool) (*ImportResult, error) {
+	ctx, span := tracer.Start(ctx, "managers.ImportCustomers")
+	defer span.End()
+
+	return s.importRows(ctx, reader, dryRun, s.importCustomer)
+}
+
+// importRow saves a record inside tx and reports whether it created a row
+type importRow func(ctx context.Context, tx pgx.Tx, record *bulk.Record) (created bool, column string, err error)
+
+// importRows runs every record in a savepoint, so a rejected one doesn't abort the tx and the next records are still checked
+func (s *Service) importRows(ctx context.Context, reader bulk.Reader, dryRun bool, save importRow) (*ImportResult, error) {
+	result := &ImportResult{DryRun: dryRun, Errors: make([]*ImportError, 0)}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("import", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	for len(result.Errors) < MaxImportErrors {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the file can't be read past a syntax error
+			result.Errors = append(result.Errors, &ImportError{Row: result.Rows + 1, Error: err.Error()})
+			break
+		}
+		result.Rows++
+
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("import", zap.Error(err))
+			return nil, ErrInternal
+		}
+		created, column, err := save(ctx, savepoint, record)
+		if err == ErrInternal {
+			return nil, err
+		}
+		if err != nil {
+			_ = savepoint.Rollback(ctx)
+			result.Errors = append(result.Errors, &ImportError{Row: record.Row, Column: column, Error: err.Error()})
+			continue
+		}
+		if err = savepoint.Commit(ctx); err != nil {
+			logging.Ctx(ctx, s.logger).Error("import", zap.Error(err))
+			return nil, ErrInternal
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+
+	if dryRun || len(result.Errors) != 0 {
+		return result, nil
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("import", zap.Error(err))
+		return nil, ErrInternal
+	}
+	result.Committed = true
+	return result, nil
+}
+
+func (s *Service) importProduct(ctx context.Context, tx pgx.Tx, record *bulk.Record) (bool, string, error) {
+	if !record.Has("sku") {
+		return false, "sku", errRequired
+	}
+	product := &Product{SKU: record.Values["sku"]}
+	active := true
+
+	err := tx.QueryRow(ctx, `
+	select id, name, price, currency, qty, coalesce(category_id, 0), reorder_threshold, active
+	from products where sku = $1 for update`, product.SKU).
+		Scan(&product.ID, &product.Name, &product.Price.Amount, &product.Price.Currency, &product.Qty,
+			&product.CategoryID, &product.ReorderThreshold, &active)
+	if err != nil && err != pgx.ErrNoRows {
+		logging.Ctx(ctx, s.logger).Error("import product", zap.Error(err))
+		return false, "", ErrInternal
+	}
+	created := product.ID == 0
+	if created {
+		for _, column := range []string{"name", "price", "currency"} {
+			if !record.Has(column) {
+				return false, column, errRequired
+			}
+		}
+	}
+
+	if record.Has("name") {
+		product.Name = record.Values["name"]
+	}
+	if record.Has("currency") {
+		currency, err := money.NormalizeCurrency(record.Values["currency"])
+		if err != nil {
+			return false, "currency", err
+		}
+		// the amount is in minor units of the old currency, relabelling it would change the price
+		if currency != product.Price.Currency && !record.Has("price") {
+			return false, "price", errRequired
+		}
+		product.Price.Currency = currency
+	}
+	if record.Has("price") {
+		price, err := money.Parse(record.Values["price"], product.Price.Currency)
+		if err != nil {
+			return false, "price", err
+		}
+		product.Price = price
+	}
+	if record.Has("qty") {
+		if product.Qty, err = strconv.Atoi(record.Values["qty"]); err != nil {
+			return false, "qty", strconv.ErrSyntax
+		}
+	}
+	if record.Has("category_id") {
+		if product.CategoryID, err = strconv.ParseInt(record.Values["category_id"], 10, 64); err != nil {
+			return false, "category_id", strconv.ErrSyntax
+		}
+	}
+	if record.Has("reorder_threshold") {
+		threshold, err := strconv.Atoi(record.Values["reorder_threshold"])
+		if err != nil {
+			return false, "reorder_threshold", strconv.ErrSyntax
+		}
+		product.ReorderThreshold = &threshold
+	}
+	if record.Has("active") {
+		if active, err = strconv.ParseBool(record.Values["active"]); err != nil {
+			return false, "active", strconv.ErrSyntax
+		}
+	}
+
+	// saveProduct doesn't change the active flag, it is set first so the saved event carries it
+	if !created {
+		if err = s.setProductActive(ctx, tx, product.ID, active); err != nil {
+			return false, "", err
+		}
+	}
+	if err = s.saveProduct(ctx, tx, product); err != nil {
+		return false, "", err
+	}
+	if created && !active {
+		if err = s.setProductActive(ctx, tx, product.ID, active); err != nil {
+			return false, "", err
+		}
+	}
+	return created, "", nil
+}
+
+func (s *Service) setProductActive(ctx context.Context, tx pgx.Tx, id int64, active bool) error {
+	if _, err := tx.Exec(ctx, `update products set active = $2 where id = $1`, id, active); err != nil {
+		logging.Ctx(ctx, s.logger).Error("import product", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+func (s *Service) importCustomer(ctx context.Context, tx pgx.Tx, record *bulk.Record) (bool, string, error) {
+	if !record.Has("phone") {
+		return false, "phone", errRequired
+	}
+	customer := &Customer{Phone: record.Values["phone"], Active: true}
+
+	err := tx.QueryRow(ctx, `
+	select id, name, email, address, coalesce(group_id, 0), active from customers where phone = $1 for update`,
+		customer.Phone).Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Address, &customer.GroupID, &customer.Active)
+	if err != nil && err != pgx.ErrNoRows {
+		logging.Ctx(ctx, s.logger).Error("import customer", zap.Error(err))
+		return false, "", ErrInternal
+	}
+	created := customer.ID == 0
+	if created && !record.Has("name") {
+		return false, "name", errRequired
+	}
+
+	if record.Has("name") {
+		customer.Name = record.Values["name"]
+	}
+	if record.Has("email") {
+		if customer.Email, err = normalizeEmail(record.Values["email"]); err != nil {
+			return false, "email", err
+		}
+	}
+	if record.Has("address") {
+		customer.Address = record.Values["address"]
+	}
+	if record.Has("group_id") {
+		if customer.GroupID, err = strconv.ParseInt(record.Values["group_id"], 10, 64); err != nil {
+			return false, "group_id", strconv.ErrSyntax
+		}
+	}
+	if record.Has("active") {
+		if customer.Active, err = strconv.ParseBool(record.Values["active"]); err != nil {
+			return false, "active", strconv.ErrSyntax
+		}
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, `select $1 = 0 or exists(select 1 from customer_groups where id = $1)`, customer.GroupID).Scan(&exists)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("import customer", zap.Error(err))
+		return false, "", ErrInternal
+	}
+	if !exists {
+		return false, "group_id", ErrNotFound
+	}
+
+	if created {
+		// an empty password matches no bcrypt hash, so the customer can't log in with it
+		err = tx.QueryRow(ctx, `
+		insert into customers (name, phone, password, email, address, group_id, active)
+		values ($1, $2, '', $3, $4, nullif($5, 0), $6)
+		returning id, created`, customer.Name, customer.Phone, customer.Email, customer.Address, customer.GroupID, customer.Active).
+			Scan(&customer.ID, &customer.Created)
+		if err == nil {
+			err = outbox.Write(ctx, tx, &events.CustomerRegistered{
+				CustomerID: customer.ID, Name: customer.Name, Phone: customer.Phone, Created: customer.Created,
+			})
+		}
+	} else {
+		_, err = tx.Exec(ctx, `
+		update customers set name = $2, email = $3, address = $4, group_id = nullif($5, 0), active = $6 where id = $1`,
+			customer.ID, customer.Name, customer.Email, customer.Address, customer.GroupID, customer.Active)
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("import customer", zap.Error(err))
+		return false, "", ErrInternal
+	}
+	return created, "", nil
+}
+
+// ExportProducts streams every product, inactive ones included, to write in the order of ProductColumns
+func (s *Service) ExportProducts(ctx context.Context, write func(values []string) error) error {
+	ctx, span := tracer.Start(ctx, "managers.ExportProducts")
+	defer span.End()
+
+	rows, err := s.db.Query(ctx, `
+	select coalesce(sku, ''), name, price, currency, qty, coalesce(category_id, 0), reorder_threshold, active
+	from products order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("export products", zap.Error(err))
+		return ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Product{}
+		err = rows.Scan(&item.SKU, &item.Name, &item.Price.Amount, &item.Price.Currency, &item.Qty, &item.CategoryID,
+			&item.ReorderThreshold, &item.Active)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("export products", zap.Error(err))
+			return ErrInternal
+		}
+
+		threshold := ""
+		if item.ReorderThreshold != nil {
+			threshold = strconv.Itoa(*item.ReorderThreshold)
+		}
+		err = write([]string{item.SKU, item.Name, item.Price.Decimal(), item.Price.Currency, strconv.Itoa(item.Qty),
+			formatID(item.CategoryID), threshold, strconv.FormatBool(item.Active)})
+		if err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("export products", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// ExportCustomers streams every customer to write in the order of CustomerColumns
+func (s *Service) ExportCustomers(ctx context.Context, write func(values []string) error) error {
+	ctx, span := tracer.Start(ctx, "managers.ExportCustomers")
+	defer span.End()
+
+	rows, err := s.db.Query(ctx, `select phone, name, email, address, coalesce(group_id, 0), active from customers order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("export customers", zap.Error(err))
+		return ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Customer{}
+		if err = rows.Scan(&item.Phone, &item.Name, &item.Email, &item.Address, &item.GroupID, &item.Active); err != nil {
+			logging.Ctx(ctx, s.logger).Error("export customers", zap.Error(err))
+			return ErrInternal
+		}
+		err = write([]string{item.Phone, item.Name, item.Email, item.Address, formatID(item.GroupID), strconv.FormatBool(item.Active)})
+		if err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("export customers", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// formatID leaves an unset reference empty
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
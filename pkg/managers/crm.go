@@ -0,0 +1,374 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// limits of the notes and the tags of a customer
+const (
+	MaxNoteLength   = 4000
+	MaxTagLength    = 32
+	MaxCustomerTags = 20
+	// TimelineLimit is the length of a page of the timeline
+	TimelineLimit = 100
+)
+
+// kinds of the entries of the timeline of a customer
+const (
+	TimelineNote = "note"
+	TimelineSale = "sale"
+)
+
+var (
+	//ErrInvalidEmail ...
+	ErrInvalidEmail = errors.New("invalid email")
+	//ErrInvalidNote ...
+	ErrInvalidNote = errors.New("invalid note")
+	//ErrInvalidTag ...
+	ErrInvalidTag = errors.New("invalid tag")
+)
+
+// CustomerNote is a note of a manager about a customer
+type CustomerNote struct {
+	ID         int64     `json:"id"`
+	CustomerID int64     `json:"customer_id"`
+	ManagerID  int64     `json:"manager_id"`
+	Manager    string    `json:"manager"`
+	Text       string    `json:"text"`
+	Created    time.Time `json:"created"`
+}
+
+// CustomerTags is the set of the tags of a customer
+type CustomerTags struct {
+	Tags []string `json:"tags"`
+}
+
+// TagCount is a tag with the number of the customers having it
+type TagCount struct {
+	Tag       string `json:"tag"`
+	Customers int64  `json:"customers"`
+}
+
+// TimelineEntry is a note or a sale of a customer. ID is the one of the note or the sale,
+// Text is set for notes and Gross for sales.
+type TimelineEntry struct {
+	Kind      string       `json:"kind"`
+	ID        int64        `json:"id"`
+	ManagerID int64        `json:"manager_id"`
+	Manager   string       `json:"manager"`
+	Text      string       `json:"text,omitempty"`
+	Gross     *money.Money `json:"gross,omitempty"`
+	Created   time.Time    `json:"created"`
+}
+
+// TimelineCursor is the last entry of a page of the timeline, the next page starts after it
+type TimelineCursor struct {
+	Created time.Time
+	Kind    string
+	ID      int64
+}
+
+// Cursor returns the cursor of the page after the entry
+func (e *TimelineEntry) Cursor() *TimelineCursor {
+	return &TimelineCursor{Created: e.Created, Kind: e.Kind, ID: e.ID}
+}
+
+// tagsSQL returns the sorted tags of the customer of the table alias as a text array
+func tagsSQL(alias string) string {
+	return fmt.Sprintf(`array(select tag from customer_tags where customer_id = %s.id order by tag)`, alias)
+}
+
+// normalizeEmail trims the email, empty is valid and means no email
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// normalizeTags trims and lowercases the tags, and returns them sorted without duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, ErrInvalidTag
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// customerExists returns ErrNotFound if there is no customer with the id
+func (s *Service) customerExists(ctx context.Context, tx pgx.Tx, customerID int64) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `select exists(select 1 from customers where id = $1)`, customerID).Scan(&exists)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer exists", zap.Error(err))
+		return ErrInternal
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CustomerNotes returns the notes about the customer, newest first
+func (s *Service) CustomerNotes(ctx context.Context, customerID int64) ([]*CustomerNote, error) {
+	ctx, span := tracer.Start(ctx, "managers.CustomerNotes")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer notes", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = s.customerExists(ctx, tx, customerID); err != nil {
+		return nil, err
+	}
+
+	items := make([]*CustomerNote, 0)
+	rows, err := tx.Query(ctx, `
+	select n.id, n.customer_id, n.manager_id, m.name, n.text, n.created
+	from customer_notes n join managers m on m.id = n.manager_id
+	where n.customer_id = $1
+	order by n.created desc, n.id desc`, customerID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer notes", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &CustomerNote{}
+		if err = rows.Scan(&item.ID, &item.CustomerID, &item.ManagerID, &item.Manager, &item.Text, &item.Created); err != nil {
+			logging.Ctx(ctx, s.logger).Error("customer notes", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer notes", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// AddCustomerNote saves the note of the manager about the customer
+func (s *Service) AddCustomerNote(ctx context.Context, managerID int64, customerID int64, text string) (*CustomerNote, error) {
+	ctx, span := tracer.Start(ctx, "managers.AddCustomerNote")
+	defer span.End()
+
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > MaxNoteLength {
+		return nil, ErrInvalidNote
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add customer note", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = s.customerExists(ctx, tx, customerID); err != nil {
+		return nil, err
+	}
+
+	item := &CustomerNote{CustomerID: customerID, ManagerID: managerID, Text: text}
+	err = tx.QueryRow(ctx, `
+	with note as (
+		insert into customer_notes (customer_id, manager_id, text) values ($1, $2, $3) returning id, created
+	)
+	select note.id, m.name, note.created from note, managers m where m.id = $2`, customerID, managerID, text).
+		Scan(&item.ID, &item.Manager, &item.Created)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add customer note", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("add customer note", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// SetCustomerTags replaces the tags of the customer, and returns them normalized
+func (s *Service) SetCustomerTags(ctx context.Context, customerID int64, tags []string) (*CustomerTags, error) {
+	ctx, span := tracer.Start(ctx, "managers.SetCustomerTags")
+	defer span.End()
+
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > MaxCustomerTags {
+		return nil, ErrInvalidTag
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set customer tags", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	// the row lock of the customer orders concurrent changes of its tags
+	var id int64
+	err = tx.QueryRow(ctx, `select id from customers where id = $1 for update`, customerID).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set customer tags", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	_, err = tx.Exec(ctx, `delete from customer_tags where customer_id = $1 and tag <> all($2::text[])`, customerID, tags)
+	if err == nil {
+		_, err = tx.Exec(ctx, `
+		insert into customer_tags (customer_id, tag) select $1, unnest($2::text[])
+		on conflict do nothing`, customerID, tags)
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set customer tags", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("set customer tags", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return &CustomerTags{Tags: tags}, nil
+}
+
+// Tags returns every tag in use with the number of its customers
+func (s *Service) Tags(ctx context.Context) ([]*TagCount, error) {
+	ctx, span := tracer.Start(ctx, "managers.Tags")
+	defer span.End()
+
+	items := make([]*TagCount, 0)
+	rows, err := s.db.Query(ctx, `select tag, count(*) from customer_tags group by tag order by tag`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("tags", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &TagCount{}
+		if err = rows.Scan(&item.Tag, &item.Customers); err != nil {
+			logging.Ctx(ctx, s.logger).Error("tags", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("tags", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// CustomerTimeline returns the notes and the sales of the customer newest first, a page of TimelineLimit
+// entries after the cursor, nil before means from now. The gross of a sale is less its returns.
+func (s *Service) CustomerTimeline(ctx context.Context, customerID int64, before *TimelineCursor) ([]*TimelineEntry, error) {
+	ctx, span := tracer.Start(ctx, "managers.CustomerTimeline")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer timeline", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = s.customerExists(ctx, tx, customerID); err != nil {
+		return nil, err
+	}
+
+	// entries are paged on (created, kind, id), so the ones sharing a time with the cursor are not skipped
+	var created *time.Time
+	var kind string
+	var id int64
+	if before != nil {
+		created, kind, id = &before.Created, before.Kind, before.ID
+	}
+
+	// a sale is in one currency, priceSale rejects mixed ones, so g has a row at most
+	items := make([]*TimelineEntry, 0)
+	rows, err := tx.Query(ctx, `
+	select * from (
+		select '`+TimelineNote+`' kind, n.id, n.manager_id, m.name, n.text, '' currency, 0::bigint gross, n.created
+		from customer_notes n join managers m on m.id = n.manager_id
+		where n.customer_id = $1 and ($2::timestamp is null or n.created <= $2)
+		union all
+		select '`+TimelineSale+`', s.id, s.manager_id, m.name, '', g.currency, coalesce(g.gross, 0)::bigint, s.created
+		from sales s
+		join managers m on m.id = s.manager_id
+		left join lateral (
+			select sp.currency, sum(sp.gross - coalesce(r.gross, 0)) gross
+			from sales_positions sp
+			left join lateral (
+				select sum(gross) gross from sales_returns_positions where sale_position_id = sp.id
+			) r on true
+			where sp.sale_id = s.id
+			group by sp.currency
+		) g on true
+		where s.customer_id = $1 and ($2::timestamp is null or s.created <= $2)
+	) t
+	where $2::timestamp is null or (created, kind, id) < ($2, $3, $4)
+	order by created desc, kind desc, id desc
+	limit $5`, customerID, created, kind, id, TimelineLimit)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer timeline", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &TimelineEntry{}
+		var currency *string
+		var gross int64
+		err = rows.Scan(&item.Kind, &item.ID, &item.ManagerID, &item.Manager, &item.Text, &currency, &gross, &item.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("customer timeline", zap.Error(err))
+			return nil, ErrInternal
+		}
+		if item.Kind == TimelineSale && currency != nil {
+			amount := money.New(gross, *currency)
+			item.Gross = &amount
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer timeline", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
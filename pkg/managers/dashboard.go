@@ -0,0 +1,243 @@
+package managers
+
+import (
+	"context"
+
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// DashboardTop is the length of the top lists of the dashboard per currency
+const DashboardTop = 10
+
+// Dashboard is the overview of the shop for admins. Weeks start on monday, the top lists
+// cover the current month and are ranked per currency, and the amounts are gross in minor units per currency.
+type Dashboard struct {
+	Revenue      []*Revenue     `json:"revenue"`
+	TopByRevenue []*TopProduct  `json:"top_products_by_revenue"`
+	TopByUnits   []*TopProduct  `json:"top_products_by_units"`
+	TopCustomers []*TopCustomer `json:"top_customers"`
+	NewCustomers *PeriodCounts  `json:"new_customers"`
+	StockValue   []money.Money  `json:"stock_value"`
+}
+
+// Revenue in one currency less the returns, the average basket is of the sales of the month
+type Revenue struct {
+	Currency      string      `json:"currency"`
+	Today         money.Money `json:"today"`
+	Week          money.Money `json:"week"`
+	Month         money.Money `json:"month"`
+	Sales         int64       `json:"sales"`
+	AverageBasket money.Money `json:"average_basket"`
+	AverageItems  float64     `json:"average_items"`
+}
+
+// TopProduct is a product by its sales in one currency, ranked among the products sold in it,
+// returns are not subtracted
+type TopProduct struct {
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Units     int64       `json:"units"`
+	Gross     money.Money `json:"gross"`
+}
+
+// TopCustomer is a customer by the gross of their sales in one currency, ranked among the customers paying in it
+type TopCustomer struct {
+	CustomerID int64       `json:"customer_id"`
+	Name       string      `json:"name"`
+	Sales      int64       `json:"sales"`
+	Gross      money.Money `json:"gross"`
+}
+
+// PeriodCounts ...
+type PeriodCounts struct {
+	Today int64 `json:"today"`
+	Week  int64 `json:"week"`
+	Month int64 `json:"month"`
+}
+
+// revenue of the days before yesterday is read from sales_daily, which the refresh-report-aggregates job
+// keeps up to date, yesterday and today are summed from the positions, as the view misses the last minutes
+// of yesterday until its first refresh after midnight
+const revenueSQL = `
+	with bounds as (
+		select current_date today, date_trunc('week', current_date)::date week, date_trunc('month', current_date)::date month
+	), days as (
+		select d.day, d.currency, d.sales, d.items, d.gross
+		from sales_daily d, bounds b
+		where d.day >= least(b.week, b.month) and d.day < b.today - 1
+		union all
+		select s.created::date, sp.currency, count(distinct s.id), sum(sp.qty), sum(sp.gross)
+		from sales s join sales_positions sp on sp.sale_id = s.id
+		where s.created >= current_date - 1
+		group by s.created::date, sp.currency
+		union all
+		select r.created::date, rp.currency, 0, -sum(rp.qty), -sum(rp.gross)
+		from sales_returns r join sales_returns_positions rp on rp.return_id = r.id
+		where r.created >= current_date - 1
+		group by r.created::date, rp.currency
+	)
+	select d.currency,
+		coalesce(sum(d.gross) filter (where d.day = b.today), 0)::bigint,
+		coalesce(sum(d.gross) filter (where d.day >= b.week), 0)::bigint,
+		coalesce(sum(d.gross) filter (where d.day >= b.month), 0)::bigint,
+		coalesce(sum(d.sales) filter (where d.day >= b.month), 0)::bigint,
+		coalesce(sum(d.items) filter (where d.day >= b.month), 0)::bigint
+	from days d, bounds b
+	group by d.currency
+	order by d.currency`
+
+const topProductsSQL = `
+	select p.id, p.name, sp.currency, sum(sp.qty)::bigint units, sum(sp.gross)::bigint gross
+	from sales s
+	join sales_positions sp on sp.sale_id = s.id
+	join products p on p.id = sp.product_id
+	where s.created >= date_trunc('month', current_date)
+	group by p.id, p.name, sp.currency`
+
+// Dashboard computes the overview
+func (s *Service) Dashboard(ctx context.Context) (*Dashboard, error) {
+	ctx, span := tracer.Start(ctx, "managers.Dashboard")
+	defer span.End()
+
+	dashboard := &Dashboard{
+		Revenue:      make([]*Revenue, 0),
+		TopCustomers: make([]*TopCustomer, 0),
+		NewCustomers: &PeriodCounts{},
+		StockValue:   make([]money.Money, 0),
+	}
+
+	rows, err := s.db.Query(ctx, revenueSQL)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+	for rows.Next() {
+		item := &Revenue{}
+		var today, week, month, items int64
+		if err = rows.Scan(&item.Currency, &today, &week, &month, &item.Sales, &items); err != nil {
+			rows.Close()
+			logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+			return nil, ErrInternal
+		}
+		item.Today, item.Week, item.Month = money.New(today, item.Currency), money.New(week, item.Currency), money.New(month, item.Currency)
+		item.AverageBasket = money.New(0, item.Currency)
+		if item.Sales > 0 {
+			item.AverageBasket.Amount = month / item.Sales
+			item.AverageItems = float64(items) / float64(item.Sales)
+		}
+		dashboard.Revenue = append(dashboard.Revenue, item)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	if dashboard.TopByRevenue, err = s.topProducts(ctx, "gross"); err != nil {
+		return nil, err
+	}
+	if dashboard.TopByUnits, err = s.topProducts(ctx, "units"); err != nil {
+		return nil, err
+	}
+
+	// minor units of different currencies don't compare, so the customers are ranked per currency
+	rows, err = s.db.Query(ctx, `
+	select id, name, currency, sales, gross from (
+		select c.id, c.name, sp.currency, count(distinct s.id) sales, sum(sp.gross)::bigint gross,
+			row_number() over (partition by sp.currency order by sum(sp.gross) desc, c.id) rank
+		from sales s
+		join sales_positions sp on sp.sale_id = s.id
+		join customers c on c.id = s.customer_id
+		where s.created >= date_trunc('month', current_date)
+		group by c.id, c.name, sp.currency
+	) t
+	where rank <= $1
+	order by currency, rank`, DashboardTop)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+	for rows.Next() {
+		item := &TopCustomer{}
+		if err = rows.Scan(&item.CustomerID, &item.Name, &item.Gross.Currency, &item.Sales, &item.Gross.Amount); err != nil {
+			rows.Close()
+			logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+			return nil, ErrInternal
+		}
+		dashboard.TopCustomers = append(dashboard.TopCustomers, item)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	err = s.db.QueryRow(ctx, `
+	select count(*) filter (where created >= current_date),
+		count(*) filter (where created >= date_trunc('week', current_date)),
+		count(*) filter (where created >= date_trunc('month', current_date))
+	from customers
+	where created >= least(date_trunc('week', current_date), date_trunc('month', current_date))`).
+		Scan(&dashboard.NewCustomers.Today, &dashboard.NewCustomers.Week, &dashboard.NewCustomers.Month)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	// the stock is valued at the list prices of the active products
+	rows, err = s.db.Query(ctx, `
+	select currency, sum(qty::bigint * price)::bigint from products where active and qty > 0 group by currency order by currency`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := money.Money{}
+		if err = rows.Scan(&item.Currency, &item.Amount); err != nil {
+			logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+			return nil, ErrInternal
+		}
+		dashboard.StockValue = append(dashboard.StockValue, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return dashboard, nil
+}
+
+// topProducts returns the products of the month with the most gross or units per currency
+func (s *Service) topProducts(ctx context.Context, by string) ([]*TopProduct, error) {
+	items := make([]*TopProduct, 0)
+	rows, err := s.db.Query(ctx, `
+	select id, name, currency, units, gross from (
+		select t.*, row_number() over (partition by currency order by `+by+` desc, id) rank
+		from (`+topProductsSQL+`) t
+	) r
+	where rank <= $1
+	order by currency, rank`, DashboardTop)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &TopProduct{}
+		err = rows.Scan(&item.ProductID, &item.Name, &item.Gross.Currency, &item.Units, &item.Gross.Amount)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("dashboard", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
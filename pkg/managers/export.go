@@ -0,0 +1,95 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// SaleLineColumns are the columns of the export of sales, a row per position.
+// Amounts are in major units of the currency, the tax rate in percent.
+var SaleLineColumns = []string{
+	"sale_id", "created", "manager_id", "manager", "customer_id", "customer", "customer_phone", "promo_code",
+	"position_id", "product_id", "sku", "product", "qty", "currency", "base_price", "discount", "price",
+	"tax_rate", "net", "tax", "gross",
+}
+
+// TextColumns of the exports hold phones and codes, which stay text in a worksheet even when they look like numbers
+var TextColumns = []string{"sku", "phone", "customer_phone", "promo_code"}
+
+// ExportSales streams the positions of every sale matching the manager, the customer and the period of the filter
+// to write in the order of SaleLineColumns, only the positions of the product when the filter has one. The rows are read in one repeatable read snapshot,
+// so a sale made during the export is either complete in it or missing.
+func (s *Service) ExportSales(ctx context.Context, filter *SalesFilter, write func(values []string) error) error {
+	ctx, span := tracer.Start(ctx, "managers.ExportSales")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("export sales", zap.Error(err))
+		return ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	select s.id, s.created, s.manager_id, m.name, s.customer_id, coalesce(c.name, ''), coalesce(c.phone, ''),
+		coalesce(pc.code, ''), sp.id, sp.product_id, coalesce(p.sku, ''), p.name, sp.qty, sp.currency,
+		sp.base_price, sp.discount, sp.price, sp.tax_rate, sp.net, sp.tax, sp.gross
+	from sales s
+	join sales_positions sp on sp.sale_id = s.id
+	join products p on p.id = sp.product_id
+	join managers m on m.id = s.manager_id
+	left join customers c on c.id = s.customer_id
+	left join promo_codes pc on pc.id = s.promo_code_id
+	where ($1::bigint = 0 or s.manager_id = $1)
+		and ($2::timestamp is null or s.created >= $2)
+		and ($3::timestamp is null or s.created < $3)
+		and ($4::bigint = 0 or s.customer_id = $4)
+		and ($5::bigint = 0 or sp.product_id = $5)
+	order by s.id, sp.id`, filter.ManagerID, filter.From, filter.To, filter.CustomerID, filter.ProductID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("export sales", zap.Error(err))
+		return ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var saleID, managerID, customerID, positionID, productID, taxRate int64
+		var created time.Time
+		var manager, customer, phone, promoCode, sku, product, currency string
+		var qty int
+		var basePrice, discount, price, net, tax, gross int64
+		err = rows.Scan(&saleID, &created, &managerID, &manager, &customerID, &customer, &phone, &promoCode,
+			&positionID, &productID, &sku, &product, &qty, &currency, &basePrice, &discount, &price, &taxRate,
+			&net, &tax, &gross)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("export sales", zap.Error(err))
+			return ErrInternal
+		}
+
+		amount := func(value int64) string {
+			return money.New(value, currency).Decimal()
+		}
+		err = write([]string{
+			strconv.FormatInt(saleID, 10), created.Format(time.RFC3339), strconv.FormatInt(managerID, 10), manager,
+			formatID(customerID), customer, phone, promoCode,
+			strconv.FormatInt(positionID, 10), strconv.FormatInt(productID, 10), sku, product, strconv.Itoa(qty), currency,
+			amount(basePrice), amount(discount), amount(price),
+			fmt.Sprintf("%d.%02d", taxRate/100, taxRate%100), amount(net), amount(tax), amount(gross),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("export sales", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
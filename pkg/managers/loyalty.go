@@ -0,0 +1,455 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// kinds of the entries of the loyalty ledger
+const (
+	LoyaltyEarn   = "earn"
+	LoyaltyRedeem = "redeem"
+	LoyaltyAdjust = "adjust"
+	// LoyaltyReverse takes back the share of the earned points of a returned sale
+	LoyaltyReverse = "reverse"
+	// LoyaltyRefund gives back the share of the redeemed points of a returned sale
+	LoyaltyRefund = "refund"
+)
+
+// limits of the rules and of the points of one sale or adjustment, balances are stored as integers
+const (
+	MaxRulePoints  = 10000
+	MaxRuleSpend   = 1000000000000
+	MaxEntryPoints = 1000000
+)
+
+var (
+	//ErrInvalidLoyaltyRule ...
+	ErrInvalidLoyaltyRule = errors.New("invalid loyalty rule")
+	//ErrNotEnoughPoints ...
+	ErrNotEnoughPoints = errors.New("not enough loyalty points")
+	//ErrInvalidRedemption ...
+	ErrInvalidRedemption = errors.New("loyalty points can't be redeemed on the sale")
+	//ErrInvalidAdjustment ...
+	ErrInvalidAdjustment = errors.New("adjustment needs points and a reason")
+)
+
+// LoyaltyRule earns Points for every Spend (minor units of Currency) of the gross of a sale,
+// a redeemed point is worth PointValue. Zero GroupID means every customer.
+type LoyaltyRule struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Currency   string    `json:"currency"`
+	GroupID    int64     `json:"group_id"`
+	Spend      int64     `json:"spend"`
+	Points     int       `json:"points"`
+	PointValue int64     `json:"point_value"`
+	Active     bool      `json:"active"`
+	Created    time.Time `json:"created"`
+}
+
+// LoyaltyEntry of the ledger of a customer, Balance is the one after the entry
+type LoyaltyEntry struct {
+	ID         int64     `json:"id"`
+	CustomerID int64     `json:"customer_id"`
+	Kind       string    `json:"kind"`
+	Points     int       `json:"points"`
+	Balance    int       `json:"balance"`
+	SaleID     int64     `json:"sale_id"`
+	ManagerID  int64     `json:"manager_id"`
+	Reason     string    `json:"reason"`
+	Created    time.Time `json:"created"`
+}
+
+// PointsAdjustment is a manual change of the balance, negative points are taken off
+type PointsAdjustment struct {
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// Loyalty is the balance of a customer with the newest entries of the ledger
+type Loyalty struct {
+	CustomerID int64           `json:"customer_id"`
+	Balance    int             `json:"balance"`
+	History    []*LoyaltyEntry `json:"history"`
+}
+
+// LoyaltyRules ...
+func (s *Service) LoyaltyRules(ctx context.Context) ([]*LoyaltyRule, error) {
+	ctx, span := tracer.Start(ctx, "managers.LoyaltyRules")
+	defer span.End()
+
+	items := make([]*LoyaltyRule, 0)
+	rows, err := s.db.Query(ctx, `
+	select id, name, currency, coalesce(group_id, 0), spend, points, point_value, active, created
+	from loyalty_rules order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty rules", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &LoyaltyRule{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Currency, &item.GroupID, &item.Spend, &item.Points, &item.PointValue,
+			&item.Active, &item.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("loyalty rules", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty rules", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SaveLoyaltyRule creates the rule when its ID is 0, changes it otherwise
+func (s *Service) SaveLoyaltyRule(ctx context.Context, item *LoyaltyRule) (*LoyaltyRule, error) {
+	ctx, span := tracer.Start(ctx, "managers.SaveLoyaltyRule")
+	defer span.End()
+
+	var err error
+	item.Name = strings.TrimSpace(item.Name)
+	if item.Currency, err = money.NormalizeCurrency(item.Currency); err != nil {
+		return nil, err
+	}
+	if item.Name == "" || item.Spend <= 0 || item.Spend > MaxRuleSpend || item.Points <= 0 || item.Points > MaxRulePoints ||
+		item.PointValue <= 0 {
+		return nil, ErrInvalidLoyaltyRule
+	}
+
+	if item.ID == 0 {
+		err = s.db.QueryRow(ctx, `
+		insert into loyalty_rules (name, currency, group_id, spend, points, point_value, active)
+		values ($1, $2, nullif($3, 0), $4, $5, $6, $7) returning id, created`,
+			item.Name, item.Currency, item.GroupID, item.Spend, item.Points, item.PointValue, item.Active).
+			Scan(&item.ID, &item.Created)
+	} else {
+		err = s.db.QueryRow(ctx, `
+		update loyalty_rules set name = $2, currency = $3, group_id = nullif($4, 0), spend = $5, points = $6,
+			point_value = $7, active = $8
+		where id = $1 returning created`,
+			item.ID, item.Name, item.Currency, item.GroupID, item.Spend, item.Points, item.PointValue, item.Active).
+			Scan(&item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save loyalty rule", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// Loyalty returns the balance of the customer and the newest 100 entries of the ledger
+func (s *Service) Loyalty(ctx context.Context, customerID int64) (*Loyalty, error) {
+	ctx, span := tracer.Start(ctx, "managers.Loyalty")
+	defer span.End()
+
+	item := &Loyalty{CustomerID: customerID, History: make([]*LoyaltyEntry, 0)}
+	err := s.db.QueryRow(ctx, `select loyalty_points from customers where id = $1`, customerID).Scan(&item.Balance)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	rows, err := s.db.Query(ctx, `
+	select id, customer_id, kind, points, balance, coalesce(sale_id, 0), coalesce(manager_id, 0), reason, created
+	from loyalty_ledger where customer_id = $1 order by id desc limit 100`, customerID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &LoyaltyEntry{}
+		err = rows.Scan(&entry.ID, &entry.CustomerID, &entry.Kind, &entry.Points, &entry.Balance, &entry.SaleID,
+			&entry.ManagerID, &entry.Reason, &entry.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+			return nil, ErrInternal
+		}
+		item.History = append(item.History, entry)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// AdjustPoints adds points to the balance of the customer or takes them off when negative
+func (s *Service) AdjustPoints(ctx context.Context, managerID int64, customerID int64, points int, reason string) (*LoyaltyEntry, error) {
+	ctx, span := tracer.Start(ctx, "managers.AdjustPoints")
+	defer span.End()
+
+	reason = strings.TrimSpace(reason)
+	if points == 0 || points > MaxEntryPoints || points < -MaxEntryPoints || reason == "" {
+		return nil, ErrInvalidAdjustment
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("adjust points", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	entry := &LoyaltyEntry{CustomerID: customerID, Kind: LoyaltyAdjust, Points: points, ManagerID: managerID, Reason: reason}
+	if err = s.addPoints(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("adjust points", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return entry, nil
+}
+
+// addPoints changes the balance and writes the entry, the balance can't go below 0
+func (s *Service) addPoints(ctx context.Context, tx pgx.Tx, entry *LoyaltyEntry) error {
+	err := tx.QueryRow(ctx, `
+	update customers set loyalty_points = loyalty_points + $2 where id = $1 and loyalty_points + $2 >= 0
+	returning loyalty_points`, entry.CustomerID, entry.Points).Scan(&entry.Balance)
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err = tx.QueryRow(ctx, `select exists(select 1 from customers where id = $1)`, entry.CustomerID).Scan(&exists); err != nil {
+			logging.Ctx(ctx, s.logger).Error("add points", zap.Error(err))
+			return ErrInternal
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return ErrNotEnoughPoints
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add points", zap.Error(err))
+		return ErrInternal
+	}
+
+	err = tx.QueryRow(ctx, `
+	insert into loyalty_ledger (customer_id, kind, points, balance, sale_id, manager_id, reason)
+	values ($1, $2, $3, $4, nullif($5, 0), nullif($6, 0), $7) returning id, created`,
+		entry.CustomerID, entry.Kind, entry.Points, entry.Balance, entry.SaleID, entry.ManagerID, entry.Reason).
+		Scan(&entry.ID, &entry.Created)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add points", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// loyaltyRule returns the active rule of the currency for the group, nil when there is none
+func (s *Service) loyaltyRule(ctx context.Context, tx pgx.Tx, groupID int64, currency string) (*LoyaltyRule, error) {
+	rule := &LoyaltyRule{}
+	err := tx.QueryRow(ctx, `
+	select id, spend, points, point_value from loyalty_rules
+	where active and currency = $1 and (group_id is null or group_id = $2)
+	order by group_id nulls last, id desc
+	limit 1`, currency, groupID).Scan(&rule.ID, &rule.Spend, &rule.Points, &rule.PointValue)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("loyalty rule", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return rule, nil
+}
+
+// redeemPoints takes up to sale.RedeemPoints worth of points off the prices of the positions, unit by unit,
+// and sets sale.PointsRedeemed to the points it used. A rest of the value smaller than a unit price can't be
+// taken off, the points are rounded up so a customer never gets more than the points are worth.
+func (s *Service) redeemPoints(ctx context.Context, tx pgx.Tx, sale *Sale, groupID int64, currency string) error {
+	sale.PointsRedeemed = 0
+	if sale.RedeemPoints == 0 {
+		return nil
+	}
+	if sale.RedeemPoints < 0 || sale.CustomerID == 0 {
+		return ErrInvalidRedemption
+	}
+
+	rule, err := s.loyaltyRule(ctx, tx, groupID, currency)
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		return ErrInvalidRedemption
+	}
+
+	var balance int
+	err = tx.QueryRow(ctx, `select loyalty_points from customers where id = $1 for update`, sale.CustomerID).Scan(&balance)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidRedemption
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("redeem points", zap.Error(err))
+		return ErrInternal
+	}
+	if balance < sale.RedeemPoints {
+		return ErrNotEnoughPoints
+	}
+
+	value, err := money.New(rule.PointValue, currency).Mul(int64(sale.RedeemPoints))
+	if err != nil {
+		return err
+	}
+	left := value.Amount
+	for _, position := range sale.Positions {
+		if position.Qty <= 0 {
+			return ErrInvalidPosition
+		}
+		off := left / int64(position.Qty)
+		if off > position.Price.Amount {
+			off = position.Price.Amount
+		}
+		position.Discount.Amount += off
+		position.Price.Amount -= off
+		left -= off * int64(position.Qty)
+	}
+
+	used := value.Amount - left
+	sale.PointsRedeemed = int((used + rule.PointValue - 1) / rule.PointValue)
+	return nil
+}
+
+// settlePoints writes the redeemed points of the priced sale and the points it earns to the ledger
+func (s *Service) settlePoints(ctx context.Context, tx pgx.Tx, sale *Sale) error {
+	sale.PointsEarned = 0
+	if sale.CustomerID == 0 {
+		return nil
+	}
+
+	if sale.PointsRedeemed > 0 {
+		entry := &LoyaltyEntry{CustomerID: sale.CustomerID, Kind: LoyaltyRedeem, Points: -sale.PointsRedeemed, SaleID: sale.ID}
+		if err := s.addPoints(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+
+	var groupID int64
+	err := tx.QueryRow(ctx, `select coalesce(group_id, 0) from customers where id = $1`, sale.CustomerID).Scan(&groupID)
+	if err == pgx.ErrNoRows {
+		// a sale to a customer not registered earns nothing
+		return nil
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("settle points", zap.Error(err))
+		return ErrInternal
+	}
+	rule, err := s.loyaltyRule(ctx, tx, groupID, sale.Gross.Currency)
+	if err != nil {
+		return err
+	}
+	if rule != nil {
+		sale.PointsEarned = earnedPoints(sale.Gross.Amount, rule)
+	}
+	if sale.PointsEarned > 0 {
+		entry := &LoyaltyEntry{CustomerID: sale.CustomerID, Kind: LoyaltyEarn, Points: sale.PointsEarned, SaleID: sale.ID}
+		if err = s.addPoints(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `update sales set points_earned = $2, points_redeemed = $3 where id = $1`,
+		sale.ID, sale.PointsEarned, sale.PointsRedeemed)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("settle points", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// earnedPoints returns the points of every whole spend of the gross, at most MaxEntryPoints
+func earnedPoints(gross int64, rule *LoyaltyRule) int {
+	if gross <= 0 || rule.Spend <= 0 || rule.Points <= 0 {
+		return 0
+	}
+	spends := gross / rule.Spend
+	if spends > int64(MaxEntryPoints/rule.Points) {
+		return MaxEntryPoints
+	}
+	return int(spends) * rule.Points
+}
+
+// reversePoints writes the share of the points of the sale that its returns so far account for,
+// less what earlier returns reversed and refunded, so a complete return undoes the points exactly.
+// The share is of the gross, or of the qty when the sale was paid in points only.
+// The reversal is capped at the balance, the points may be spent already.
+func (s *Service) reversePoints(ctx context.Context, tx pgx.Tx, saleID int64, managerID int64) error {
+	var customerID, gross, returnedGross, qty, returnedQty int64
+	var earned, redeemed, reversed, refunded int
+	err := tx.QueryRow(ctx, `
+	select coalesce(s.customer_id, 0), s.points_earned, s.points_redeemed,
+		(select coalesce(sum(gross), 0)::bigint from sales_positions where sale_id = s.id),
+		(select coalesce(sum(qty), 0)::bigint from sales_positions where sale_id = s.id),
+		coalesce(rt.gross, 0)::bigint, coalesce(rt.qty, 0)::bigint,
+		coalesce((select -sum(points) from loyalty_ledger where sale_id = s.id and kind = 'reverse'), 0)::integer,
+		coalesce((select sum(points) from loyalty_ledger where sale_id = s.id and kind = 'refund'), 0)::integer
+	from sales s
+	left join lateral (
+		select sum(rp.gross) gross, sum(rp.qty) qty
+		from sales_returns r join sales_returns_positions rp on rp.return_id = r.id
+		where r.sale_id = s.id
+	) rt on true
+	where s.id = $1`, saleID).
+		Scan(&customerID, &earned, &redeemed, &gross, &qty, &returnedGross, &returnedQty, &reversed, &refunded)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("reverse points", zap.Error(err))
+		return ErrInternal
+	}
+	if customerID == 0 || (earned == 0 && redeemed == 0) {
+		return nil
+	}
+
+	share := func(points int) int {
+		if gross > 0 {
+			return int(int64(points) * returnedGross / gross)
+		}
+		if qty > 0 {
+			return int(int64(points) * returnedQty / qty)
+		}
+		return 0
+	}
+
+	// the refund goes first, so the points given back can cover the reversal
+	if refund := share(redeemed) - refunded; refund > 0 {
+		entry := &LoyaltyEntry{CustomerID: customerID, Kind: LoyaltyRefund, Points: refund, SaleID: saleID, ManagerID: managerID}
+		if err = s.addPoints(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+
+	reverse := share(earned) - reversed
+	if reverse <= 0 {
+		return nil
+	}
+	var balance int
+	if err = tx.QueryRow(ctx, `select loyalty_points from customers where id = $1 for update`, customerID).Scan(&balance); err != nil {
+		logging.Ctx(ctx, s.logger).Error("reverse points", zap.Error(err))
+		return ErrInternal
+	}
+	if reverse > balance {
+		reverse = balance
+	}
+	if reverse == 0 {
+		return nil
+	}
+	entry := &LoyaltyEntry{CustomerID: customerID, Kind: LoyaltyReverse, Points: -reverse, SaleID: saleID, ManagerID: managerID}
+	return s.addPoints(ctx, tx, entry)
+}
@@ -0,0 +1,29 @@
+package managers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEarnedPoints(t *testing.T) {
+	for _, c := range []struct {
+		gross  int64
+		spend  int64
+		points int
+		want   int
+	}{
+		{0, 100, 1, 0},
+		{-500, 100, 1, 0},
+		{99, 100, 1, 0},
+		{1250, 100, 2, 24},
+		{math.MaxInt64, 1, 1, MaxEntryPoints},
+		{math.MaxInt64, 100, MaxRulePoints, MaxEntryPoints},
+		{MaxEntryPoints / 3 * 100, 100, 3, MaxEntryPoints / 3 * 3},
+		{(MaxEntryPoints/3 + 1) * 100, 100, 3, MaxEntryPoints},
+	} {
+		rule := &LoyaltyRule{Spend: c.spend, Points: c.points}
+		if got := earnedPoints(c.gross, rule); got != c.want {
+			t.Errorf("earnedPoints(%d, %d per %d) = %d, want %d", c.gross, c.points, c.spend, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"github.com/shodikhuja83/crud/pkg/pricing"
+	"go.uber.org/zap"
+)
+
+// statuses of customer orders
+const (
+	OrderPending   = "pending"
+	OrderConfirmed = "confirmed"
+	OrderRejected  = "rejected"
+)
+
+// Order submitted by a customer, its positions stay reserved while it is pending.
+// The promo code was claimed at the checkout and goes to the sale.
+type Order struct {
+	ID          int64            `json:"id"`
+	CustomerID  int64            `json:"customer_id"`
+	Status      string           `json:"status"`
+	ManagerID   int64            `json:"manager_id"`
+	SaleID      int64            `json:"sale_id"`
+	Comment     string           `json:"comment"`
+	PromoCode   string           `json:"promo_code"`
+	PromoCodeID int64            `json:"promo_code_id"`
+	Created     time.Time        `json:"created"`
+	Updated     time.Time        `json:"updated"`
+	Positions   []*OrderPosition `json:"positions"`
+}
+
+// OrderPosition is quoted at the checkout like a sale position, Price is BasePrice less Discount per unit
+type OrderPosition struct {
+	ID        int64       `json:"id"`
+	OrderID   int64       `json:"order_id"`
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Qty       int         `json:"qty"`
+	BasePrice money.Money `json:"base_price"`
+	Discount  money.Money `json:"discount"`
+	Price     money.Money `json:"price"`
+}
+
+// page size of the order list
+const (
+	DefaultOrdersLimit = 100
+	MaxOrdersLimit     = 500
+)
+
+// OrderFilter selects orders for the list, all orders when Status is empty.
+// Limit defaults to DefaultOrdersLimit and is capped at MaxOrdersLimit.
+type OrderFilter struct {
+	Status string
+	Limit  int
+	Offset int
+}
+
+// Orders lists a page of orders with all of their positions
+func (s *Service) Orders(ctx context.Context, filter *OrderFilter) ([]*Order, error) {
+	ctx, span := tracer.Start(ctx, "managers.Orders")
+	defer span.End()
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultOrdersLimit
+	}
+	if filter.Limit > MaxOrdersLimit {
+		filter.Limit = MaxOrdersLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	items := make([]*Order, 0)
+
+	// the page is of orders, not of their positions, so none of them comes back cut
+	rows, err := s.db.Query(ctx, `
+	select o.id, o.customer_id, o.status, coalesce(o.manager_id, 0), coalesce(o.sale_id, 0), o.comment,
+		coalesce(o.promo_code_id, 0), coalesce(pc.code, ''), o.created, o.updated,
+		op.id, op.product_id, p.name, op.qty, op.base_price, op.discount, op.price, op.currency
+	from orders o
+	join orders_positions op on op.order_id = o.id
+	join products p on p.id = op.product_id
+	left join promo_codes pc on pc.id = o.promo_code_id
+	where o.id in (
+		select id from orders where $1 = '' or status = $1
+		order by id limit $2 offset $3
+	)
+	order by o.id, op.id`, filter.Status, filter.Limit, filter.Offset)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("orders", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	var item *Order
+	for rows.Next() {
+		order := &Order{}
+		position := &OrderPosition{}
+		err = rows.Scan(&order.ID, &order.CustomerID, &order.Status, &order.ManagerID, &order.SaleID, &order.Comment,
+			&order.PromoCodeID, &order.PromoCode, &order.Created, &order.Updated, &position.ID, &position.ProductID,
+			&position.Name, &position.Qty, &position.BasePrice.Amount, &position.Discount.Amount, &position.Price.Amount,
+			&position.Price.Currency)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("orders", zap.Error(err))
+			return nil, ErrInternal
+		}
+		position.BasePrice.Currency = position.Price.Currency
+		position.Discount.Currency = position.Price.Currency
+		if item == nil || item.ID != order.ID {
+			item = order
+			items = append(items, item)
+		}
+		position.OrderID = item.ID
+		item.Positions = append(item.Positions, position)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("orders", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return items, nil
+}
+
+// ConfirmOrder turns the pending order into a sale made by the manager at the prices and with the promo code
+// of the checkout
+func (s *Service) ConfirmOrder(ctx context.Context, managerID int64, orderID int64) (*Sale, error) {
+	ctx, span := tracer.Start(ctx, "managers.ConfirmOrder")
+	defer span.End()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("confirm order", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := s.releaseOrder(ctx, tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	sale := &Sale{
+		ManagerID:   managerID,
+		CustomerID:  order.CustomerID,
+		PromoCode:   order.PromoCode,
+		PromoCodeID: order.PromoCodeID,
+		ordered:     true,
+	}
+	for _, position := range order.Positions {
+		sale.Positions = append(sale.Positions, &SalePosition{
+			ProductID: position.ProductID,
+			Qty:       position.Qty,
+			BasePrice: position.BasePrice,
+			Discount:  position.Discount,
+			Price:     position.Price,
+			quoted:    true,
+		})
+	}
+
+	if err = s.makeSale(ctx, tx, sale); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+	update orders set status = $2, manager_id = $3, sale_id = $4, updated = current_timestamp where id = $1`,
+		orderID, OrderConfirmed, managerID, sale.ID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("confirm order", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("confirm order", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return sale, nil
+}
+
+// RejectOrder releases the stock reserved by the pending order and the use of its promo code
+func (s *Service) RejectOrder(ctx context.Context, managerID int64, orderID int64, comment string) error {
+	ctx, span := tracer.Start(ctx, "managers.RejectOrder")
+	defer span.End()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("reject order", zap.Error(err))
+		return ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := s.releaseOrder(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.PromoCodeID != 0 {
+		if err = pricing.ReleasePromoCode(ctx, tx, order.PromoCodeID); err != nil {
+			logging.Ctx(ctx, s.logger).Error("reject order", zap.Error(err))
+			return ErrInternal
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+	update orders set status = $2, manager_id = $3, comment = $4, updated = current_timestamp where id = $1`,
+		orderID, OrderRejected, managerID, comment)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("reject order", zap.Error(err))
+		return ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("reject order", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// releaseOrder locks the pending order and takes its positions off products.reserved
+func (s *Service) releaseOrder(ctx context.Context, tx pgx.Tx, orderID int64) (*Order, error) {
+	order := &Order{ID: orderID}
+	err := tx.QueryRow(ctx, `
+	select o.customer_id, o.status, coalesce(o.promo_code_id, 0), coalesce(pc.code, '')
+	from orders o left join promo_codes pc on pc.id = o.promo_code_id
+	where o.id = $1 for update of o`, orderID).
+		Scan(&order.CustomerID, &order.Status, &order.PromoCodeID, &order.PromoCode)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("release order", zap.Error(err))
+		return nil, ErrInternal
+	}
+	if order.Status != OrderPending {
+		return nil, ErrOrderNotPending
+	}
+
+	rows, err := tx.Query(ctx, `
+	select id, product_id, qty, base_price, discount, price, currency from orders_positions where order_id = $1 order by id`, orderID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("release order", zap.Error(err))
+		return nil, ErrInternal
+	}
+	for rows.Next() {
+		position := &OrderPosition{OrderID: orderID}
+		err = rows.Scan(&position.ID, &position.ProductID, &position.Qty, &position.BasePrice.Amount,
+			&position.Discount.Amount, &position.Price.Amount, &position.Price.Currency)
+		if err != nil {
+			rows.Close()
+			logging.Ctx(ctx, s.logger).Error("release order", zap.Error(err))
+			return nil, ErrInternal
+		}
+		position.BasePrice.Currency = position.Price.Currency
+		position.Discount.Currency = position.Price.Currency
+		order.Positions = append(order.Positions, position)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("release order", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	for _, position := range order.Positions {
+		_, err = tx.Exec(ctx, `update products set reserved = reserved - $1 where id = $2`, position.Qty, position.ProductID)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("release order", zap.Error(err))
+			return nil, ErrInternal
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,421 @@
+package managers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"github.com/shodikhuja83/crud/pkg/pricing"
+	"go.uber.org/zap"
+)
+
+// kinds of discounts and promo codes, fixed values are minor units of their currency taken off the price of every unit
+const (
+	DiscountPercent = pricing.Percent
+	DiscountFixed   = pricing.Fixed
+)
+
+// CustomerGroup gets its own prices from the price list
+type CustomerGroup struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// PriceListItem is the price of the product for the customer group, in the currency of the product
+type PriceListItem struct {
+	GroupID   int64       `json:"group_id"`
+	ProductID int64       `json:"product_id"`
+	Price     money.Money `json:"price"`
+	Created   time.Time   `json:"created"`
+}
+
+// Discount applied automatically, zero GroupID or ProductID means any
+type Discount struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`
+	Value     int64      `json:"value"`
+	Currency  string     `json:"currency"`
+	GroupID   int64      `json:"group_id"`
+	ProductID int64      `json:"product_id"`
+	Starts    *time.Time `json:"starts"`
+	Ends      *time.Time `json:"ends"`
+	Active    bool       `json:"active"`
+	Created   time.Time  `json:"created"`
+}
+
+// PromoCode is applied to the whole sale on top of discounts, zero UsageLimit means unlimited
+type PromoCode struct {
+	ID         int64      `json:"id"`
+	Code       string     `json:"code"`
+	Kind       string     `json:"kind"`
+	Value      int64      `json:"value"`
+	Currency   string     `json:"currency"`
+	Starts     *time.Time `json:"starts"`
+	Ends       *time.Time `json:"ends"`
+	UsageLimit int        `json:"usage_limit"`
+	Used       int        `json:"used"`
+	Active     bool       `json:"active"`
+	Created    time.Time  `json:"created"`
+}
+
+// validDiscount checks the value and normalizes the currency, which only a fixed discount has
+func validDiscount(kind string, value int64, currency *string) bool {
+	switch kind {
+	case DiscountPercent:
+		*currency = ""
+		return value > 0 && value <= 100
+	case DiscountFixed:
+		code, err := money.NormalizeCurrency(*currency)
+		if err != nil {
+			return false
+		}
+		*currency = code
+		return value > 0
+	}
+	return false
+}
+
+// priceSale computes the prices of the positions from the price list, discounts, the promo code
+// and the loyalty points of the sale, the positions of an order keep the prices of its checkout
+func (s *Service) priceSale(ctx context.Context, tx pgx.Tx, sale *Sale) error {
+	var groupID int64
+	err := tx.QueryRow(ctx, `select coalesce(group_id, 0) from customers where id = $1`, sale.CustomerID).Scan(&groupID)
+	if err != nil && err != pgx.ErrNoRows {
+		logging.Ctx(ctx, s.logger).Error("price sale", zap.Error(err))
+		return ErrInternal
+	}
+
+	// only a code checked here, or at the checkout of the order, is stored with the sale
+	promo := &pricing.Promo{}
+	if !sale.ordered {
+		sale.PromoCodeID = 0
+	}
+	if !sale.ordered && sale.PromoCode != "" {
+		promo, err = pricing.ClaimPromoCode(ctx, tx, sale.PromoCode)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("price sale", zap.Error(err))
+			return ErrInternal
+		}
+		if promo == nil {
+			return ErrInvalidPromoCode
+		}
+		sale.PromoCodeID = promo.ID
+	}
+
+	currency := ""
+	inclusive := make([]bool, len(sale.Positions))
+	for i, position := range sale.Positions {
+		quote, err := pricing.Unit(ctx, tx, position.ProductID, groupID)
+		if err == pgx.ErrNoRows {
+			return ErrInvalidPosition
+		}
+		if err == money.ErrOverflow {
+			return err
+		}
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("price sale", zap.Error(err))
+			return ErrInternal
+		}
+		position.TaxRate, inclusive[i] = quote.TaxRate, quote.Inclusive
+
+		if !position.quoted {
+			if promo.ID != 0 {
+				if err = quote.Apply(promo); err != nil {
+					return err
+				}
+			}
+			position.BasePrice, position.Discount, position.Price = quote.BasePrice, quote.Discount, quote.Price
+		}
+
+		// a sale is paid in one currency
+		if currency == "" {
+			currency = position.Price.Currency
+		}
+		if position.Price.Currency != currency {
+			return money.ErrCurrencyMismatch
+		}
+		// a fixed promo code is only worth its value in its own currency
+		if promo.ID != 0 && !promo.Applies(currency) {
+			return ErrInvalidPromoCode
+		}
+	}
+
+	// points are redeemed on the prices after the discounts, before the tax
+	if err = s.redeemPoints(ctx, tx, sale, groupID, currency); err != nil {
+		return err
+	}
+
+	for i, position := range sale.Positions {
+		amount, err := position.Price.Mul(int64(position.Qty))
+		if err != nil {
+			return err
+		}
+		position.Net, position.Tax, position.Gross, err = taxOf(amount, position.TaxRate, inclusive[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CustomerGroups ...
+func (s *Service) CustomerGroups(ctx context.Context) ([]*CustomerGroup, error) {
+	ctx, span := tracer.Start(ctx, "managers.CustomerGroups")
+	defer span.End()
+
+	items := make([]*CustomerGroup, 0)
+
+	rows, err := s.db.Query(ctx, `select id, name, created from customer_groups order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer groups", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &CustomerGroup{}
+		if err = rows.Scan(&item.ID, &item.Name, &item.Created); err != nil {
+			logging.Ctx(ctx, s.logger).Error("customer groups", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer groups", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SaveCustomerGroup creates or renames the group
+func (s *Service) SaveCustomerGroup(ctx context.Context, item *CustomerGroup) (*CustomerGroup, error) {
+	ctx, span := tracer.Start(ctx, "managers.SaveCustomerGroup")
+	defer span.End()
+
+	var err error
+	if item.ID == 0 {
+		err = s.db.QueryRow(ctx, `insert into customer_groups (name) values ($1) returning id, name, created`, item.Name).
+			Scan(&item.ID, &item.Name, &item.Created)
+	} else {
+		err = s.db.QueryRow(ctx, `update customer_groups set name = $2 where id = $1 returning id, name, created`, item.ID, item.Name).
+			Scan(&item.ID, &item.Name, &item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save customer group", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// PriceList returns the prices of the group
+func (s *Service) PriceList(ctx context.Context, groupID int64) ([]*PriceListItem, error) {
+	ctx, span := tracer.Start(ctx, "managers.PriceList")
+	defer span.End()
+
+	items := make([]*PriceListItem, 0)
+
+	rows, err := s.db.Query(ctx, `
+	select pl.group_id, pl.product_id, pl.price, p.currency, pl.created
+	from price_lists pl join products p on p.id = pl.product_id
+	where pl.group_id = $1 order by pl.product_id`, groupID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("price list", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &PriceListItem{}
+		if err = rows.Scan(&item.GroupID, &item.ProductID, &item.Price.Amount, &item.Price.Currency, &item.Created); err != nil {
+			logging.Ctx(ctx, s.logger).Error("price list", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("price list", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SetPrice puts the price of the product into the price list of the group
+func (s *Service) SetPrice(ctx context.Context, item *PriceListItem) (*PriceListItem, error) {
+	ctx, span := tracer.Start(ctx, "managers.SetPrice")
+	defer span.End()
+
+	if item.Price.Amount < 0 {
+		return nil, ErrInvalidPrice
+	}
+
+	var currency string
+	err := s.db.QueryRow(ctx, `select currency from products where id = $1`, item.ProductID).Scan(&currency)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set price", zap.Error(err))
+		return nil, ErrInternal
+	}
+	if item.Price.Currency == "" {
+		item.Price.Currency = currency
+	}
+	if item.Price.Currency != currency {
+		return nil, money.ErrCurrencyMismatch
+	}
+
+	err = s.db.QueryRow(ctx, `
+	insert into price_lists (group_id, product_id, price) values ($1, $2, $3)
+	on conflict (group_id, product_id) do update set price = excluded.price
+	returning created`, item.GroupID, item.ProductID, item.Price.Amount).Scan(&item.Created)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("set price", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// Discounts ...
+func (s *Service) Discounts(ctx context.Context) ([]*Discount, error) {
+	ctx, span := tracer.Start(ctx, "managers.Discounts")
+	defer span.End()
+
+	items := make([]*Discount, 0)
+
+	rows, err := s.db.Query(ctx, `
+	select id, name, kind, value, coalesce(currency, ''), coalesce(group_id, 0), coalesce(product_id, 0),
+		starts, ends, active, created
+	from discounts order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("discounts", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Discount{}
+		err = rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Value, &item.Currency, &item.GroupID, &item.ProductID,
+			&item.Starts, &item.Ends, &item.Active, &item.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("discounts", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("discounts", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SaveDiscount ...
+func (s *Service) SaveDiscount(ctx context.Context, item *Discount) (*Discount, error) {
+	ctx, span := tracer.Start(ctx, "managers.SaveDiscount")
+	defer span.End()
+
+	if !validDiscount(item.Kind, item.Value, &item.Currency) {
+		return nil, ErrInvalidDiscount
+	}
+
+	var err error
+	if item.ID == 0 {
+		err = s.db.QueryRow(ctx, `
+		insert into discounts (name, kind, value, currency, group_id, product_id, starts, ends, active)
+		values ($1, $2, $3, nullif($4, ''), nullif($5, 0), nullif($6, 0), $7, $8, $9) returning id, created`,
+			item.Name, item.Kind, item.Value, item.Currency, item.GroupID, item.ProductID, item.Starts, item.Ends, item.Active).
+			Scan(&item.ID, &item.Created)
+	} else {
+		err = s.db.QueryRow(ctx, `
+		update discounts set name = $2, kind = $3, value = $4, currency = nullif($5, ''), group_id = nullif($6, 0),
+			product_id = nullif($7, 0), starts = $8, ends = $9, active = $10
+		where id = $1 returning created`,
+			item.ID, item.Name, item.Kind, item.Value, item.Currency, item.GroupID, item.ProductID,
+			item.Starts, item.Ends, item.Active).
+			Scan(&item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save discount", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// PromoCodes ...
+func (s *Service) PromoCodes(ctx context.Context) ([]*PromoCode, error) {
+	ctx, span := tracer.Start(ctx, "managers.PromoCodes")
+	defer span.End()
+
+	items := make([]*PromoCode, 0)
+
+	rows, err := s.db.Query(ctx, `
+	select id, code, kind, value, coalesce(currency, ''), starts, ends, usage_limit, used, active, created
+	from promo_codes order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("promo codes", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &PromoCode{}
+		err = rows.Scan(&item.ID, &item.Code, &item.Kind, &item.Value, &item.Currency, &item.Starts, &item.Ends,
+			&item.UsageLimit, &item.Used, &item.Active, &item.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("promo codes", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("promo codes", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SavePromoCode ...
+func (s *Service) SavePromoCode(ctx context.Context, item *PromoCode) (*PromoCode, error) {
+	ctx, span := tracer.Start(ctx, "managers.SavePromoCode")
+	defer span.End()
+
+	item.Code = strings.TrimSpace(item.Code)
+	if item.Code == "" || item.UsageLimit < 0 || !validDiscount(item.Kind, item.Value, &item.Currency) {
+		return nil, ErrInvalidDiscount
+	}
+
+	var err error
+	if item.ID == 0 {
+		err = s.db.QueryRow(ctx, `
+		insert into promo_codes (code, kind, value, currency, starts, ends, usage_limit, active)
+		values ($1, $2, $3, nullif($4, ''), $5, $6, $7, $8) returning id, used, created`,
+			item.Code, item.Kind, item.Value, item.Currency, item.Starts, item.Ends, item.UsageLimit, item.Active).
+			Scan(&item.ID, &item.Used, &item.Created)
+	} else {
+		err = s.db.QueryRow(ctx, `
+		update promo_codes set code = $2, kind = $3, value = $4, currency = nullif($5, ''), starts = $6, ends = $7,
+			usage_limit = $8, active = $9
+		where id = $1 returning used, created`,
+			item.ID, item.Code, item.Kind, item.Value, item.Currency, item.Starts, item.Ends, item.UsageLimit, item.Active).
+			Scan(&item.Used, &item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save promo code", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
@@ -0,0 +1,29 @@
+package managers
+
+import (
+	"testing"
+
+	"github.com/shodikhuja83/crud/pkg/money"
+)
+
+func TestValidDiscount(t *testing.T) {
+	for _, c := range []struct {
+		kind     string
+		value    int64
+		currency string
+		valid    bool
+		want     string
+	}{
+		{DiscountPercent, 10, "TJS", true, ""},
+		{DiscountPercent, 101, "", false, ""},
+		{DiscountFixed, 100, "", true, money.DefaultCurrency},
+		{DiscountFixed, 100, " jpy", true, "JPY"},
+		{DiscountFixed, 100, "dollars", false, "dollars"},
+		{DiscountFixed, 0, "TJS", false, "TJS"},
+	} {
+		currency := c.currency
+		if valid := validDiscount(c.kind, c.value, &currency); valid != c.valid || currency != c.want {
+			t.Errorf("validDiscount(%s, %d, %q) = %v, %q, want %v, %q", c.kind, c.value, c.currency, valid, currency, c.valid, c.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package managers
+
+import (
+	"context"
+
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// reportViews are the materialized views of the report aggregates
+var reportViews = []string{"sales_daily", "customer_rfm"}
+
+// RefreshReports recomputes the report aggregates (sales_daily, customer_rfm) without blocking their readers
+func (s *Service) RefreshReports(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "managers.RefreshReports")
+	defer span.End()
+
+	for _, view := range reportViews {
+		if _, err := s.db.Exec(ctx, `refresh materialized view concurrently `+view); err != nil {
+			logging.Ctx(ctx, s.logger).Error("refresh reports", zap.String("view", view), zap.Error(err))
+			return ErrInternal
+		}
+	}
+	return nil
+}
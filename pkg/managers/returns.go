@@ -0,0 +1,242 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// Return of positions of a sale, refunded at the price they were sold for
+type Return struct {
+	ID        int64             `json:"id"`
+	SaleID    int64             `json:"sale_id"`
+	ManagerID int64             `json:"manager_id"`
+	Reason    string            `json:"reason"`
+	Created   time.Time         `json:"created"`
+	Positions []*ReturnPosition `json:"positions"`
+}
+
+// ReturnPosition is the returned qty of one sales_positions row, Net, Tax and Gross are its share of the position
+type ReturnPosition struct {
+	ID             int64       `json:"id"`
+	ReturnID       int64       `json:"return_id"`
+	SalePositionID int64       `json:"sale_position_id"`
+	ProductID      int64       `json:"product_id"`
+	Qty            int         `json:"qty"`
+	Price          money.Money `json:"price"`
+	Net            money.Money `json:"net"`
+	Tax            money.Money `json:"tax"`
+	Gross          money.Money `json:"gross"`
+	Created        time.Time   `json:"created"`
+}
+
+// what is left to return of a sale position
+type returnable struct {
+	productID int64
+	price     money.Money
+	qty       int
+	net       money.Money
+	tax       money.Money
+	gross     money.Money
+}
+
+// share returns the amounts of qty units, the last units take what is left so rounding doesn't drift
+func (r *returnable) share(qty int) (net, tax, gross money.Money, err error) {
+	if qty == r.qty {
+		return r.net, r.tax, r.gross, nil
+	}
+	if net, err = r.net.MulDiv(int64(qty), int64(r.qty)); err != nil {
+		return
+	}
+	if gross, err = r.gross.MulDiv(int64(qty), int64(r.qty)); err != nil {
+		return
+	}
+	tax, err = gross.Sub(net)
+	return
+}
+
+// MakeReturn returns positions of the sale back to stock, without positions everything not yet returned is returned.
+// The share of the loyalty points of the sale is reversed and refunded with it.
+func (s *Service) MakeReturn(ctx context.Context, item *Return) (*Return, error) {
+	ctx, span := tracer.Start(ctx, "managers.MakeReturn")
+	defer span.End()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("make return", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	select sp.id, sp.product_id, sp.price, sp.currency,
+		sp.qty - coalesce(r.qty, 0), sp.net - coalesce(r.net, 0), sp.tax - coalesce(r.tax, 0), sp.gross - coalesce(r.gross, 0)
+	from sales_positions sp
+	left join lateral (
+		select sum(qty) qty, sum(net) net, sum(tax) tax, sum(gross) gross
+		from sales_returns_positions where sale_position_id = sp.id
+	) r on true
+	where sp.sale_id = $1 order by sp.id for update of sp`, item.SaleID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("make return", zap.Error(err))
+		return nil, ErrInternal
+	}
+	left := make(map[int64]*returnable)
+	order := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		position := &returnable{}
+		err = rows.Scan(&id, &position.productID, &position.price.Amount, &position.price.Currency, &position.qty,
+			&position.net.Amount, &position.tax.Amount, &position.gross.Amount)
+		if err != nil {
+			rows.Close()
+			logging.Ctx(ctx, s.logger).Error("make return", zap.Error(err))
+			return nil, ErrInternal
+		}
+		position.net.Currency = position.price.Currency
+		position.tax.Currency = position.price.Currency
+		position.gross.Currency = position.price.Currency
+		left[id] = position
+		order = append(order, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("make return", zap.Error(err))
+		return nil, ErrInternal
+	}
+	if len(left) == 0 {
+		return nil, ErrNotFound
+	}
+
+	if len(item.Positions) == 0 {
+		for _, id := range order {
+			if left[id].qty > 0 {
+				item.Positions = append(item.Positions, &ReturnPosition{SalePositionID: id, Qty: left[id].qty})
+			}
+		}
+		if len(item.Positions) == 0 {
+			return nil, ErrReturnExceedsSale
+		}
+	}
+
+	for _, position := range item.Positions {
+		sold, ok := left[position.SalePositionID]
+		if !ok || position.Qty <= 0 {
+			return nil, ErrInvalidPosition
+		}
+		if position.Qty > sold.qty {
+			return nil, ErrReturnExceedsSale
+		}
+		position.ProductID = sold.productID
+		position.Price = sold.price
+		if position.Net, position.Tax, position.Gross, err = sold.share(position.Qty); err != nil {
+			return nil, err
+		}
+		sold.qty -= position.Qty
+		if sold.net, err = sold.net.Sub(position.Net); err != nil {
+			return nil, err
+		}
+		if sold.tax, err = sold.tax.Sub(position.Tax); err != nil {
+			return nil, err
+		}
+		if sold.gross, err = sold.gross.Sub(position.Gross); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.QueryRow(ctx, `insert into sales_returns (sale_id, manager_id, reason) values ($1, $2, $3) returning id, created`,
+		item.SaleID, item.ManagerID, item.Reason).Scan(&item.ID, &item.Created)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("make return", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	for _, position := range item.Positions {
+		position.ReturnID = item.ID
+		err = tx.QueryRow(ctx, `
+		insert into sales_returns_positions (return_id, sale_position_id, qty, price, currency, net, tax, gross)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id, created`,
+			position.ReturnID, position.SalePositionID, position.Qty, position.Price.Amount, position.Price.Currency,
+			position.Net.Amount, position.Tax.Amount, position.Gross.Amount).
+			Scan(&position.ID, &position.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("make return", zap.Error(err))
+			return nil, ErrInternal
+		}
+
+		err = s.addMovement(ctx, tx, &Movement{
+			ProductID:      position.ProductID,
+			Kind:           MovementReturn,
+			Qty:            position.Qty,
+			ManagerID:      item.ManagerID,
+			SalePositionID: position.SalePositionID,
+			Comment:        item.Reason,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.reversePoints(ctx, tx, item.SaleID, item.ManagerID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("make return", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// Returns lists the returns made for the sale
+func (s *Service) Returns(ctx context.Context, saleID int64) ([]*Return, error) {
+	ctx, span := tracer.Start(ctx, "managers.Returns")
+	defer span.End()
+
+	items := make([]*Return, 0)
+
+	rows, err := s.db.Query(ctx, `
+	select r.id, r.sale_id, r.manager_id, r.reason, r.created,
+		rp.id, rp.sale_position_id, sp.product_id, rp.qty, rp.price, rp.currency, rp.net, rp.tax, rp.gross, rp.created
+	from sales_returns r
+	join sales_returns_positions rp on rp.return_id = r.id
+	join sales_positions sp on sp.id = rp.sale_position_id
+	where r.sale_id = $1
+	order by r.id, rp.id`, saleID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("returns", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	var item *Return
+	for rows.Next() {
+		ret := &Return{}
+		position := &ReturnPosition{}
+		err = rows.Scan(&ret.ID, &ret.SaleID, &ret.ManagerID, &ret.Reason, &ret.Created,
+			&position.ID, &position.SalePositionID, &position.ProductID, &position.Qty, &position.Price.Amount,
+			&position.Price.Currency, &position.Net.Amount, &position.Tax.Amount, &position.Gross.Amount, &position.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("returns", zap.Error(err))
+			return nil, ErrInternal
+		}
+		if item == nil || item.ID != ret.ID {
+			item = ret
+			items = append(items, item)
+		}
+		position.ReturnID = item.ID
+		position.Net.Currency = position.Price.Currency
+		position.Tax.Currency = position.Price.Currency
+		position.Gross.Currency = position.Price.Currency
+		item.Positions = append(item.Positions, position)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("returns", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return items, nil
+}
@@ -0,0 +1,251 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// limits of a page of sales
+const (
+	DefaultSalesLimit = 50
+	MaxSalesLimit     = 500
+)
+
+// SalesFilter selects sales for the list, zero values don't filter
+type SalesFilter struct {
+	ManagerID  int64
+	CustomerID int64
+	ProductID  int64
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// SalesPage is one page of the sales list, Count is the number of sales matching the filter
+// and Totals are their totals less the returns, one per currency
+type SalesPage struct {
+	Items  []*Sale       `json:"items"`
+	Totals []*SalesTotal `json:"totals"`
+	Count  int64         `json:"count"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// visible sales: admins see every sale, other managers their own and the ones of their reports
+const visibleSalesSQL = `
+	with recursive team as (
+		select id from managers where id = $1
+		union
+		select m.id from managers m join team t on m.boss_id = t.id
+	)
+	select s.id from sales s
+	where (select is_admin from managers where id = $1) or s.manager_id in (select id from team)`
+
+// Sales returns a page of the sales visible to the viewer with the totals of all the sales matching the filter
+func (s *Service) Sales(ctx context.Context, viewerID int64, filter *SalesFilter) (*SalesPage, error) {
+	ctx, span := tracer.Start(ctx, "managers.Sales")
+	defer span.End()
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultSalesLimit
+	}
+	if filter.Limit > MaxSalesLimit {
+		filter.Limit = MaxSalesLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	page := &SalesPage{Items: make([]*Sale, 0), Limit: filter.Limit, Offset: filter.Offset}
+
+	filtered := `
+	with visible as (` + visibleSalesSQL + `)
+	select s.id, s.manager_id, s.customer_id, coalesce(s.promo_code_id, 0) promo_code_id, s.created
+	from sales s
+	where s.id in (select id from visible)
+		and ($2::bigint = 0 or s.manager_id = $2)
+		and ($3::bigint = 0 or s.customer_id = $3)
+		and ($4::bigint = 0 or exists (select 1 from sales_positions sp where sp.sale_id = s.id and sp.product_id = $4))
+		and ($5::timestamp is null or s.created >= $5)
+		and ($6::timestamp is null or s.created < $6)`
+	args := []interface{}{viewerID, filter.ManagerID, filter.CustomerID, filter.ProductID, filter.From, filter.To}
+
+	err := s.db.QueryRow(ctx, `select count(*) from (`+filtered+`) f`, args...).Scan(&page.Count)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("sales", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	page.Totals, err = s.salesTotals(ctx, `
+	select currency, sum(net)::text, sum(tax)::text, sum(gross)::text
+	from (
+		select sp.currency, sp.net, sp.tax, sp.gross
+		from (`+filtered+`) f join sales_positions sp on sp.sale_id = f.id
+		union all
+		select rp.currency, -rp.net, -rp.tax, -rp.gross
+		from (`+filtered+`) f
+		join sales_positions sp on sp.sale_id = f.id
+		join sales_returns_positions rp on rp.sale_position_id = sp.id
+	) t
+	group by currency
+	order by currency`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the gross of a sale is less the returns, a sale is paid in one currency
+	rows, err := s.db.Query(ctx, `
+	select f.id, f.manager_id, f.customer_id, f.promo_code_id, f.created, coalesce(sp.currency, ''),
+		coalesce(sp.gross, 0) - coalesce(rp.gross, 0), coalesce(rp.gross, 0)
+	from (`+filtered+`) f
+	left join lateral (
+		select min(currency) currency, sum(gross)::bigint gross from sales_positions where sale_id = f.id
+	) sp on true
+	left join lateral (
+		select sum(r.gross)::bigint gross
+		from sales_positions p join sales_returns_positions r on r.sale_position_id = p.id
+		where p.sale_id = f.id
+	) rp on true
+	order by f.id desc
+	limit $7 offset $8`, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("sales", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Sale{}
+		err = rows.Scan(&item.ID, &item.ManagerID, &item.CustomerID, &item.PromoCodeID, &item.Created,
+			&item.Gross.Currency, &item.Gross.Amount, &item.Returned.Amount)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("sales", zap.Error(err))
+			return nil, ErrInternal
+		}
+		item.Returned.Currency = item.Gross.Currency
+		page.Items = append(page.Items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("sales", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return page, nil
+}
+
+// Sale returns the sale with its positions when it is visible to the viewer
+func (s *Service) Sale(ctx context.Context, viewerID int64, saleID int64) (*Sale, error) {
+	ctx, span := tracer.Start(ctx, "managers.Sale")
+	defer span.End()
+
+	item := &Sale{}
+
+	err := s.db.QueryRow(ctx, `
+	with visible as (`+visibleSalesSQL+`)
+	select s.id, s.manager_id, s.customer_id, coalesce(s.promo_code_id, 0), coalesce(pc.code, ''),
+		s.points_redeemed, s.points_earned, s.created
+	from sales s
+	left join promo_codes pc on pc.id = s.promo_code_id
+	where s.id = $2 and s.id in (select id from visible)`, viewerID, saleID).
+		Scan(&item.ID, &item.ManagerID, &item.CustomerID, &item.PromoCodeID, &item.PromoCode,
+			&item.PointsRedeemed, &item.PointsEarned, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("sale", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	rows, err := s.db.Query(ctx, `
+	select sp.id, sp.product_id, p.name, sp.qty, sp.currency, sp.base_price, sp.discount, sp.price,
+		sp.tax_rate, sp.net, sp.tax, sp.gross, sp.created,
+		(select coalesce(sum(gross), 0)::bigint from sales_returns_positions where sale_position_id = sp.id)
+	from sales_positions sp
+	join products p on p.id = sp.product_id
+	where sp.sale_id = $1
+	order by sp.id`, saleID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("sale", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	returned := make([]money.Money, 0)
+	for rows.Next() {
+		position := &SalePosition{SaleID: saleID}
+		var currency string
+		var returnedGross int64
+		err = rows.Scan(&position.ID, &position.ProductID, &position.Name, &position.Qty, &currency,
+			&position.BasePrice.Amount, &position.Discount.Amount, &position.Price.Amount, &position.TaxRate,
+			&position.Net.Amount, &position.Tax.Amount, &position.Gross.Amount, &position.Created, &returnedGross)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("sale", zap.Error(err))
+			return nil, ErrInternal
+		}
+		position.BasePrice.Currency = currency
+		position.Discount.Currency = currency
+		position.Price.Currency = currency
+		position.Net.Currency = currency
+		position.Tax.Currency = currency
+		position.Gross.Currency = currency
+		item.Positions = append(item.Positions, position)
+		returned = append(returned, money.New(returnedGross, currency))
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("sale", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	if err = item.sumGross(); err != nil {
+		return nil, err
+	}
+	// the gross is less the returns like the one of the list
+	for _, amount := range returned {
+		if item.Returned, err = item.Returned.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+	if item.Gross, err = item.Gross.Sub(item.Returned); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// sumGross sets the gross total of the sale from its positions
+func (sale *Sale) sumGross() error {
+	if len(sale.Positions) == 0 {
+		return nil
+	}
+	gross := money.New(0, sale.Positions[0].Gross.Currency)
+	for _, position := range sale.Positions {
+		var err error
+		if gross, err = gross.Add(position.Gross); err != nil {
+			return err
+		}
+	}
+	sale.Gross = gross
+	sale.Returned = money.New(0, gross.Currency)
+	return nil
+}
+
+// completed returns the event of the saved sale
+func (sale *Sale) completed() *events.SaleCompleted {
+	event := &events.SaleCompleted{
+		SaleID: sale.ID, ManagerID: sale.ManagerID, CustomerID: sale.CustomerID, PromoCode: sale.PromoCode,
+		Gross: sale.Gross, Lines: make([]*events.SaleLine, 0, len(sale.Positions)), Created: sale.Created,
+	}
+	for _, position := range sale.Positions {
+		event.Lines = append(event.Lines, &events.SaleLine{
+			ProductID: position.ProductID, Name: position.Name, Qty: position.Qty, Price: position.Price, Gross: position.Gross,
+		})
+	}
+	return event
+}
@@ -0,0 +1,160 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidSegment = errors.New("invalid segment")
+
+// segments of the customers with sales, checked in this order
+const (
+	// SegmentLost bought last more than SegmentLostDays ago
+	SegmentLost = "lost"
+	// SegmentAtRisk bought last more than SegmentAtRiskDays ago
+	SegmentAtRisk = "at_risk"
+	// SegmentNew bought first in the last SegmentNewDays
+	SegmentNew = "new"
+	// SegmentLoyal made SegmentLoyalSales sales or more
+	SegmentLoyal = "loyal"
+	// SegmentRegular is every other buyer
+	SegmentRegular = "regular"
+)
+
+// thresholds of the segments
+const (
+	SegmentNewDays    = 30
+	SegmentAtRiskDays = 60
+	SegmentLostDays   = 180
+	SegmentLoyalSales = 4
+)
+
+// Segments ...
+var Segments = []string{SegmentNew, SegmentLoyal, SegmentRegular, SegmentAtRisk, SegmentLost}
+
+// segmentSQL returns the segment of the first_sale, last_sale and sales columns of the table alias, empty without sales
+func segmentSQL(alias string) string {
+	return fmt.Sprintf(`case
+		when %[1]s.last_sale is null then ''
+		when %[1]s.last_sale < current_timestamp - interval '%[2]d days' then '%[3]s'
+		when %[1]s.last_sale < current_timestamp - interval '%[4]d days' then '%[5]s'
+		when %[1]s.first_sale >= current_timestamp - interval '%[6]d days' then '%[7]s'
+		when %[1]s.sales >= %[8]d then '%[9]s'
+		else '%[10]s' end`,
+		alias, SegmentLostDays, SegmentLost, SegmentAtRiskDays, SegmentAtRisk, SegmentNewDays, SegmentNew,
+		SegmentLoyalSales, SegmentLoyal, SegmentRegular)
+}
+
+// page size of the customer list
+const (
+	DefaultCustomersLimit = 100
+	MaxCustomersLimit     = 500
+)
+
+// CustomerFilter selects customers for the list, zero values don't filter.
+// Limit defaults to DefaultCustomersLimit and is capped at MaxCustomersLimit.
+type CustomerFilter struct {
+	Segment string
+	// Tags selects the customers with every one of them
+	Tags   []string
+	Limit  int
+	Offset int
+}
+
+// CustomerSummary is the RFM analysis of a customer. The stats are current, the scores (1 to 5, 5 is best,
+// relative to the other customers) are of the last refresh of the reports and 0 before the first one.
+type CustomerSummary struct {
+	Customer       *Customer     `json:"customer"`
+	FirstSale      *time.Time    `json:"first_sale"`
+	LastSale       *time.Time    `json:"last_sale"`
+	RecencyDays    *int          `json:"recency_days"`
+	Sales          int64         `json:"sales"`
+	Totals         []money.Money `json:"totals"`
+	RecencyScore   int           `json:"recency_score"`
+	FrequencyScore int           `json:"frequency_score"`
+	MonetaryScore  int           `json:"monetary_score"`
+}
+
+func validSegment(segment string) bool {
+	for _, known := range Segments {
+		if segment == known {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomerSummary returns the RFM analysis of the customer
+func (s *Service) CustomerSummary(ctx context.Context, id int64) (*CustomerSummary, error) {
+	ctx, span := tracer.Start(ctx, "managers.CustomerSummary")
+	defer span.End()
+
+	summary := &CustomerSummary{Customer: &Customer{}, Totals: make([]money.Money, 0)}
+	customer := summary.Customer
+	err := s.db.QueryRow(ctx, `
+	select c.id, c.name, c.phone, c.email, c.address, coalesce(c.group_id, 0), c.active, c.created, `+tagsSQL("c")+`,
+		st.first_sale, st.last_sale, st.sales, `+segmentSQL("st")+`,
+		coalesce(r.recency_score, 0), coalesce(r.frequency_score, 0), coalesce(r.monetary_score, 0)
+	from customers c
+	cross join lateral (
+		select min(created) first_sale, max(created) last_sale, count(*) sales from sales where customer_id = c.id
+	) st
+	left join customer_rfm r on r.customer_id = c.id
+	where c.id = $1`, id).
+		Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Email, &customer.Address, &customer.GroupID,
+			&customer.Active, &customer.Created, &customer.Tags, &summary.FirstSale, &summary.LastSale, &summary.Sales, &customer.Segment,
+			&summary.RecencyScore, &summary.FrequencyScore, &summary.MonetaryScore)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer summary", zap.Error(err))
+		return nil, ErrInternal
+	}
+	if summary.LastSale != nil {
+		days := int(time.Since(*summary.LastSale).Hours() / 24)
+		summary.RecencyDays = &days
+	}
+
+	rows, err := s.db.Query(ctx, `
+	select currency, sum(gross)::bigint
+	from (
+		select sp.currency, sp.gross
+		from sales s join sales_positions sp on sp.sale_id = s.id
+		where s.customer_id = $1
+		union all
+		select rp.currency, -rp.gross
+		from sales s
+		join sales_returns r on r.sale_id = s.id
+		join sales_returns_positions rp on rp.return_id = r.id
+		where s.customer_id = $1
+	) t
+	group by currency
+	order by currency`, id)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer summary", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		total := money.Money{}
+		if err = rows.Scan(&total.Currency, &total.Amount); err != nil {
+			logging.Ctx(ctx, s.logger).Error("customer summary", zap.Error(err))
+			return nil, ErrInternal
+		}
+		summary.Totals = append(summary.Totals, total)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("customer summary", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return summary, nil
+}
@@ -5,17 +5,22 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"log"
-	"strconv"
+	"strings"
 	"time"
-	//
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"github.com/shodikhuja83/crud/pkg/outbox"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
-
 )
 
+var tracer = otel.Tracer("github.com/shodikhuja83/crud/pkg/managers")
+
 var (
 	//ErrNotFound ...
 	ErrNotFound = errors.New("item not found")
@@ -31,14 +36,41 @@ var (
 	ErrPhoneUsed = errors.New("phone already registered")
 	//ErrTokenExpired ...
 	ErrTokenExpired = errors.New("token expired")
+	//ErrNotEnoughStock ...
+	ErrNotEnoughStock = errors.New("not enough stock")
+	//ErrInvalidMovement ...
+	ErrInvalidMovement = errors.New("invalid stock movement")
+	//ErrInvalidPosition ...
+	ErrInvalidPosition = errors.New("invalid sale position")
+	//ErrReturnExceedsSale ...
+	ErrReturnExceedsSale = errors.New("return exceeds sold qty")
+	//ErrOrderNotPending ...
+	ErrOrderNotPending = errors.New("order is not pending")
+	//ErrInvalidDiscount ...
+	ErrInvalidDiscount = errors.New("invalid discount")
+	//ErrInvalidPromoCode ...
+	ErrInvalidPromoCode = errors.New("invalid promo code")
+	//ErrInvalidPrice ...
+	ErrInvalidPrice = errors.New("invalid price")
+	//ErrInvalidTaxRate ...
+	ErrInvalidTaxRate = errors.New("invalid tax rate")
+	//ErrInvalidManager ...
+	ErrInvalidManager = errors.New("invalid manager")
+	//ErrInvalidThreshold ...
+	ErrInvalidThreshold = errors.New("invalid reorder threshold")
+	//ErrInvalidCategory ...
+	ErrInvalidCategory = errors.New("invalid tax category")
+	//ErrSKUUsed ...
+	ErrSKUUsed = errors.New("sku already used")
 )
 
 type Service struct {
-	db *pgxpool.Pool
+	db     *pgxpool.Pool
+	logger *zap.Logger
 }
 
-func NewService(db *pgxpool.Pool) *Service {
-	return &Service{db: db}
+func NewService(db *pgxpool.Pool, logger *zap.Logger) *Service {
+	return &Service{db: db, logger: logger}
 }
 
 
@@ -57,38 +89,71 @@ type Manager struct {
 
 
 type Product struct {
-	ID      int64     `json:"id"`
-	Name    string    `json:"name"`
-	Price   int       `json:"price"`
-	Qty     int       `json:"qty"`
-	Active  bool      `json:"active"`
-	Created time.Time `json:"created"`
+	ID         int64       `json:"id"`
+	SKU        string      `json:"sku"`
+	Name       string      `json:"name"`
+	Price      money.Money `json:"price"`
+	Qty        int         `json:"qty"`
+	CategoryID int64       `json:"category_id"`
+	// a stock alert is raised when the available stock drops to the threshold, null disables the alerts
+	ReorderThreshold *int      `json:"reorder_threshold"`
+	Active           bool      `json:"active"`
+	Created          time.Time `json:"created"`
 }
 
 type Sale struct {
-	ID         int64           `json:"id"`
-	ManagerID  int64           `json:"manager_id"`
-	CustomerID int64           `json:"customer_id"`
-	Created    time.Time       `json:"created"`
-	Positions  []*SalePosition `json:"positions"`
+	ID          int64           `json:"id"`
+	ManagerID   int64           `json:"manager_id"`
+	CustomerID  int64           `json:"customer_id"`
+	PromoCode   string          `json:"promo_code"`
+	PromoCodeID int64           `json:"promo_code_id"`
+	// Gross is less the Returned gross of the returns of the sale
+	Gross       money.Money     `json:"gross"`
+	Returned    money.Money     `json:"returned"`
+	Created     time.Time       `json:"created"`
+	Positions   []*SalePosition `json:"positions"`
+	// RedeemPoints asks to pay with loyalty points, PointsRedeemed are the ones used
+	RedeemPoints   int `json:"redeem_points"`
+	PointsRedeemed int `json:"points_redeemed"`
+	PointsEarned   int `json:"points_earned"`
+	// the sale of an order, its promo code was claimed at the checkout
+	ordered bool
 }
 
 
+//SalePosition: Price is computed by the server as BasePrice less Discount, all per unit.
+//Net, Tax and Gross are the amounts of the whole position, TaxRate is in basis points
 type SalePosition struct {
-	ID        int64     `json:"id"`
-	ProductID int64     `json:"product_id"`
-	SaleID    int64     `json:"sale_id"`
-	Price     int       `json:"price"`
-	Qty       int       `json:"qty"`
-	Created   time.Time `json:"created"`
+	ID        int64       `json:"id"`
+	ProductID int64       `json:"product_id"`
+	SaleID    int64       `json:"sale_id"`
+	Name      string      `json:"name"`
+	BasePrice money.Money `json:"base_price"`
+	Discount  money.Money `json:"discount"`
+	Price     money.Money `json:"price"`
+	Qty       int         `json:"qty"`
+	TaxRate   int64       `json:"tax_rate"`
+	Net       money.Money `json:"net"`
+	Tax       money.Money `json:"tax"`
+	Gross     money.Money `json:"gross"`
+	Created   time.Time   `json:"created"`
+	// quoted positions keep their Price, priceSale only taxes them
+	quoted bool
 }
 
 type Customer struct {
 	ID      int64     `json:"id"`
 	Name    string    `json:"name"`
 	Phone   string    `json:"phone"`
+	Email   string    `json:"email"`
+	Address string    `json:"address"`
+	GroupID int64     `json:"group_id"`
 	Active  bool      `json:"active"`
 	Created time.Time `json:"created"`
+	// Segment is set by the list and the summary, see Segments
+	Segment string `json:"segment,omitempty"`
+	// Tags are set by the list and the summary, SetCustomerTags changes them
+	Tags []string `json:"tags,omitempty"`
 }
 
 
@@ -104,16 +169,19 @@ func GenerateTokenStr() (string, error) {
 }
 
 func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "managers.IDByToken")
+	defer span.End()
+
 	var id int64
 	sqlStatement := `select manager_id from managers_tokens where token = $1`
 
 	err := s.db.QueryRow(ctx, sqlStatement, token).Scan(&id)
 
 	if err != nil {
-		log.Print(err)
 		if err == pgx.ErrNoRows {
 			return 0, nil
 		}
+		logging.Ctx(ctx, s.logger).Error("id by token", zap.Error(err), logging.Secret("token"))
 		return 0, nil
 	}
 
@@ -122,6 +190,9 @@ func (s *Service) IDByToken(ctx context.Context, token string) (int64, error) {
 
 //IsAdmin
 func (s *Service) IsAdmin(ctx context.Context, id int64) (isAdmin bool) {
+	ctx, span := tracer.Start(ctx, "managers.IsAdmin")
+	defer span.End()
+
 	sqlStmt := `select is_admin from managers  where id = $1`
 	err := s.db.QueryRow(ctx, sqlStmt, id).Scan(&isAdmin)
 	if err != nil {
@@ -132,13 +203,16 @@ func (s *Service) IsAdmin(ctx context.Context, id int64) (isAdmin bool) {
 
 //Create
 func (s *Service) Create(ctx context.Context, item *Manager) (string, error) {
+	ctx, span := tracer.Start(ctx, "managers.Create")
+	defer span.End()
+
 	var token string
 	var id int64
 
 	sqlStmt := `insert into managers(name,phone,is_admin) values ($1,$2,$3) on conflict (phone) do nothing returning id;`
 	err := s.db.QueryRow(ctx, sqlStmt, item.Name, item.Phone, item.IsAdmin).Scan(&id)
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("create", zap.Error(err))
 		return "", ErrInternal
 	}
 
@@ -157,6 +231,9 @@ func (s *Service) Create(ctx context.Context, item *Manager) (string, error) {
 
 //Token
 func (s *Service) Token(ctx context.Context, phone, password string) (token string, err error) {
+	ctx, span := tracer.Start(ctx, "managers.Token")
+	defer span.End()
+
 	var hash string
 	var id int64
 	err = s.db.QueryRow(ctx, `select id,password from managers where phone = $1`, phone).Scan(&id, &hash)
@@ -168,7 +245,9 @@ func (s *Service) Token(ctx context.Context, phone, password string) (token stri
 		return "", ErrInternal
 	}
 
+	_, hashSpan := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	hashSpan.End()
 	if err != nil {
 		return "", ErrInvalidPassword
 	}
@@ -186,103 +265,281 @@ func (s *Service) Token(ctx context.Context, phone, password string) (token stri
 	return token, nil
 }
 
-//SaveProduct
+//SaveProduct creates or updates the product, a change of qty is posted to the stock ledger as an adjustment
 func (s *Service) SaveProduct(ctx context.Context, product *Product) (*Product, error) {
+	ctx, span := tracer.Start(ctx, "managers.SaveProduct")
+	defer span.End()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save product", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = s.saveProduct(ctx, tx, product); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("save product", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return product, nil
+}
 
+// saveProduct saves the product inside tx and reads it back
+func (s *Service) saveProduct(ctx context.Context, tx pgx.Tx, product *Product) error {
 	var err error
+	product.Price.Currency, err = money.NormalizeCurrency(product.Price.Currency)
+	if err != nil || product.Price.Amount < 0 {
+		return ErrInvalidPrice
+	}
+	if product.ReorderThreshold != nil && *product.ReorderThreshold < 0 {
+		return ErrInvalidThreshold
+	}
 
+	var invalid, used bool
+	err = tx.QueryRow(ctx, `
+	select ($1 <> 0 and not exists(select 1 from tax_categories where id = $1)),
+		($2 <> '' and exists(select 1 from products where sku = $2 and id <> $3))`,
+		product.CategoryID, product.SKU, product.ID).Scan(&invalid, &used)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save product", zap.Error(err))
+		return ErrInternal
+	}
+	if invalid {
+		return ErrInvalidCategory
+	}
+	if used {
+		return ErrSKUUsed
+	}
+
+	delta := product.Qty
 	if product.ID == 0 {
-		sqlstmt := `insert into products(name,qty,price) values ($1,$2,$3) returning id,name,qty,price,active,created;`
-		err = s.db.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+		sqlstmt := `insert into products(name,price,currency,category_id,reorder_threshold,sku) values ($1,$2,$3,nullif($4,0),$5,nullif($6,'')) returning id;`
+		err = tx.QueryRow(ctx, sqlstmt, product.Name, product.Price.Amount, product.Price.Currency, product.CategoryID,
+			product.ReorderThreshold, product.SKU).Scan(&product.ID)
 	} else {
-		sqlstmt := `update  products set  name=$1, qty=$2,price=$3  where id = $4 returning id,name,qty,price,active,created;`
-		err = s.db.QueryRow(ctx, sqlstmt, product.Name, product.Qty, product.Price, product.ID).
-			Scan(&product.ID, &product.Name, &product.Qty, &product.Price, &product.Active, &product.Created)
+		var qty int
+		err = tx.QueryRow(ctx, `select qty from products where id = $1 for update`, product.ID).Scan(&qty)
+		if err == nil {
+			delta -= qty
+			_, err = tx.Exec(ctx, `update products set name=$1, price=$2, currency=$3, category_id=nullif($4,0), reorder_threshold=$5, sku=nullif($6,'') where id = $7`,
+				product.Name, product.Price.Amount, product.Price.Currency, product.CategoryID, product.ReorderThreshold, product.SKU, product.ID)
+		}
+	}
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save product", zap.Error(err))
+		return ErrInternal
+	}
+
+	if delta != 0 {
+		err = s.addMovement(ctx, tx, &Movement{ProductID: product.ID, Kind: MovementAdjustment, Qty: delta})
+		if err != nil {
+			return err
+		}
 	}
 
+	err = tx.QueryRow(ctx, `
+	select id,coalesce(sku,''),name,qty,price,currency,coalesce(category_id,0),reorder_threshold,active,created from products where id = $1`, product.ID).
+		Scan(&product.ID, &product.SKU, &product.Name, &product.Qty, &product.Price.Amount, &product.Price.Currency,
+			&product.CategoryID, &product.ReorderThreshold, &product.Active, &product.Created)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		logging.Ctx(ctx, s.logger).Error("save product", zap.Error(err))
+		return ErrInternal
 	}
-	return product, nil
+
+	err = outbox.Write(ctx, tx, &events.ProductSaved{
+		ProductID: product.ID, SKU: product.SKU, Name: product.Name, Price: product.Price, CategoryID: product.CategoryID,
+		ReorderThreshold: product.ReorderThreshold, Active: product.Active,
+	})
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save product", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
 }
 
-//MakeSalePosition
-func (s *Service) MakeSalePosition(ctx context.Context, position *SalePosition) bool {
+//MakeSalePosition saves the position of the sale and writes its stock movement
+func (s *Service) MakeSalePosition(ctx context.Context, tx pgx.Tx, managerID int64, position *SalePosition) error {
+	ctx, span := tracer.Start(ctx, "managers.MakeSalePosition")
+	defer span.End()
+
+	if position.Qty <= 0 {
+		return ErrInvalidPosition
+	}
+
 	active := false
-	qty := 0
-	if err := s.db.QueryRow(ctx, `select qty,active from products where id = $1`, position.ProductID).
-		Scan(&qty, &active); err != nil {
-		return false
+	err := tx.QueryRow(ctx, `select active from products where id = $1`, position.ProductID).Scan(&active)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidPosition
 	}
-	if qty < position.Qty || !active {
-		return false
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("make sale position", zap.Error(err))
+		return ErrInternal
 	}
-	if _, err := s.db.Exec(ctx, `update products set qty = $1 where id = $2`, qty-position.Qty, position.ProductID); err != nil {
-		log.Print(err)
-		return false
+	if !active {
+		return ErrInvalidPosition
+	}
+
+	err = tx.QueryRow(ctx, `
+	insert into sales_positions (sale_id,product_id,qty,price,base_price,discount,currency,tax_rate,net,tax,gross)
+	values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+	returning id, created`,
+		position.SaleID, position.ProductID, position.Qty, position.Price.Amount, position.BasePrice.Amount,
+		position.Discount.Amount, position.Price.Currency, position.TaxRate, position.Net.Amount, position.Tax.Amount,
+		position.Gross.Amount).
+		Scan(&position.ID, &position.Created)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("make sale position", zap.Error(err))
+		return ErrInternal
 	}
-	return true
+
+	return s.addMovement(ctx, tx, &Movement{
+		ProductID:      position.ProductID,
+		Kind:           MovementSale,
+		Qty:            -position.Qty,
+		ManagerID:      managerID,
+		SalePositionID: position.ID,
+	})
 }
 
 //MakeSale
 func (s *Service) MakeSale(ctx context.Context, sale *Sale) (*Sale, error) {
+	ctx, span := tracer.Start(ctx, "managers.MakeSale")
+	defer span.End()
 
-	positionsSQLstmt := "insert into sales_positions (sale_id,product_id,qty,price) values "
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("make sale", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
 
-	sqlstmt := `insert into sales(manager_id,customer_id) values ($1,$2) returning id, created;`
+	if err = s.makeSale(ctx, tx, sale); err != nil {
+		return nil, err
+	}
 
-	err := s.db.QueryRow(ctx, sqlstmt, sale.ManagerID, sale.CustomerID).Scan(&sale.ID, &sale.Created)
-	if err != nil {
-		log.Print(err)
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("make sale", zap.Error(err))
 		return nil, ErrInternal
 	}
-	for _, position := range sale.Positions {
-		if !s.MakeSalePosition(ctx, position) {
-			log.Print("Invalid position")
-			return nil, ErrInternal
-		}
-		positionsSQLstmt += "(" + strconv.FormatInt(sale.ID, 10) + "," + strconv.FormatInt(position.ProductID, 10) + "," + strconv.Itoa(position.Price) + "," + strconv.Itoa(position.Qty) + "),"
+
+	return sale, nil
+}
+
+// makeSale saves the sale with its positions inside tx
+func (s *Service) makeSale(ctx context.Context, tx pgx.Tx, sale *Sale) error {
+	if len(sale.Positions) == 0 {
+		return ErrInvalidPosition
 	}
 
-	positionsSQLstmt = positionsSQLstmt[0 : len(positionsSQLstmt)-1]
+	if err := s.priceSale(ctx, tx, sale); err != nil {
+		return err
+	}
+
+	sqlstmt := `insert into sales(manager_id,customer_id,promo_code_id) values ($1,$2,nullif($3,0)) returning id, created;`
 
-	log.Print(positionsSQLstmt)
-	_, err = s.db.Exec(ctx, positionsSQLstmt)
+	err := tx.QueryRow(ctx, sqlstmt, sale.ManagerID, sale.CustomerID, sale.PromoCodeID).Scan(&sale.ID, &sale.Created)
 	if err != nil {
-		log.Print(err)
-		return nil, ErrInternal
+		logging.Ctx(ctx, s.logger).Error("make sale", zap.Error(err))
+		return ErrInternal
+	}
+	for _, position := range sale.Positions {
+		position.SaleID = sale.ID
+		if err = s.MakeSalePosition(ctx, tx, sale.ManagerID, position); err != nil {
+			return err
+		}
+	}
+	if err = sale.sumGross(); err != nil {
+		return err
+	}
+	if err = s.settlePoints(ctx, tx, sale); err != nil {
+		return err
 	}
 
-	return sale, nil
+	if err = outbox.Write(ctx, tx, sale.completed()); err != nil {
+		logging.Ctx(ctx, s.logger).Error("make sale", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
 }
 
-//GetSales
-func (s *Service) GetSales(ctx context.Context, id int64) (sum int, err error) {
+//GetSales returns the net, tax and gross totals of the manager's sales less the returns, one per currency
+func (s *Service) GetSales(ctx context.Context, id int64) ([]*SalesTotal, error) {
+	ctx, span := tracer.Start(ctx, "managers.GetSales")
+	defer span.End()
 
 	sqlstmt := `
-	select coalesce(sum(sp.qty * sp.price),0) total
-	from managers m
-	left join sales s on s.manager_id= $1
-	left join sales_positions sp on sp.sale_id = s.id
-	group by m.id
-	limit 1`
-
-	err = s.db.QueryRow(ctx, sqlstmt, id).Scan(&sum)
+	select currency, sum(net)::text, sum(tax)::text, sum(gross)::text
+	from (
+		select sp.currency, sp.net, sp.tax, sp.gross
+		from sales s
+		join sales_positions sp on sp.sale_id = s.id
+		where s.manager_id = $1
+		union all
+		select rp.currency, -rp.net, -rp.tax, -rp.gross
+		from sales s
+		join sales_positions sp on sp.sale_id = s.id
+		join sales_returns_positions rp on rp.sale_position_id = sp.id
+		where s.manager_id = $1
+	) t
+	group by currency
+	order by currency`
+
+	return s.salesTotals(ctx, sqlstmt, id)
+}
+
+// salesTotals reads the totals of the query of currency, net, tax and gross rows, sums as text
+func (s *Service) salesTotals(ctx context.Context, sqlstmt string, args ...interface{}) ([]*SalesTotal, error) {
+	totals := make([]*SalesTotal, 0)
+	rows, err := s.db.Query(ctx, sqlstmt, args...)
 	if err != nil {
-		log.Print(err)
-		return 0, ErrInternal
+		logging.Ctx(ctx, s.logger).Error("sales totals", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency, net, tax, gross string
+		if err = rows.Scan(&currency, &net, &tax, &gross); err != nil {
+			logging.Ctx(ctx, s.logger).Error("sales totals", zap.Error(err))
+			return nil, ErrInternal
+		}
+		total := &SalesTotal{}
+		if total.Net, err = money.FromDecimal(net, currency); err != nil {
+			logging.Ctx(ctx, s.logger).Error("sales totals", zap.Error(err))
+			return nil, err
+		}
+		if total.Tax, err = money.FromDecimal(tax, currency); err != nil {
+			logging.Ctx(ctx, s.logger).Error("sales totals", zap.Error(err))
+			return nil, err
+		}
+		if total.Gross, err = money.FromDecimal(gross, currency); err != nil {
+			logging.Ctx(ctx, s.logger).Error("sales totals", zap.Error(err))
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("sales totals", zap.Error(err))
+		return nil, ErrInternal
 	}
-	return sum, nil
+	return totals, nil
 }
 
 //Products ...
 func (s *Service) Products(ctx context.Context) ([]*Product, error) {
+	ctx, span := tracer.Start(ctx, "managers.Products")
+	defer span.End()
 
 	items := make([]*Product, 0)
 
-	sqlstmt := `select id, name, price, qty from products where active = true order by id limit 500`
+	sqlstmt := `select id, coalesce(sku, ''), name, price, currency, qty, coalesce(category_id, 0), reorder_threshold from products where active = true order by id limit 500`
 	rows, err := s.db.Query(ctx, sqlstmt)
 
 	if err != nil {
@@ -295,9 +552,9 @@ func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 
 	for rows.Next() {
 		item := &Product{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Price, &item.Qty)
+		err = rows.Scan(&item.ID, &item.SKU, &item.Name, &item.Price.Amount, &item.Price.Currency, &item.Qty, &item.CategoryID, &item.ReorderThreshold)
 		if err != nil {
-			log.Print(err)
+			logging.Ctx(ctx, s.logger).Error("products", zap.Error(err))
 			return nil, err
 		}
 		items = append(items, item)
@@ -306,12 +563,39 @@ func (s *Service) Products(ctx context.Context) ([]*Product, error) {
 	return items, nil
 }
 
-//RemoveProductByID ...
+//RemoveProductByID deactivates the product, its sales and stock movements keep referring to it
 func (s *Service) RemoveProductByID(ctx context.Context, id int64) (err error) {
+	ctx, span := tracer.Start(ctx, "managers.RemoveProductByID")
+	defer span.End()
 
-	_, err = s.db.Exec(ctx, `delete from products where id = $1`, id)
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("remove product by id", zap.Error(err))
+		return ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	product := &events.ProductSaved{}
+	err = tx.QueryRow(ctx, `
+	update products set active = false where id = $1
+	returning id, coalesce(sku, ''), name, price, currency, coalesce(category_id, 0), reorder_threshold, active`, id).
+		Scan(&product.ProductID, &product.SKU, &product.Name, &product.Price.Amount, &product.Price.Currency,
+			&product.CategoryID, &product.ReorderThreshold, &product.Active)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("remove product by id", zap.Error(err))
+		return ErrInternal
+	}
+
+	if err = outbox.Write(ctx, tx, product); err != nil {
+		logging.Ctx(ctx, s.logger).Error("remove product by id", zap.Error(err))
+		return ErrInternal
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("remove product by id", zap.Error(err))
 		return ErrInternal
 	}
 	return nil
@@ -319,21 +603,56 @@ func (s *Service) RemoveProductByID(ctx context.Context, id int64) (err error) {
 
 //RemoveCustomerByID ...
 func (s *Service) RemoveCustomerByID(ctx context.Context, id int64) (err error) {
+	ctx, span := tracer.Start(ctx, "managers.RemoveCustomerByID")
+	defer span.End()
 
 	_, err = s.db.Exec(ctx, `DELETE from customers where id = $1`, id)
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("remove customer by id", zap.Error(err))
 		return ErrInternal
 	}
 	return nil
 }
 
-//Customers ...
-func (s *Service) Customers(ctx context.Context) ([]*Customer, error) {
+//Customers returns a page of the active customers with their segments and tags ordered by id,
+//the segments are current like the ones of CustomerSummary
+func (s *Service) Customers(ctx context.Context, filter *CustomerFilter) ([]*Customer, error) {
+	ctx, span := tracer.Start(ctx, "managers.Customers")
+	defer span.End()
+
+	if filter.Segment != "" && !validSegment(filter.Segment) {
+		return nil, ErrInvalidSegment
+	}
+	tags, err := normalizeTags(filter.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultCustomersLimit
+	}
+	if filter.Limit > MaxCustomersLimit {
+		filter.Limit = MaxCustomersLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
 
 	items := make([]*Customer, 0)
-	sqlstmt := `select id, name, phone, active, created from customers where active = true order by id limit 500`
-	rows, err := s.db.Query(ctx, sqlstmt)
+	sqlstmt := `
+	select * from (
+		select c.id, c.name, c.phone, c.email, c.address, coalesce(c.group_id, 0), c.active, c.created,
+			` + segmentSQL("st") + ` segment, ` + tagsSQL("c") + ` tags
+		from customers c
+		left join (
+			select customer_id, min(created) first_sale, max(created) last_sale, count(*) sales
+			from sales where customer_id is not null group by customer_id
+		) st on st.customer_id = c.id
+		where c.active = true
+	) t
+	where ($1 = '' or segment = $1) and tags @> $2::text[]
+	order by id limit $3 offset $4`
+	rows, err := s.db.Query(ctx, sqlstmt, filter.Segment, tags, filter.Limit, filter.Offset)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return items, nil
@@ -344,9 +663,10 @@ func (s *Service) Customers(ctx context.Context) ([]*Customer, error) {
 
 	for rows.Next() {
 		item := &Customer{}
-		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Active, &item.Created)
+		err = rows.Scan(&item.ID, &item.Name, &item.Phone, &item.Email, &item.Address, &item.GroupID, &item.Active,
+			&item.Created, &item.Segment, &item.Tags)
 		if err != nil {
-			log.Print(err)
+			logging.Ctx(ctx, s.logger).Error("customers", zap.Error(err))
 			return nil, err
 		}
 		items = append(items, item)
@@ -355,14 +675,51 @@ func (s *Service) Customers(ctx context.Context) ([]*Customer, error) {
 	return items, nil
 }
 
+// CustomerChange changes a customer, the fields left out keep their values, a zero group_id removes the group
+// and an empty email or address clears it
+type CustomerChange struct {
+	ID      int64   `json:"id"`
+	Name    *string `json:"name"`
+	Phone   *string `json:"phone"`
+	Email   *string `json:"email"`
+	Address *string `json:"address"`
+	GroupID *int64  `json:"group_id"`
+	Active  *bool   `json:"active"`
+}
+
 //ChangeCustomer ...
-func (s *Service) ChangeCustomer(ctx context.Context, customer *Customer) (*Customer, error) {
+func (s *Service) ChangeCustomer(ctx context.Context, change *CustomerChange) (*Customer, error) {
+	ctx, span := tracer.Start(ctx, "managers.ChangeCustomer")
+	defer span.End()
 
-	sqlstmt := `update customers set name = $2, phone = $3, active = $4  where id = $1 returning name,phone,active`
+	var err error
+	if change.Email != nil {
+		email, err := normalizeEmail(*change.Email)
+		if err != nil {
+			return nil, err
+		}
+		change.Email = &email
+	}
+	if change.Address != nil {
+		address := strings.TrimSpace(*change.Address)
+		change.Address = &address
+	}
 
-	if err := s.db.QueryRow(ctx, sqlstmt, customer.ID, customer.Name, customer.Phone, customer.Active).
-		Scan(&customer.Name, &customer.Phone, &customer.Active); err != nil {
-		log.Print(err)
+	sqlstmt := `update customers set name = coalesce($2, name), phone = coalesce($3, phone), active = coalesce($4, active),
+		group_id = case when $5::bigint is null then group_id else nullif($5, 0) end,
+		email = coalesce($6, email), address = coalesce($7, address)
+	where id = $1 returning id,name,phone,email,address,coalesce(group_id, 0),active,created`
+
+	customer := &Customer{}
+	err = s.db.QueryRow(ctx, sqlstmt, change.ID, change.Name, change.Phone, change.Active, change.GroupID,
+		change.Email, change.Address).
+		Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Email, &customer.Address, &customer.GroupID,
+			&customer.Active, &customer.Created)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("change customer", zap.Error(err))
 		return nil, ErrInternal
 	}
 
@@ -0,0 +1,61 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// newDatabaseService uses TEST_DATABASE_URL, a database with the schema applied, the test is skipped without it
+func newDatabaseService(t *testing.T) *Service {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return NewService(pool, zap.NewNop())
+}
+
+func TestRemoveProductWithStock(t *testing.T) {
+	s := newDatabaseService(t)
+	ctx := context.Background()
+
+	product, err := s.SaveProduct(ctx, &Product{
+		SKU: fmt.Sprintf("T%d", time.Now().UnixNano()), Name: "Test", Price: money.New(1250, "TJS"), Qty: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RemoveProductByID(ctx, product.ID); err != nil {
+		t.Fatalf("remove a product with an opening movement: %v", err)
+	}
+
+	products, err := s.Products(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range products {
+		if item.ID == product.ID {
+			t.Errorf("removed product %d is listed", product.ID)
+		}
+	}
+	if _, err = s.Movements(ctx, product.ID, 0, 0); err != nil {
+		t.Errorf("movements of the removed product: %v", err)
+	}
+
+	if err = s.RemoveProductByID(ctx, -1); err != ErrNotFound {
+		t.Errorf("remove a missing product: %v", err)
+	}
+}
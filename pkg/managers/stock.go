@@ -0,0 +1,180 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/outbox"
+	"go.uber.org/zap"
+)
+
+// kinds of stock movements
+const (
+	MovementReceipt    = "receipt"
+	MovementSale       = "sale"
+	MovementReturn     = "return"
+	MovementAdjustment = "adjustment"
+	MovementWriteOff   = "write_off"
+)
+
+// page size of the movement history
+const (
+	DefaultMovementsLimit = 100
+	MaxMovementsLimit     = 500
+)
+
+// Movement is one entry of the stock ledger, Qty is the signed change of products.qty
+type Movement struct {
+	ID             int64     `json:"id"`
+	ProductID      int64     `json:"product_id"`
+	Kind           string    `json:"kind"`
+	Qty            int       `json:"qty"`
+	ManagerID      int64     `json:"manager_id"`
+	SalePositionID int64     `json:"sale_position_id"`
+	Comment        string    `json:"comment"`
+	Created        time.Time `json:"created"`
+}
+
+// checks that the sign of qty matches the kind of the movement
+func validMovement(movement *Movement) bool {
+	switch movement.Kind {
+	case MovementReceipt, MovementReturn:
+		return movement.Qty > 0
+	case MovementSale, MovementWriteOff:
+		return movement.Qty < 0
+	case MovementAdjustment:
+		return movement.Qty != 0
+	}
+	return false
+}
+
+// addMovement writes the movement to the ledger and applies it to products.qty inside tx
+func (s *Service) addMovement(ctx context.Context, tx pgx.Tx, movement *Movement) error {
+	if !validMovement(movement) {
+		return ErrInvalidMovement
+	}
+
+	var qty, reserved int
+	var threshold *int
+	// stock reserved by pending orders can't be taken by other movements
+	err := tx.QueryRow(ctx, `
+	update products set qty = qty + $1 where id = $2 and ($1 > 0 or qty + $1 >= reserved)
+	returning qty, reserved, reorder_threshold`,
+		movement.Qty, movement.ProductID).Scan(&qty, &reserved, &threshold)
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err = tx.QueryRow(ctx, `select exists(select 1 from products where id = $1)`, movement.ProductID).
+			Scan(&exists); err != nil {
+			logging.Ctx(ctx, s.logger).Error("add movement", zap.Error(err))
+			return ErrInternal
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return ErrNotEnoughStock
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add movement", zap.Error(err))
+		return ErrInternal
+	}
+
+	err = tx.QueryRow(ctx, `
+	insert into stock_movements (product_id, kind, qty, manager_id, sale_position_id, comment)
+	values ($1, $2, $3, nullif($4, 0), nullif($5, 0), $6) returning id, created`,
+		movement.ProductID, movement.Kind, movement.Qty, movement.ManagerID, movement.SalePositionID, movement.Comment).
+		Scan(&movement.ID, &movement.Created)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add movement", zap.Error(err))
+		return ErrInternal
+	}
+
+	err = outbox.Write(ctx, tx, &events.ProductStockChanged{
+		ProductID: movement.ProductID, MovementID: movement.ID, Kind: movement.Kind, Delta: movement.Qty,
+		Qty: qty, Reserved: reserved, Created: movement.Created,
+	})
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add movement", zap.Error(err))
+		return ErrInternal
+	}
+
+	available := qty - reserved
+	if threshold != nil && available-movement.Qty > *threshold && available <= *threshold {
+		return s.raiseAlert(ctx, tx, movement, *threshold, available)
+	}
+	return nil
+}
+
+// AddMovement posts a receipt, adjustment or write-off for a product
+func (s *Service) AddMovement(ctx context.Context, movement *Movement) (*Movement, error) {
+	ctx, span := tracer.Start(ctx, "managers.AddMovement")
+	defer span.End()
+
+	if movement.Kind == MovementSale || movement.Kind == MovementReturn {
+		return nil, ErrInvalidMovement
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("add movement", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer tx.Rollback(ctx)
+
+	if err = s.addMovement(ctx, tx, movement); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, s.logger).Error("add movement", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return movement, nil
+}
+
+// Movements returns a page of the movement history of the product, newest first.
+// limit defaults to DefaultMovementsLimit and is capped at MaxMovementsLimit.
+func (s *Service) Movements(ctx context.Context, productID int64, limit int, offset int) ([]*Movement, error) {
+	ctx, span := tracer.Start(ctx, "managers.Movements")
+	defer span.End()
+
+	if limit <= 0 {
+		limit = DefaultMovementsLimit
+	}
+	if limit > MaxMovementsLimit {
+		limit = MaxMovementsLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	items := make([]*Movement, 0)
+
+	rows, err := s.db.Query(ctx, `
+	select id, product_id, kind, qty, coalesce(manager_id, 0), coalesce(sale_position_id, 0), comment, created
+	from stock_movements where product_id = $1 order by id desc limit $2 offset $3`, productID, limit, offset)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("movements", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Movement{}
+		err = rows.Scan(&item.ID, &item.ProductID, &item.Kind, &item.Qty, &item.ManagerID,
+			&item.SalePositionID, &item.Comment, &item.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("movements", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("movements", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return items, nil
+}
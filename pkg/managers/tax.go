@@ -0,0 +1,109 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+// RateBase is 100% in basis points, the unit of tax rates
+const RateBase = 10000
+
+// TaxCategory sets the tax rate of its products, Inclusive means prices already contain the tax
+type TaxCategory struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Rate      int64     `json:"rate"`
+	Inclusive bool      `json:"inclusive"`
+	Created   time.Time `json:"created"`
+}
+
+// SalesTotal is the net, tax and gross sum of sales in one currency
+type SalesTotal struct {
+	Net   money.Money `json:"net"`
+	Tax   money.Money `json:"tax"`
+	Gross money.Money `json:"gross"`
+}
+
+// taxOf splits the amount of a sale position into net, tax and gross
+func taxOf(amount money.Money, rate int64, inclusive bool) (net, tax, gross money.Money, err error) {
+	if inclusive {
+		gross = amount
+		net, err = amount.MulDiv(RateBase, RateBase+rate)
+		if err != nil {
+			return
+		}
+		tax, err = gross.Sub(net)
+		return
+	}
+
+	net = amount
+	tax, err = amount.MulDiv(rate, RateBase)
+	if err != nil {
+		return
+	}
+	gross, err = net.Add(tax)
+	return
+}
+
+// TaxCategories ...
+func (s *Service) TaxCategories(ctx context.Context) ([]*TaxCategory, error) {
+	ctx, span := tracer.Start(ctx, "managers.TaxCategories")
+	defer span.End()
+
+	items := make([]*TaxCategory, 0)
+
+	rows, err := s.db.Query(ctx, `select id, name, rate, inclusive, created from tax_categories order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("tax categories", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &TaxCategory{}
+		if err = rows.Scan(&item.ID, &item.Name, &item.Rate, &item.Inclusive, &item.Created); err != nil {
+			logging.Ctx(ctx, s.logger).Error("tax categories", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("tax categories", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SaveTaxCategory creates or updates the category, the new rate applies to sales made afterwards
+func (s *Service) SaveTaxCategory(ctx context.Context, item *TaxCategory) (*TaxCategory, error) {
+	ctx, span := tracer.Start(ctx, "managers.SaveTaxCategory")
+	defer span.End()
+
+	if item.Rate < 0 || item.Rate > 10*RateBase {
+		return nil, ErrInvalidTaxRate
+	}
+
+	var err error
+	if item.ID == 0 {
+		err = s.db.QueryRow(ctx, `
+		insert into tax_categories (name, rate, inclusive) values ($1, $2, $3) returning id, created`,
+			item.Name, item.Rate, item.Inclusive).Scan(&item.ID, &item.Created)
+	} else {
+		err = s.db.QueryRow(ctx, `
+		update tax_categories set name = $2, rate = $3, inclusive = $4 where id = $1 returning created`,
+			item.ID, item.Name, item.Rate, item.Inclusive).Scan(&item.Created)
+	}
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("save tax category", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
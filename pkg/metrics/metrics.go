@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shodikhuja83/crud/pkg/money"
+)
+
+const namespace = "crud"
+
+// results of a login attempt
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// Metrics of the application, registered in their own registry
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	logins   *prometheus.CounterVec
+	sales    prometheus.Counter
+	revenue  *prometheus.CounterVec
+	jobs     *prometheus.CounterVec
+	jobTime  *prometheus.HistogramVec
+}
+
+// New creates the metrics and registers the collectors of the process, the go runtime and the pool
+func New(pool *pgxpool.Pool) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of http requests by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of http requests by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Number of login attempts by role and result.",
+		}, []string{"role", "result"}),
+		sales: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sales_total",
+			Help:      "Number of saved sales.",
+		}),
+		revenue: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sales_revenue_total",
+			Help:      "Gross revenue of saved sales in major units of the currency.",
+		}, []string{"currency"}),
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_runs_total",
+			Help:      "Number of runs of scheduled jobs by job and result.",
+		}, []string{"job", "result"}),
+		jobTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_duration_seconds",
+			Help:      "Duration of runs of scheduled jobs by job.",
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+		}, []string{"job"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+		newPoolCollector(pool),
+		m.requests, m.duration, m.logins, m.sales, m.revenue, m.jobs, m.jobTime,
+	)
+	return m
+}
+
+// Handler serves the metrics in the prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest counts the request to the route template
+func (m *Metrics) ObserveRequest(route string, method string, status int, duration time.Duration) {
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// ObserveLogin counts the login attempt of the role (customer or manager)
+func (m *Metrics) ObserveLogin(role string, err error) {
+	result := LoginSuccess
+	if err != nil {
+		result = LoginFailure
+	}
+	m.logins.WithLabelValues(role, result).Inc()
+}
+
+// ObserveSale counts the sale and adds its gross to the revenue
+func (m *Metrics) ObserveSale(gross money.Money) {
+	m.sales.Inc()
+	if gross.Currency == "" {
+		return
+	}
+	m.revenue.WithLabelValues(gross.Currency).Add(float64(gross.Amount) / math.Pow10(money.Exponent(gross.Currency)))
+}
+
+// ObserveJob counts the run of the scheduled job, runs skipped for the lock of another instance take no time
+func (m *Metrics) ObserveJob(job string, result string, duration time.Duration) {
+	m.jobs.WithLabelValues(job, result).Inc()
+	if result != "skipped" {
+		m.jobTime.WithLabelValues(job).Observe(duration.Seconds())
+	}
+}
@@ -0,0 +1,204 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for products saved without a currency
+const DefaultCurrency = "TJS"
+
+var ErrOverflow = errors.New("money overflow")
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+var ErrInvalidCurrency = errors.New("invalid currency")
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Money is an amount in minor units (dirams, cents) of the ISO 4217 currency
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// New ...
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// currencies which minor unit is not a hundredth
+var exponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// ValidCurrency checks that the code looks like an ISO 4217 code
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeCurrency upper-cases the code and falls back to DefaultCurrency when it is empty
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if !ValidCurrency(code) {
+		return "", ErrInvalidCurrency
+	}
+	return code, nil
+}
+
+// Add returns m + o, both must be in the same currency
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) || (o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o, both must be in the same currency
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Mul returns m * n
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	result := m.Amount * n
+	if result/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: result, Currency: m.Currency}, nil
+}
+
+// Percent returns percent hundredths of m rounded down
+func (m Money) Percent(percent int64) (Money, error) {
+	whole, err := Money{Amount: m.Amount / 100, Currency: m.Currency}.Mul(percent)
+	if err != nil {
+		return Money{}, err
+	}
+	// the remainder is below 100, so it can't overflow
+	return whole.Add(Money{Amount: m.Amount % 100 * percent / 100, Currency: m.Currency})
+}
+
+// MulDiv returns m * num / den rounded half away from zero, e.g. for rates in basis points
+func (m Money) MulDiv(num int64, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, ErrOverflow
+	}
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	quo, rem := new(big.Int).QuoRem(product, big.NewInt(den), new(big.Int))
+	// round half away from zero
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(new(big.Int).Abs(big.NewInt(den))) >= 0 {
+		if product.Sign()*big.NewInt(den).Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	if !quo.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: quo.Int64(), Currency: m.Currency}, nil
+}
+
+// FromDecimal parses an aggregate computed by postgres as numeric, e.g. sum(qty::numeric * price)
+func FromDecimal(value string, currency string) (Money, error) {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		if strings.Trim(value[i+1:], "0") != "" {
+			return Money{}, fmt.Errorf("fractional minor units %q", value)
+		}
+		value = value[:i]
+	}
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return Money{}, ErrOverflow
+	}
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Exponent returns the number of digits of the minor unit of the currency
+func Exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Parse parses an amount in major units, e.g. "12.50", with at most the digits of the minor unit of the currency
+func Parse(value string, currency string) (Money, error) {
+	value = strings.TrimSpace(value)
+	sign := int64(1)
+	if strings.HasPrefix(value, "-") {
+		sign, value = -1, value[1:]
+	}
+	whole, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		whole, fraction = value[:i], value[i+1:]
+	}
+	exp := Exponent(currency)
+	if whole == "" || len(fraction) > exp || strings.Trim(whole+fraction, "0123456789") != "" {
+		return Money{}, ErrInvalidAmount
+	}
+
+	digits := whole + fraction + strings.Repeat("0", exp-len(fraction))
+	amount, err := strconv.ParseUint(digits, 10, 64)
+	// the negative range is one longer, so math.MinInt64 parses back
+	if errors.Is(err, strconv.ErrRange) || amount > math.MaxInt64+1 || (sign > 0 && amount > math.MaxInt64) {
+		return Money{}, ErrOverflow
+	}
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+	if amount == math.MaxInt64+1 {
+		return Money{Amount: math.MinInt64, Currency: currency}, nil
+	}
+	return Money{Amount: sign * int64(amount), Currency: currency}, nil
+}
+
+// Decimal formats the amount in major units without the currency, e.g. "12.50"
+func (m Money) Decimal() string {
+	exp := Exponent(m.Currency)
+	sign := ""
+	amount := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		amount = uint64(-(m.Amount + 1)) + 1
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	div := uint64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/div, exp, amount%div)
+}
+
+// String formats m in major units, e.g. "12.50 TJS"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
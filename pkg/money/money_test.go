@@ -0,0 +1,188 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAddSub(t *testing.T) {
+	for _, c := range []struct {
+		a, b     Money
+		add, sub int64
+		addErr   error
+		subErr   error
+	}{
+		{New(1250, "TJS"), New(50, "TJS"), 1300, 1200, nil, nil},
+		{New(-5, "TJS"), New(-5, "TJS"), -10, 0, nil, nil},
+		{New(math.MaxInt64, "TJS"), New(1, "TJS"), 0, math.MaxInt64 - 1, ErrOverflow, nil},
+		{New(math.MinInt64, "TJS"), New(1, "TJS"), math.MinInt64 + 1, 0, nil, ErrOverflow},
+		{New(math.MinInt64, "TJS"), New(-1, "TJS"), 0, math.MinInt64 + 1, ErrOverflow, nil},
+		{New(0, "TJS"), New(math.MinInt64, "TJS"), math.MinInt64, 0, nil, ErrOverflow},
+		{New(1, "TJS"), New(1, "JPY"), 0, 0, ErrCurrencyMismatch, ErrCurrencyMismatch},
+	} {
+		sum, err := c.a.Add(c.b)
+		if err != c.addErr || (err == nil && sum != New(c.add, c.a.Currency)) {
+			t.Errorf("%v + %v = %v, %v, want %d, %v", c.a, c.b, sum, err, c.add, c.addErr)
+		}
+		diff, err := c.a.Sub(c.b)
+		if err != c.subErr || (err == nil && diff != New(c.sub, c.a.Currency)) {
+			t.Errorf("%v - %v = %v, %v, want %d, %v", c.a, c.b, diff, err, c.sub, c.subErr)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	for _, c := range []struct {
+		amount, n, want int64
+		err             error
+	}{
+		{1250, 3, 3750, nil},
+		{1250, 0, 0, nil},
+		{0, math.MaxInt64, 0, nil},
+		{-1250, 2, -2500, nil},
+		{math.MaxInt64, 2, 0, ErrOverflow},
+		{math.MaxInt64 / 2, 2, math.MaxInt64 - 1, nil},
+		{math.MinInt64, -1, 0, ErrOverflow},
+		{-1, math.MinInt64, 0, ErrOverflow},
+		{math.MinInt64, 1, math.MinInt64, nil},
+	} {
+		got, err := New(c.amount, "TJS").Mul(c.n)
+		if err != c.err || (err == nil && got != New(c.want, "TJS")) {
+			t.Errorf("%d * %d = %v, %v, want %d, %v", c.amount, c.n, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	for _, c := range []struct {
+		amount, percent, want int64
+		err                   error
+	}{
+		{1250, 10, 125, nil},
+		{1299, 15, 194, nil},
+		{99, 50, 49, nil},
+		{1250, 100, 1250, nil},
+		{math.MaxInt64, 100, math.MaxInt64, nil},
+		{math.MaxInt64, 200, 0, ErrOverflow},
+	} {
+		got, err := New(c.amount, "TJS").Percent(c.percent)
+		if err != c.err || (err == nil && got != New(c.want, "TJS")) {
+			t.Errorf("%d%% of %d = %v, %v, want %d, %v", c.percent, c.amount, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	for _, c := range []struct {
+		amount, num, den, want int64
+		err                    error
+	}{
+		{1000, 1800, 11800, 153, nil},
+		{1000, 1, 3, 333, nil},
+		{5, 1, 2, 3, nil},
+		{-5, 1, 2, -3, nil},
+		{5, -1, 2, -3, nil},
+		{5, 1, -2, -3, nil},
+		{7, 1, 4, 2, nil},
+		{math.MaxInt64, math.MaxInt64, math.MaxInt64, math.MaxInt64, nil},
+		{math.MaxInt64, 2, 1, 0, ErrOverflow},
+		{1, 1, 0, 0, ErrOverflow},
+	} {
+		got, err := New(c.amount, "TJS").MulDiv(c.num, c.den)
+		if err != c.err || (err == nil && got != New(c.want, "TJS")) {
+			t.Errorf("%d * %d / %d = %v, %v, want %d, %v", c.amount, c.num, c.den, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestFromDecimal(t *testing.T) {
+	for _, c := range []struct {
+		value string
+		want  int64
+		err   bool
+	}{
+		{"1250", 1250, false},
+		{" -1250.000 ", -1250, false},
+		{"9223372036854775807", math.MaxInt64, false},
+		{"9223372036854775808", 0, true},
+		{"12.5", 0, true},
+		{"abc", 0, true},
+	} {
+		got, err := FromDecimal(c.value, "TJS")
+		if (err != nil) != c.err || (err == nil && got != New(c.want, "TJS")) {
+			t.Errorf("FromDecimal(%q) = %v, %v, want %d", c.value, got, err, c.want)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		currency string
+		amount   int64
+		decimal  string
+	}{
+		{"12.50", "TJS", 1250, "12.50"},
+		{"12.5", "TJS", 1250, "12.50"},
+		{"12", "TJS", 1200, "12.00"},
+		{"0.05", "TJS", 5, "0.05"},
+		{"-0.05", "TJS", -5, "-0.05"},
+		{"1250", "JPY", 1250, "1250"},
+		{"-1250", "JPY", -1250, "-1250"},
+		{"1.250", "BHD", 1250, "1.250"},
+		{"1.25", "BHD", 1250, "1.250"},
+		{"92233720368547758.07", "TJS", math.MaxInt64, "92233720368547758.07"},
+		{"-92233720368547758.08", "TJS", math.MinInt64, "-92233720368547758.08"},
+		{"-9223372036854775808", "JPY", math.MinInt64, "-9223372036854775808"},
+	} {
+		got, err := Parse(c.value, c.currency)
+		if err != nil || got != New(c.amount, c.currency) {
+			t.Errorf("Parse(%q, %s) = %v, %v, want %d", c.value, c.currency, got, err, c.amount)
+			continue
+		}
+		if decimal := got.Decimal(); decimal != c.decimal {
+			t.Errorf("%d %s Decimal() = %q, want %q", c.amount, c.currency, decimal, c.decimal)
+		}
+	}
+	if s := New(1250, "TJS").String(); s != "12.50 TJS" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		currency string
+		err      error
+	}{
+		{"12.505", "TJS", ErrInvalidAmount},
+		{"12.5", "JPY", ErrInvalidAmount},
+		{"1.2345", "BHD", ErrInvalidAmount},
+		{"", "TJS", ErrInvalidAmount},
+		{"-", "TJS", ErrInvalidAmount},
+		{".50", "TJS", ErrInvalidAmount},
+		{"1,50", "TJS", ErrInvalidAmount},
+		{"+1", "TJS", ErrInvalidAmount},
+		{"--1", "TJS", ErrInvalidAmount},
+		{"92233720368547758.08", "TJS", ErrOverflow},
+		{"-92233720368547758.09", "TJS", ErrOverflow},
+		{"99999999999999999999999", "JPY", ErrOverflow},
+	} {
+		if got, err := Parse(c.value, c.currency); err != c.err {
+			t.Errorf("Parse(%q, %s) = %v, %v, want %v", c.value, c.currency, got, err, c.err)
+		}
+	}
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	for in, want := range map[string]string{"": DefaultCurrency, " usd ": "USD", "JPY": "JPY"} {
+		if got, err := NormalizeCurrency(in); err != nil || got != want {
+			t.Errorf("NormalizeCurrency(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"US", "USDT", "U$D"} {
+		if _, err := NormalizeCurrency(in); err != ErrInvalidCurrency {
+			t.Errorf("NormalizeCurrency(%q) = %v, want ErrInvalidCurrency", in, err)
+		}
+	}
+}
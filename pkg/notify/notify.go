@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/shodikhuja83/crud/pkg/notify")
+
+var ErrUnknownNotifier = errors.New("unknown notifier")
+var ErrDelivery = errors.New("notification not delivered")
+
+// kinds of notifiers
+const (
+	KindLog     = "log"
+	KindWebhook = "webhook"
+	KindEmail   = "email"
+)
+
+// Message is a notification for the staff, Data is sent along as json
+type Message struct {
+	Event   string      `json:"event"`
+	Subject string      `json:"subject"`
+	Text    string      `json:"text"`
+	Data    interface{} `json:"data,omitempty"`
+	Created time.Time   `json:"created"`
+}
+
+// Notifier delivers messages, an error means the message must be sent again
+type Notifier interface {
+	Notify(ctx context.Context, message *Message) error
+}
+
+// Config lists the notifiers by kind (comma separated), the webhook one posts to WebhookURL,
+// the email one writes to EmailTo
+type Config struct {
+	Notifiers  string
+	WebhookURL string
+	EmailTo    string
+}
+
+// New creates the notifiers of the config, log by default
+func New(config Config, logger *zap.Logger) (Notifier, error) {
+	kinds := strings.Split(config.Notifiers, ",")
+	if strings.TrimSpace(config.Notifiers) == "" {
+		kinds = []string{KindLog}
+	}
+
+	var notifiers Multi
+	for _, kind := range kinds {
+		switch strings.TrimSpace(kind) {
+		case KindLog:
+			notifiers = append(notifiers, NewLog(logger))
+		case KindWebhook:
+			if config.WebhookURL == "" {
+				return nil, fmt.Errorf("%w: webhook needs a url", ErrUnknownNotifier)
+			}
+			notifiers = append(notifiers, &Webhook{URL: config.WebhookURL, Client: &http.Client{Timeout: 10 * time.Second}})
+		case KindEmail:
+			if config.EmailTo == "" {
+				return nil, fmt.Errorf("%w: email needs a recipient", ErrUnknownNotifier)
+			}
+			notifiers = append(notifiers, NewEmail(strings.Split(config.EmailTo, ","), logger))
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownNotifier, kind)
+		}
+	}
+	if len(notifiers) == 1 {
+		return notifiers[0], nil
+	}
+	return notifiers, nil
+}
+
+// Multi sends the message to every notifier, failing if any of them fails
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, message *Message) error {
+	var errs []string
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, message); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%w: %s", ErrDelivery, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Log writes the message to the log as a warning
+type Log struct {
+	logger *zap.Logger
+}
+
+func NewLog(logger *zap.Logger) *Log {
+	return &Log{logger: logger}
+}
+
+func (l *Log) Notify(ctx context.Context, message *Message) error {
+	logging.Ctx(ctx, l.logger).Warn(message.Subject, zap.String("event", message.Event),
+		zap.String("text", message.Text), zap.Any("data", message.Data))
+	return nil
+}
+
+// Webhook posts the message as json, any status but 2xx is a failure
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *Webhook) Notify(ctx context.Context, message *Message) error {
+	ctx, span := tracer.Start(ctx, "notify.Webhook")
+	defer span.End()
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDelivery, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%w: webhook responded %s", ErrDelivery, res.Status)
+	}
+	return nil
+}
+
+// Email is a stub until a mail server is configured, it logs the email it would send
+type Email struct {
+	To     []string
+	logger *zap.Logger
+}
+
+func NewEmail(to []string, logger *zap.Logger) *Email {
+	return &Email{To: to, logger: logger}
+}
+
+func (e *Email) Notify(ctx context.Context, message *Message) error {
+	logging.Ctx(ctx, e.logger).Info("email not sent, no mail server", zap.Strings("to", e.To),
+		zap.String("subject", message.Subject), zap.String("text", message.Text))
+	return nil
+}
@@ -0,0 +1,167 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version of the OpenAPI specification the documents follow
+const Version = "3.0.3"
+
+// TokenAuth is the security scheme of the token in the Authorization header
+const TokenAuth = "token"
+
+// content types of responses
+const (
+	JSON = "application/json"
+	Text = "text/plain"
+	PDF  = "application/pdf"
+)
+
+var pathParameter = regexp.MustCompile(`{([^}:]+)(:[^}]+)?}`)
+
+// Route describes an operation of the api.
+// Request and Response are values of the bodies, nil when there is no body.
+type Route struct {
+	Method   string
+	Path     string
+	Summary  string
+	Tag      string
+	Auth     bool
+	Query    []*Parameter
+	Request  interface{}
+	Response interface{}
+	// Produces lists content types other than json the response may have
+	Produces []string
+	// Consumes lists content types of a request body that is a file instead of json
+	Consumes []string
+}
+
+// Builder collects routes into a document
+type Builder struct {
+	doc       *Document
+	schemas   *Schemas
+	errorBody *Schema
+}
+
+// NewBuilder creates a builder, errorBody is a value of the body of error responses
+func NewBuilder(title string, version string, errorBody interface{}) *Builder {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]*SecurityScheme{
+				TokenAuth: {Type: "apiKey", In: "header", Name: "Authorization", Description: "token from POST .../token"},
+			},
+		},
+	}
+	b := &Builder{doc: doc, schemas: &Schemas{components: doc.Components.Schemas}}
+	b.errorBody = b.schemas.Of(reflect.TypeOf(errorBody))
+	return b
+}
+
+// Add adds the operation of the route
+func (b *Builder) Add(route Route) {
+	operation := &Operation{
+		OperationID: operationID(route.Method, route.Path),
+		Summary:     route.Summary,
+		Responses:   make(map[string]*Response),
+	}
+	if route.Tag != "" {
+		operation.Tags = []string{route.Tag}
+	}
+	if route.Auth {
+		operation.Security = []map[string][]string{{TokenAuth: {}}}
+	}
+
+	for _, match := range pathParameter.FindAllStringSubmatch(route.Path, -1) {
+		operation.Parameters = append(operation.Parameters, &Parameter{
+			Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "integer", Format: "int64"},
+		})
+	}
+	operation.Parameters = append(operation.Parameters, route.Query...)
+
+	if route.Request != nil {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{JSON: {Schema: b.schemas.Of(reflect.TypeOf(route.Request))}},
+		}
+	}
+	if len(route.Consumes) > 0 {
+		operation.RequestBody = &RequestBody{Required: true, Content: make(map[string]*MediaType)}
+		for _, contentType := range route.Consumes {
+			operation.RequestBody.Content[contentType] = &MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+	}
+
+	success := &Response{Description: http.StatusText(http.StatusOK)}
+	if route.Response != nil {
+		success.Content = map[string]*MediaType{JSON: {Schema: b.schemas.Of(reflect.TypeOf(route.Response))}}
+	}
+	for _, contentType := range route.Produces {
+		if success.Content == nil {
+			success.Content = make(map[string]*MediaType)
+		}
+		success.Content[contentType] = &MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+	}
+	operation.Responses["200"] = success
+	for _, status := range errorStatuses(route) {
+		operation.Responses[status] = &Response{
+			Description: http.StatusText(statusCode(status)),
+			Content:     map[string]*MediaType{JSON: {Schema: b.errorBody}},
+		}
+	}
+
+	path := pathParameter.ReplaceAllString(route.Path, "{$1}")
+	item, ok := b.doc.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		b.doc.Paths[path] = item
+	}
+	item[strings.ToLower(route.Method)] = operation
+}
+
+// Document returns the built document
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+func errorStatuses(route Route) []string {
+	statuses := []string{"500"}
+	if route.Request != nil || len(route.Consumes) > 0 || len(route.Query) > 0 || strings.Contains(route.Path, "{") {
+		statuses = append(statuses, "400")
+	}
+	if route.Auth {
+		statuses = append(statuses, "403")
+	}
+	if strings.Contains(route.Path, "{") {
+		statuses = append(statuses, "404")
+	}
+	return statuses
+}
+
+func statusCode(status string) int {
+	code, _ := strconv.Atoi(status)
+	return code
+}
+
+// operationID makes an id like getApiManagersSalesById from the method and the path
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '-' || r == '.' }) {
+		if match := pathParameter.FindStringSubmatch(part); match != nil {
+			part = "by_" + match[1]
+		}
+		for _, word := range strings.Split(part, "_") {
+			if word != "" {
+				id += strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+	}
+	return id
+}
@@ -0,0 +1,60 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrDrift = errors.New("api spec and routes differ")
+
+// Verify compares the operations of the document with the routes registered on the router
+func Verify(doc *Document, router *mux.Router) error {
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	registered := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// path prefixes of subrouters have no methods
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		template = pathParameter.ReplaceAllString(template, "{$1}")
+		for _, method := range methods {
+			registered[method+" "+template] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for operation := range registered {
+		if !documented[operation] {
+			problems = append(problems, "not documented: "+operation)
+		}
+	}
+	for operation := range documented {
+		if !registered[operation] {
+			problems = append(problems, "not registered: "+operation)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%w: %s", ErrDrift, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/events"
+)
+
+// Channel is notified when the tx writing an event commits, the relay listens to it
+const Channel = "outbox_events"
+
+// Write adds the event to the outbox inside the tx of the change, so the event exists only if the change is committed
+func Write(ctx context.Context, tx pgx.Tx, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `insert into outbox_events (event, payload) values ($1, $2)`, event.EventName(), data)
+	if err != nil {
+		return err
+	}
+	// notifications are sent on commit and folded into one per tx and channel
+	_, err = tx.Exec(ctx, `select pg_notify($1, '')`, Channel)
+	return err
+}
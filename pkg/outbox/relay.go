@@ -0,0 +1,232 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/shodikhuja83/crud/pkg/outbox")
+
+const (
+	// the outbox is read on every notification and at least this often
+	pollInterval = 5 * time.Second
+	batchSize    = 100
+	// an event failing this many times is given up, so it doesn't hold back the events after it
+	MaxAttempts = 10
+)
+
+// Relay publishes the committed events of the outbox to the bus in order, a failed event
+// is published again with the events after it, so subscribers see every event at least once
+type Relay struct {
+	pool   *pgxpool.Pool
+	bus    *events.Bus
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRelay(pool *pgxpool.Pool, bus *events.Bus, logger *zap.Logger) *Relay {
+	return &Relay{pool: pool, bus: bus, logger: logger}
+}
+
+// Start publishes the events in the background until Stop
+func (r *Relay) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	wake := make(chan struct{}, 1)
+	go r.listen(ctx, wake)
+	go func() {
+		defer close(r.done)
+		r.run(ctx, wake)
+	}()
+}
+
+// Stop waits for the batch being published or for ctx
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Relay) run(ctx context.Context, wake <-chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			count, err := r.Publish(ctx)
+			if err != nil || count < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// listen wakes the relay up on the notifications of Write, polling covers the time it is reconnecting
+func (r *Relay) listen(ctx context.Context, wake chan<- struct{}) {
+	for ctx.Err() == nil {
+		err := r.wait(ctx, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Warn("listen to the outbox", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// wait listens on a connection of its own, outside the pool, so the relay doesn't hold one of the pool for its life
+func (r *Relay) wait(ctx context.Context, wake chan<- struct{}) error {
+	conn, err := pgx.ConnectConfig(ctx, r.pool.Config().ConnConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, `listen `+Channel); err != nil {
+		return err
+	}
+	for {
+		if _, err = conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// publish passes the event to the bus in a savepoint of tx, so the writes of failed subscribers are undone
+// and tx stays usable
+func (r *Relay) publish(ctx context.Context, tx pgx.Tx, envelope *events.Envelope) error {
+	var err error
+	if envelope.Event, err = events.Decode(envelope.Name, envelope.Payload); err != nil {
+		return err
+	}
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer savepoint.Rollback(ctx)
+
+	if err = r.bus.Publish(ctx, savepoint, envelope); err != nil {
+		return err
+	}
+	return savepoint.Commit(ctx)
+}
+
+// Publish publishes the next batch of events and returns how many were published
+func (r *Relay) Publish(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "outbox.Publish")
+	defer span.End()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		logging.Ctx(ctx, r.logger).Error("publish events", zap.Error(err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// events stay locked until they are marked, so instances publish different events
+	rows, err := tx.Query(ctx, `
+	select id, event, payload, attempts, created from outbox_events
+	where dispatched is null order by id limit $1 for update skip locked`, batchSize)
+	if err != nil {
+		logging.Ctx(ctx, r.logger).Error("publish events", zap.Error(err))
+		return 0, err
+	}
+	envelopes := make([]*events.Envelope, 0)
+	attempts := make([]int, 0)
+	for rows.Next() {
+		envelope := &events.Envelope{}
+		var attempt int
+		if err = rows.Scan(&envelope.ID, &envelope.Name, &envelope.Payload, &attempt, &envelope.Created); err != nil {
+			rows.Close()
+			logging.Ctx(ctx, r.logger).Error("publish events", zap.Error(err))
+			return 0, err
+		}
+		envelopes = append(envelopes, envelope)
+		attempts = append(attempts, attempt)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, r.logger).Error("publish events", zap.Error(err))
+		return 0, err
+	}
+
+	published := make([]int64, 0, len(envelopes))
+	var failed error
+	for i, envelope := range envelopes {
+		if failed = r.publish(ctx, tx, envelope); failed == nil {
+			published = append(published, envelope.ID)
+			continue
+		}
+
+		// the events after a failed one wait for it, unless it is given up
+		if attempts[i]+1 >= MaxAttempts {
+			logging.Ctx(ctx, r.logger).Error("event given up", zap.Int64("event_id", envelope.ID),
+				zap.String("event", envelope.Name), zap.Error(failed))
+		}
+		_, err = tx.Exec(ctx, `
+		update outbox_events set attempts = attempts + 1, last_error = $2,
+			dispatched = case when attempts + 1 >= $3 then current_timestamp end
+		where id = $1`, envelope.ID, failed.Error(), MaxAttempts)
+		if err != nil {
+			logging.Ctx(ctx, r.logger).Error("publish events", zap.Error(err))
+			return 0, err
+		}
+		break
+	}
+
+	if _, err = tx.Exec(ctx, `update outbox_events set dispatched = current_timestamp where id = any($1)`, published); err != nil {
+		logging.Ctx(ctx, r.logger).Error("publish events", zap.Error(err))
+		return 0, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		logging.Ctx(ctx, r.logger).Error("publish events", zap.Error(err))
+		return 0, err
+	}
+	if failed != nil {
+		return len(published), failed
+	}
+	return len(published), nil
+}
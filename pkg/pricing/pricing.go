@@ -0,0 +1,138 @@
+// Package pricing quotes the units of products from the price list of the customer group, the best automatic
+// discount and a promo code, so the sales of managers and the orders of customers are priced alike.
+package pricing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/money"
+)
+
+// kinds of discounts and promo codes, fixed values are minor units of their currency taken off the price of every unit
+const (
+	Percent = "percent"
+	Fixed   = "fixed"
+)
+
+// Quote of one unit of a product, Price is BasePrice less Discount.
+// TaxRate is in basis points, Inclusive tells whether the price includes the tax.
+type Quote struct {
+	BasePrice money.Money
+	Discount  money.Money
+	Price     money.Money
+	TaxRate   int64
+	Inclusive bool
+}
+
+// Promo is a promo code claimed by a sale or an order
+type Promo struct {
+	ID       int64
+	Kind     string
+	Value    int64
+	Currency string
+}
+
+// Unit quotes a unit of the product for the customer group, zero groupID is no group,
+// it returns pgx.ErrNoRows when there is no such product
+func Unit(ctx context.Context, tx pgx.Tx, productID int64, groupID int64) (*Quote, error) {
+	quote := &Quote{}
+	var kind, currency string
+	var value int64
+	err := tx.QueryRow(ctx, `
+	select coalesce(pl.price, p.price), p.currency, coalesce(d.kind, ''), coalesce(d.value, 0),
+		coalesce(d.currency, ''), coalesce(tc.rate, 0), coalesce(tc.inclusive, true)
+	from products p
+	left join tax_categories tc on tc.id = p.category_id
+	left join price_lists pl on pl.product_id = p.id and pl.group_id = $2
+	left join lateral (
+		select kind, value, currency from discounts
+		where active
+			and (kind = 'percent' or currency = p.currency)
+			and (product_id is null or product_id = p.id)
+			and (group_id is null or group_id = $2)
+			and (starts is null or starts <= current_timestamp)
+			and (ends is null or ends > current_timestamp)
+		order by case when kind = 'percent' then coalesce(pl.price, p.price)::numeric * value / 100 else value end desc
+		limit 1
+	) d on true
+	where p.id = $1`, productID, groupID).
+		Scan(&quote.BasePrice.Amount, &quote.BasePrice.Currency, &kind, &value, &currency, &quote.TaxRate, &quote.Inclusive)
+	if err != nil {
+		return nil, err
+	}
+
+	if quote.Discount, err = DiscountOf(quote.BasePrice, kind, value, currency); err != nil {
+		return nil, err
+	}
+	if quote.Price, err = quote.BasePrice.Sub(quote.Discount); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// Apply takes the promo code off the price after the discount
+func (q *Quote) Apply(promo *Promo) error {
+	discount, err := DiscountOf(q.Price, promo.Kind, promo.Value, promo.Currency)
+	if err != nil {
+		return err
+	}
+	if q.Discount, err = q.Discount.Add(discount); err != nil {
+		return err
+	}
+	q.Price, err = q.Price.Sub(discount)
+	return err
+}
+
+// Applies tells whether the promo code is worth anything in the currency, a fixed one only is in its own
+func (p *Promo) Applies(currency string) bool {
+	return p.Kind != Fixed || p.Currency == currency
+}
+
+// ClaimPromoCode counts a use of the code, nil when it is unknown, inactive, out of its dates or used up
+func ClaimPromoCode(ctx context.Context, tx pgx.Tx, code string) (*Promo, error) {
+	promo := &Promo{}
+	err := tx.QueryRow(ctx, `
+	update promo_codes set used = used + 1
+	where code = $1 and active
+		and (starts is null or starts <= current_timestamp)
+		and (ends is null or ends > current_timestamp)
+		and (usage_limit = 0 or used < usage_limit)
+	returning id, kind, value, coalesce(currency, '')`, strings.TrimSpace(code)).
+		Scan(&promo.ID, &promo.Kind, &promo.Value, &promo.Currency)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return promo, nil
+}
+
+// ReleasePromoCode takes back the use of the promo code counted by ClaimPromoCode
+func ReleasePromoCode(ctx context.Context, tx pgx.Tx, id int64) error {
+	_, err := tx.Exec(ctx, `update promo_codes set used = used - 1 where id = $1 and used > 0`, id)
+	return err
+}
+
+// DiscountOf returns the discount of one unit of the price, a fixed discount in another currency gives none
+func DiscountOf(price money.Money, kind string, value int64, currency string) (money.Money, error) {
+	discount := money.New(0, price.Currency)
+	var err error
+	switch kind {
+	case Percent:
+		discount, err = price.Percent(value)
+	case Fixed:
+		if currency == price.Currency {
+			discount.Amount = value
+		}
+	}
+	if err != nil {
+		return money.Money{}, err
+	}
+	if discount.Amount > price.Amount {
+		return price, nil
+	}
+	return discount, nil
+}
@@ -0,0 +1,56 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/shodikhuja83/crud/pkg/money"
+)
+
+func TestDiscountOf(t *testing.T) {
+	for _, c := range []struct {
+		price    money.Money
+		kind     string
+		value    int64
+		currency string
+		want     int64
+	}{
+		{money.New(1250, "TJS"), Percent, 10, "", 125},
+		{money.New(1250, "TJS"), Fixed, 100, "TJS", 100},
+		{money.New(1250, "JPY"), Fixed, 100, "TJS", 0},
+		{money.New(12500, "BHD"), Fixed, 100, "TJS", 0},
+		{money.New(50, "TJS"), Fixed, 100, "TJS", 50},
+	} {
+		got, err := DiscountOf(c.price, c.kind, c.value, c.currency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Amount != c.want || got.Currency != c.price.Currency {
+			t.Errorf("DiscountOf(%v, %s, %d, %q) = %v, want %d", c.price, c.kind, c.value, c.currency, got, c.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, c := range []struct {
+		promo    *Promo
+		discount int64
+		price    int64
+	}{
+		{&Promo{ID: 1, Kind: Percent, Value: 10}, 200 + 180, 1620},
+		{&Promo{ID: 1, Kind: Fixed, Value: 100, Currency: "TJS"}, 300, 1700},
+		{&Promo{ID: 1, Kind: Fixed, Value: 5000, Currency: "TJS"}, 2000, 0},
+		{&Promo{ID: 1, Kind: Fixed, Value: 100, Currency: "JPY"}, 200, 1800},
+	} {
+		// the promo code is taken off the price after the discount
+		quote := &Quote{BasePrice: money.New(2000, "TJS"), Discount: money.New(200, "TJS"), Price: money.New(1800, "TJS")}
+		if err := quote.Apply(c.promo); err != nil {
+			t.Fatal(err)
+		}
+		if quote.Discount != money.New(c.discount, "TJS") || quote.Price != money.New(c.price, "TJS") {
+			t.Errorf("%+v: discount %v, price %v, want %d, %d", c.promo, quote.Discount, quote.Price, c.discount, c.price)
+		}
+		if applies := c.promo.Applies("TJS"); applies != (c.promo.Currency != "JPY") {
+			t.Errorf("%+v applies to TJS: %v", c.promo, applies)
+		}
+	}
+}
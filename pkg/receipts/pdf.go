@@ -0,0 +1,81 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// layout of the pdf page in points, Courier glyphs are 0.6 of the font size wide
+const (
+	pdfFontSize   = 9
+	pdfLineHeight = 11
+	pdfMargin     = 14
+)
+
+// WritePDF writes the receipt as a one page pdf shaped like a receipt roll.
+// It uses the standard Courier font, so cyrillic names are transliterated before the layout
+// and the other characters outside of Latin-1 are printed as '?'.
+func WritePDF(w io.Writer, receipt *Receipt, width int) error {
+	lines := textLines(latinReceipt(receipt), width)
+	if width < NarrowWidth {
+		width = NarrowWidth
+	}
+
+	pageWidth := pdfMargin*2 + width*pdfFontSize*6/10
+	pageHeight := pdfMargin*2 + len(lines)*pdfLineHeight
+
+	content := &bytes.Buffer{}
+	// every ' moves to the next line before showing it, so start a line above the first one
+	fmt.Fprintf(content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pageHeight-pdfMargin)
+	for _, line := range lines {
+		fmt.Fprintf(content, "(%s) '\n", pdfString(line))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+			pageWidth, pageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfString escapes the text for a pdf string literal in WinAnsiEncoding
+func pdfString(s string) string {
+	buf := &bytes.Buffer{}
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r >= 32 && r < 127:
+			buf.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(buf, "\\%03o", r)
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,163 @@
+package receipts
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"github.com/shodikhuja83/crud/pkg/money"
+	"go.uber.org/zap"
+)
+
+var ErrNotFound = errors.New("item not found")
+var ErrInternal = errors.New("internal error")
+
+// Service builds receipts of saved sales
+type Service struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+}
+
+func NewService(pool *pgxpool.Pool, logger *zap.Logger) *Service {
+	return &Service{pool: pool, logger: logger}
+}
+
+// Receipt of a sale, amounts of lines are totals of the line
+type Receipt struct {
+	SaleID       int64       `json:"sale_id"`
+	Created      time.Time   `json:"created"`
+	ManagerID    int64       `json:"manager_id"`
+	ManagerName  string      `json:"manager_name"`
+	CustomerID   int64       `json:"customer_id"`
+	CustomerName string      `json:"customer_name"`
+	Lines        []*Line     `json:"lines"`
+	Taxes        []*TaxLine  `json:"taxes"`
+	Net          money.Money `json:"net"`
+	Tax          money.Money `json:"tax"`
+	Gross        money.Money `json:"gross"`
+	Returned     money.Money `json:"returned"`
+}
+
+// Line ...
+type Line struct {
+	ProductID int64       `json:"product_id"`
+	Name      string      `json:"name"`
+	Qty       int         `json:"qty"`
+	Price     money.Money `json:"price"`
+	Discount  money.Money `json:"discount"`
+	TaxRate   int64       `json:"tax_rate"`
+	Net       money.Money `json:"net"`
+	Tax       money.Money `json:"tax"`
+	Gross     money.Money `json:"gross"`
+}
+
+// TaxLine is the tax of all lines with the same rate, Rate is in basis points
+type TaxLine struct {
+	Rate int64       `json:"rate"`
+	Net  money.Money `json:"net"`
+	Tax  money.Money `json:"tax"`
+}
+
+// ByID builds the receipt of the sale
+func (s *Service) ByID(ctx context.Context, saleID int64) (*Receipt, error) {
+	item := &Receipt{}
+
+	err := s.pool.QueryRow(ctx, `
+	SELECT s.id, s.created, s.manager_id, m.name, s.customer_id, coalesce(c.name, '')
+	FROM sales s
+	JOIN managers m ON m.id = s.manager_id
+	LEFT JOIN customers c ON c.id = s.customer_id
+	WHERE s.id = $1
+	`, saleID).Scan(&item.SaleID, &item.Created, &item.ManagerID, &item.ManagerName, &item.CustomerID, &item.CustomerName)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("by id", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	rows, err := s.pool.Query(ctx, `
+	SELECT sp.product_id, p.name, sp.qty, sp.price, sp.discount, sp.currency, sp.tax_rate, sp.net, sp.tax, sp.gross,
+		coalesce((SELECT sum(rp.gross) FROM sales_returns_positions rp WHERE rp.sale_position_id = sp.id), 0)
+	FROM sales_positions sp
+	JOIN products p ON p.id = sp.product_id
+	WHERE sp.sale_id = $1
+	ORDER BY sp.id
+	`, saleID)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("by id", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line := &Line{}
+		var currency string
+		var returned int64
+		err = rows.Scan(&line.ProductID, &line.Name, &line.Qty, &line.Price.Amount, &line.Discount.Amount, &currency,
+			&line.TaxRate, &line.Net.Amount, &line.Tax.Amount, &line.Gross.Amount, &returned)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("by id", zap.Error(err))
+			return nil, ErrInternal
+		}
+		line.Price.Currency = currency
+		line.Discount.Currency = currency
+		line.Net.Currency = currency
+		line.Tax.Currency = currency
+		line.Gross.Currency = currency
+
+		if err = item.add(line, money.New(returned, currency)); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("by id", zap.Error(err))
+		return nil, ErrInternal
+	}
+
+	return item, nil
+}
+
+// add appends the line and sums it into the totals of the receipt
+func (r *Receipt) add(line *Line, returned money.Money) error {
+	if len(r.Lines) == 0 {
+		r.Net = money.New(0, line.Gross.Currency)
+		r.Tax = money.New(0, line.Gross.Currency)
+		r.Gross = money.New(0, line.Gross.Currency)
+		r.Returned = money.New(0, line.Gross.Currency)
+	}
+	r.Lines = append(r.Lines, line)
+
+	var err error
+	if r.Net, err = r.Net.Add(line.Net); err != nil {
+		return err
+	}
+	if r.Tax, err = r.Tax.Add(line.Tax); err != nil {
+		return err
+	}
+	if r.Gross, err = r.Gross.Add(line.Gross); err != nil {
+		return err
+	}
+	if r.Returned, err = r.Returned.Add(returned); err != nil {
+		return err
+	}
+
+	if line.TaxRate == 0 {
+		return nil
+	}
+	for _, tax := range r.Taxes {
+		if tax.Rate == line.TaxRate {
+			if tax.Net, err = tax.Net.Add(line.Net); err != nil {
+				return err
+			}
+			tax.Tax, err = tax.Tax.Add(line.Tax)
+			return err
+		}
+	}
+	r.Taxes = append(r.Taxes, &TaxLine{Rate: line.TaxRate, Net: line.Net, Tax: line.Tax})
+	return nil
+}
@@ -0,0 +1,127 @@
+package receipts
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shodikhuja83/crud/pkg/money"
+)
+
+// widths of 58mm and 80mm thermal printers in characters
+const (
+	NarrowWidth = 32
+	WideWidth   = 42
+)
+
+// WriteText writes the receipt as fixed-width text for thermal printers
+func WriteText(w io.Writer, receipt *Receipt, width int) error {
+	for _, line := range textLines(receipt, width) {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textLines lays the receipt out in lines of at most width characters
+func textLines(receipt *Receipt, width int) []string {
+	if width < NarrowWidth {
+		width = NarrowWidth
+	}
+	separator := strings.Repeat("-", width)
+
+	lines := []string{
+		center(fmt.Sprintf("SALE #%d", receipt.SaleID), width),
+		center(receipt.Created.Format("2006-01-02 15:04:05"), width),
+		cut("Manager: "+receipt.ManagerName, width),
+	}
+	if receipt.CustomerName != "" {
+		lines = append(lines, cut("Customer: "+receipt.CustomerName, width))
+	}
+	lines = append(lines, separator)
+
+	for _, line := range receipt.Lines {
+		lines = append(lines, wrap(line.Name, width)...)
+		lines = append(lines, spread(fmt.Sprintf("  %d x %s", line.Qty, amount(line.Price)), amount(line.Gross), width))
+		if line.Discount.Amount != 0 {
+			lines = append(lines, cut(fmt.Sprintf("  discount -%s each", amount(line.Discount)), width))
+		}
+	}
+
+	lines = append(lines, separator)
+	lines = append(lines, spread("Net", amount(receipt.Net), width))
+	for _, tax := range receipt.Taxes {
+		lines = append(lines, spread("Tax "+Rate(tax.Rate)+" of "+amount(tax.Net), amount(tax.Tax), width))
+	}
+	lines = append(lines, spread("Tax", amount(receipt.Tax), width))
+	lines = append(lines, spread("TOTAL", receipt.Gross.String(), width))
+	if receipt.Returned.Amount != 0 {
+		lines = append(lines, spread("Returned", receipt.Returned.String(), width))
+	}
+	return lines
+}
+
+// Rate formats a rate in basis points as percents
+func Rate(rate int64) string {
+	return fmt.Sprintf("%d.%02d%%", rate/100, rate%100)
+}
+
+// amount formats money without the currency code
+func amount(m money.Money) string {
+	return strings.TrimSuffix(m.String(), " "+m.Currency)
+}
+
+func center(s string, width int) string {
+	s = cut(s, width)
+	return strings.Repeat(" ", (width-utf8.RuneCountInString(s))/2) + s
+}
+
+// spread puts left and right on the edges of the line, left is cut when they don't fit
+func spread(left, right string, width int) string {
+	left = cut(left, width-utf8.RuneCountInString(right)-1)
+	pad := width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if pad < 1 {
+		pad = 1
+	}
+	return left + strings.Repeat(" ", pad) + right
+}
+
+func cut(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// wrap splits s into lines of at most width characters
+func wrap(s string, width int) []string {
+	lines := make([]string, 0)
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for utf8.RuneCountInString(word) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, string([]rune(word)[:width]))
+			word = string([]rune(word)[width:])
+		}
+		if line == "" {
+			line = word
+		} else if utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width {
+			line += " " + word
+		} else {
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
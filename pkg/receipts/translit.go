@@ -0,0 +1,46 @@
+package receipts
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latin spells the cyrillic letters of russian and tajik in latin ones, lowercase
+var latin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya",
+	'ғ': "gh", 'ӣ': "i", 'қ': "q", 'ӯ': "u", 'ҳ': "h", 'ҷ': "j",
+}
+
+// transliterate spells the cyrillic letters of s in latin ones and keeps the other characters
+func transliterate(s string) string {
+	buf := &strings.Builder{}
+	for _, r := range s {
+		spelled, ok := latin[unicode.ToLower(r)]
+		if !ok {
+			buf.WriteRune(r)
+			continue
+		}
+		if unicode.IsUpper(r) && spelled != "" {
+			spelled = strings.ToUpper(spelled[:1]) + spelled[1:]
+		}
+		buf.WriteString(spelled)
+	}
+	return buf.String()
+}
+
+// latinReceipt returns a copy of the receipt with the names transliterated
+func latinReceipt(receipt *Receipt) *Receipt {
+	copied := *receipt
+	copied.ManagerName = transliterate(receipt.ManagerName)
+	copied.CustomerName = transliterate(receipt.CustomerName)
+	copied.Lines = make([]*Line, len(receipt.Lines))
+	for i, line := range receipt.Lines {
+		copiedLine := *line
+		copiedLine.Name = transliterate(line.Name)
+		copied.Lines[i] = &copiedLine
+	}
+	return &copied
+}
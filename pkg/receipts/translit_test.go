@@ -0,0 +1,34 @@
+package receipts
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTransliterate(t *testing.T) {
+	for in, want := range map[string]string{
+		"Қаҳваи сиёҳ":    "Qahvai siyoh",
+		"Щи, Объём 0.5л": "Shchi, Obyom 0.5l",
+		"Ҷӯраев Ғ.":      "Juraev Gh.",
+		"Café 42":        "Café 42",
+	} {
+		if got := transliterate(in); got != want {
+			t.Errorf("transliterate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWritePDFCyrillic(t *testing.T) {
+	receipt := &Receipt{SaleID: 1, ManagerName: "Иван", CustomerName: "Мария", Lines: []*Line{{Name: "Чай зелёный", Qty: 1}}}
+	out := &bytes.Buffer{}
+	if err := WritePDF(out, receipt, NarrowWidth); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Chay zelyonyy") {
+		t.Errorf("pdf has no transliterated product name:\n%s", out.String())
+	}
+	if receipt.Lines[0].Name != "Чай зелёный" {
+		t.Errorf("receipt changed to %q", receipt.Lines[0].Name)
+	}
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func at(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNext(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"*/15 * * * *", "2026-10-19 10:07:30", "2026-10-19 10:15:00"},
+		{"*/15 * * * *", "2026-10-19 10:45:00", "2026-10-19 11:00:00"},
+		{"5,35 * * * *", "2026-10-19 10:05:00", "2026-10-19 10:35:00"},
+		{"10-12 3 * * *", "2026-10-19 03:12:00", "2026-10-20 03:10:00"},
+		{"0 9-17/4 * * *", "2026-10-19 13:00:00", "2026-10-19 17:00:00"},
+		{"0 9-17/4 * * *", "2026-10-19 17:00:00", "2026-10-20 09:00:00"},
+		{"30 9 * * 1-5", "2026-10-16 10:00:00", "2026-10-19 09:30:00"},
+		{"0 12 * * 7", "2026-10-19 00:00:00", "2026-10-25 12:00:00"},
+		{"0 12 * * 0", "2026-10-19 00:00:00", "2026-10-25 12:00:00"},
+		// restricted day of month and day of week are or'ed
+		{"0 0 13 * 5", "2026-10-10 12:00:00", "2026-10-13 00:00:00"},
+		{"0 0 13 * 5", "2026-10-13 12:00:00", "2026-10-16 00:00:00"},
+		{"0 0 13 * *", "2026-10-14 00:00:00", "2026-11-13 00:00:00"},
+		// a field starting with * counts as unrestricted, so they are and'ed, like in cron
+		{"0 0 */10 * 5", "2026-10-19 00:00:00", "2026-12-11 00:00:00"},
+		{"0 0 1 * *", "2026-01-31 12:00:00", "2026-02-01 00:00:00"},
+		{"0 0 31 * *", "2026-04-01 00:00:00", "2026-05-31 00:00:00"},
+		{"@yearly", "2026-12-15 00:00:00", "2027-01-01 00:00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"@daily", "2026-12-31 23:59:59", "2027-01-01 00:00:00"},
+		{"@hourly", "2026-10-19 10:00:00", "2026-10-19 11:00:00"},
+		{"@weekly", "2026-10-19 10:00:00", "2026-10-25 00:00:00"},
+		{"@monthly", "2026-12-01 00:00:00", "2027-01-01 00:00:00"},
+		{"@every 15m", "2026-10-19 10:07:30", "2026-10-19 10:15:00"},
+		{"@every 1h", "2026-10-19 10:00:00", "2026-10-19 11:00:00"},
+	} {
+		schedule, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.spec, err)
+			continue
+		}
+		if got := schedule.Next(at(c.from)); !got.Equal(at(c.want)) {
+			t.Errorf("%q after %s = %s, want %s", c.spec, c.from, got, c.want)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schedule.Next(at("2026-10-19 00:00:00")); !got.IsZero() {
+		t.Errorf("february 30th = %s", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1- * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@often",
+		"@every",
+		"@every 1ms",
+		"@every soon",
+	} {
+		if _, err := Parse(spec); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("Parse(%q) = %v, want ErrInvalidSchedule", spec, err)
+		}
+	}
+}
+
+func TestEveryAligned(t *testing.T) {
+	schedule, err := Parse("@every 10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// instances started at different times get the same ticks
+	for _, from := range []string{"2026-10-19 10:00:01", "2026-10-19 10:04:00", "2026-10-19 10:09:59"} {
+		if got := schedule.Next(at(from)); !got.Equal(at("2026-10-19 10:10:00")) {
+			t.Errorf("after %s = %s", from, got)
+		}
+	}
+}
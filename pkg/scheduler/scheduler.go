@@ -0,0 +1,312 @@
+// Package scheduler runs jobs on cron schedules on every instance of the service.
+//
+// A run doesn't take a Postgres advisory lock: a session lock would hold a pool connection for the
+// whole run, and a transaction lock would run the job inside its transaction. Instead a run claims the
+// tick of its job in scheduled_jobs with one statement that takes a lease, so a job runs on one instance
+// at a time, every tick runs once, and the job of an instance that died is taken over after the Lease.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/shodikhuja83/crud/pkg/scheduler")
+
+var ErrDuplicateJob = errors.New("job already added")
+var ErrStarted = errors.New("scheduler already started")
+
+// results of a run
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// another instance runs the job or has run the tick
+	ResultSkipped = "skipped"
+)
+
+// Lease is how long a run holds its job, the run is cancelled after it,
+// so another instance takes the job over when one dies while running it
+const Lease = 10 * time.Minute
+
+// Job is the work of a scheduled job, ctx is cancelled when the scheduler stops
+type Job func(ctx context.Context) error
+
+// ObserveFunc is called after every run of a job
+type ObserveFunc func(job string, result string, duration time.Duration)
+
+// Status of a job, the last run is the last one of any instance
+type Status struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	Next         time.Time  `json:"next"`
+	LastStarted  *time.Time `json:"last_started"`
+	LastFinished *time.Time `json:"last_finished"`
+	LastResult   string     `json:"last_result"`
+	LastError    string     `json:"last_error"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	run      Job
+
+	// guarded by Scheduler.mu
+	running bool
+	next    time.Time
+}
+
+// Scheduler runs the jobs on their schedules, a run claims its tick in scheduled_jobs with a lease,
+// so a job runs on one instance at a time and every tick once
+type Scheduler struct {
+	pool    *pgxpool.Pool
+	logger  *zap.Logger
+	observe ObserveFunc
+
+	mu     sync.Mutex
+	jobs   []*job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates the scheduler, observe may be nil
+func New(pool *pgxpool.Pool, logger *zap.Logger, observe ObserveFunc) *Scheduler {
+	return &Scheduler{pool: pool, logger: logger, observe: observe}
+}
+
+// Add schedules the job, spec is parsed by Parse
+func (s *Scheduler) Add(name string, spec string, run Job) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return ErrStarted
+	}
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+		}
+	}
+	s.jobs = append(s.jobs, &job{name: name, spec: spec, schedule: schedule, run: run})
+	return nil
+}
+
+// Start runs every job in its own goroutine until Stop
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+	s.logger.Info("scheduler started", zap.Int("jobs", len(s.jobs)))
+}
+
+// Stop cancels the running jobs and waits for them to return or for ctx
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warn("job has no next run", zap.String("job", j.name))
+			return
+		}
+		s.mu.Lock()
+		j.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.runJob(ctx, j, next)
+	}
+}
+
+// runJob runs the tick of the job unless another instance has claimed it and records the result
+func (s *Scheduler) runJob(ctx context.Context, j *job, tick time.Time) {
+	ctx, span := tracer.Start(ctx, "scheduler."+j.name)
+	defer span.End()
+	logger := logging.Ctx(ctx, s.logger).With(zap.String("job", j.name))
+
+	s.mu.Lock()
+	j.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		j.running = false
+		s.mu.Unlock()
+	}()
+
+	started := time.Now()
+	result, err := s.claimed(ctx, j, tick)
+	duration := time.Since(started)
+	span.SetAttributes(attribute.String("job.result", result))
+
+	switch result {
+	case ResultSkipped:
+		logger.Debug("job claimed by another instance")
+	case ResultFailure:
+		span.SetStatus(codes.Error, err.Error())
+		logger.Error("job failed", zap.Duration("duration", duration), zap.Error(err))
+	default:
+		logger.Debug("job finished", zap.Duration("duration", duration))
+	}
+	if s.observe != nil {
+		s.observe(j.name, result, duration)
+	}
+}
+
+// claimed runs the job when it claims the tick, the claim is a single statement,
+// so no connection is held while the job runs and takes connections of its own
+func (s *Scheduler) claimed(ctx context.Context, j *job, tick time.Time) (string, error) {
+	started := time.Now()
+	tag, err := s.pool.Exec(ctx, `
+	insert into scheduled_jobs (name, last_tick, last_started, locked_until)
+	values ($1, $2, $3, current_timestamp + $4::float8 * interval '1 second')
+	on conflict (name) do update set last_tick = excluded.last_tick, last_started = excluded.last_started,
+		locked_until = excluded.locked_until
+	where (scheduled_jobs.last_tick is null or scheduled_jobs.last_tick < excluded.last_tick)
+		and (scheduled_jobs.locked_until is null or scheduled_jobs.locked_until < current_timestamp)`,
+		j.name, tick, started, Lease.Seconds())
+	if err != nil {
+		return ResultFailure, err
+	}
+	if tag.RowsAffected() == 0 {
+		return ResultSkipped, nil
+	}
+
+	runCtx, cancelRun := context.WithTimeout(ctx, Lease)
+	runErr := j.run(runCtx)
+	cancelRun()
+	result, message := ResultSuccess, ""
+	if runErr != nil {
+		result, message = ResultFailure, runErr.Error()
+	}
+
+	// ctx may be cancelled already, the lease must be released anyway
+	recordCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = s.pool.Exec(recordCtx, `
+	update scheduled_jobs set last_finished = current_timestamp, last_result = $2, last_error = $3, locked_until = null,
+		runs = runs + 1, failures = failures + case when $2 = 'failure' then 1 else 0 end
+	where name = $1`, j.name, result, message)
+	if err != nil {
+		s.logger.Warn("record job run", zap.String("job", j.name), zap.Error(err))
+	}
+	return result, runErr
+}
+
+// Jobs returns the status of the jobs sorted by name
+func (s *Scheduler) Jobs(ctx context.Context) ([]*Status, error) {
+	ctx, span := tracer.Start(ctx, "scheduler.Jobs")
+	defer span.End()
+
+	s.mu.Lock()
+	items := make([]*Status, 0, len(s.jobs))
+	byName := make(map[string]*Status, len(s.jobs))
+	names := make([]string, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := &Status{Name: j.name, Schedule: j.spec, Running: j.running, Next: j.next}
+		items = append(items, status)
+		byName[j.name] = status
+		names = append(names, j.name)
+	}
+	s.mu.Unlock()
+
+	rows, err := s.pool.Query(ctx, `
+	select name, last_started, last_finished, last_result, last_error, runs, failures
+	from scheduled_jobs where name = any($1)`, names)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("jobs", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var item Status
+		err = rows.Scan(&name, &item.LastStarted, &item.LastFinished, &item.LastResult, &item.LastError, &item.Runs, &item.Failures)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("jobs", zap.Error(err))
+			return nil, err
+		}
+		status := byName[name]
+		status.LastStarted, status.LastFinished = item.LastStarted, item.LastFinished
+		status.LastResult, status.LastError = item.LastResult, item.LastError
+		status.Runs, status.Failures = item.Runs, item.Failures
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("jobs", zap.Error(err))
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// Handler serves the status of the jobs as json
+func (s *Scheduler) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		items, err := s.Jobs(r.Context())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(items)
+	})
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// newDatabaseScheduler uses TEST_DATABASE_URL, a database with the schema applied, the test is skipped without it
+func newDatabaseScheduler(t *testing.T) *Scheduler {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return New(pool, zap.NewNop(), nil)
+}
+
+func TestClaimTick(t *testing.T) {
+	s := newDatabaseScheduler(t)
+	ctx := context.Background()
+	name := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		s.pool.Exec(context.Background(), `delete from scheduled_jobs where name = $1`, name)
+	})
+
+	tick := time.Now().UTC().Truncate(time.Minute)
+	other := &job{name: name, run: func(ctx context.Context) error {
+		t.Error("ran a claimed tick")
+		return nil
+	}}
+	j := &job{name: name, run: func(ctx context.Context) error {
+		// the lease keeps other instances off the job while it runs, even on a later tick
+		if result, err := s.claimed(ctx, other, tick.Add(time.Minute)); result != ResultSkipped {
+			t.Errorf("claim of a leased job = %s, %v", result, err)
+		}
+		return nil
+	}}
+
+	if result, err := s.claimed(ctx, j, tick); result != ResultSuccess || err != nil {
+		t.Fatalf("first claim = %s, %v", result, err)
+	}
+	for _, claim := range []time.Time{tick, tick.Add(-time.Minute)} {
+		if result, err := s.claimed(ctx, other, claim); result != ResultSkipped || err != nil {
+			t.Errorf("claim of the tick %s after the run = %s, %v", claim, result, err)
+		}
+	}
+
+	failed := errors.New("failed")
+	j.run = func(ctx context.Context) error { return failed }
+	if result, err := s.claimed(ctx, j, tick.Add(time.Minute)); result != ResultFailure || err != failed {
+		t.Errorf("claim of the next tick = %s, %v", result, err)
+	}
+
+	var runs, failures int64
+	var locked bool
+	err := s.pool.QueryRow(ctx, `select runs, failures, locked_until is not null from scheduled_jobs where name = $1`, name).
+		Scan(&runs, &failures, &locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 || failures != 1 || locked {
+		t.Errorf("runs %d, failures %d, locked %v", runs, failures, locked)
+	}
+}
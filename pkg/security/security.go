@@ -5,19 +5,20 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"log"
 	"time"
 
 	// "github.com/jackc/pgx"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
-
 )
 
 //Service Authorization
 type Service struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	logger *zap.Logger
 }
 
 var ErrNoSuchUser = errors.New("no such user")
@@ -25,8 +26,8 @@ var ErrInvalidPassword = errors.New("invalid password")
 var ErrInternal = errors.New("internal error")
 var ErrExpireToken = errors.New("token expired")
 
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool: pool}
+func NewService(pool *pgxpool.Pool, logger *zap.Logger) *Service {
+	return &Service{pool: pool, logger: logger}
 }
 
 // method, we check the login and password if correct then return true if not false
@@ -35,7 +36,7 @@ func (s *Service) Auth(login string, password string) bool {
 
 	err := s.pool.QueryRow(context.Background(), sql, login, password).Scan(&login, &password)
 	if err != nil {
-		log.Print("errors: ", err)
+		s.logger.Warn("auth", zap.Error(err))
 		return false
 	}
 	return true
@@ -84,21 +85,15 @@ func (s *Service) AuthenticateCustomer(ctx context.Context, token string) (int64
 
 	err := s.pool.QueryRow(ctx, `SELECT customer_id, expire FROM customers_tokens WHERE token =$1`, token).Scan(&id, &expire)
 	if err == pgx.ErrNoRows {
-		log.Print(err)
 		return 0, ErrNoSuchUser
 
 	}
 	if err != nil {
-		log.Print(err)
+		logging.Ctx(ctx, s.logger).Error("authenticate customer", zap.Error(err), logging.Secret("token"))
 		return 0, ErrInternal
 	}
 
-	tN := time.Now().Unix()
-	log.Print(tN)
-	tE := expire.Unix()
-	log.Print(tE)
-
-	if tN > tE {
+	if time.Now().After(expire) {
 		return 0, ErrExpireToken
 	}
 
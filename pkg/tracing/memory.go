@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// DefaultMemorySpans is the number of spans the memory exporter keeps by default
+const DefaultMemorySpans = 1000
+
+// MemoryExporter keeps the newest spans in a ring buffer, the oldest ones are dropped
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []tracetest.SpanStub
+	// next is the index of the slot written next, full once the buffer wrapped around
+	next int
+	full bool
+}
+
+// NewMemoryExporter keeps up to size spans, DefaultMemorySpans if size is not positive
+func NewMemoryExporter(size int) *MemoryExporter {
+	if size <= 0 {
+		size = DefaultMemorySpans
+	}
+	return &MemoryExporter{spans: make([]tracetest.SpanStub, size)}
+}
+
+// ExportSpans keeps the spans, dropping the oldest ones
+func (e *MemoryExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, span := range spans {
+		e.spans[e.next] = tracetest.SpanStubFromReadOnlySpan(span)
+		e.next++
+		if e.next == len(e.spans) {
+			e.next = 0
+			e.full = true
+		}
+	}
+	return nil
+}
+
+// Shutdown ...
+func (e *MemoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// GetSpans returns the kept spans, oldest first
+func (e *MemoryExporter) GetSpans() tracetest.SpanStubs {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.full {
+		return append(tracetest.SpanStubs(nil), e.spans[:e.next]...)
+	}
+	spans := make(tracetest.SpanStubs, 0, len(e.spans))
+	spans = append(spans, e.spans[e.next:]...)
+	return append(spans, e.spans[:e.next]...)
+}
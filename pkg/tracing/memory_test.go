@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestMemoryExporterKeepsNewest(t *testing.T) {
+	exporter := NewMemoryExporter(3)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := provider.Tracer("test")
+
+	for i := 0; i < 5; i++ {
+		_, span := tracer.Start(context.Background(), fmt.Sprintf("span %d", i))
+		span.End()
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("kept %d spans, want 3", len(spans))
+	}
+	for i, span := range spans {
+		if want := fmt.Sprintf("span %d", i+2); span.Name != want {
+			t.Errorf("span %d is %q, want %q", i, span.Name, want)
+		}
+	}
+}
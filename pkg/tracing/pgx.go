@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var pgxTracer = otel.Tracer("github.com/jackc/pgx/v4")
+
+// QueryLogger turns the log lines pgx writes after each query into spans.
+// pgx v4 has no hooks around queries, so the span is started back-dated by the duration pgx reports.
+// Arguments of queries are never recorded, they may hold passwords and tokens.
+type QueryLogger struct {
+	// Next receives every log line as well, may be nil
+	Next pgx.Logger
+}
+
+// Log ...
+func (l *QueryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if l.Next != nil {
+		l.Next.Log(ctx, level, msg, data)
+	}
+
+	switch msg {
+	case "Query", "Exec":
+	default:
+		return
+	}
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		// queries outside of a traced request (background jobs, startup) would be orphan roots
+		return
+	}
+
+	end := time.Now()
+	start := end
+	if duration, ok := data["time"].(time.Duration); ok {
+		start = end.Add(-duration)
+	}
+
+	attributes := []attribute.KeyValue{attribute.String("db.system", "postgresql"), attribute.String("db.operation", msg)}
+	if sql, ok := data["sql"].(string); ok {
+		attributes = append(attributes, attribute.String("db.statement", sql))
+	}
+	if rows, ok := data["rowCount"].(int); ok {
+		attributes = append(attributes, attribute.Int("db.rows", rows))
+	}
+
+	_, span := pgxTracer.Start(ctx, "pgx."+msg, trace.WithTimestamp(start), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...))
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
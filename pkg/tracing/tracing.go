@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ServiceName names the service in exported spans
+const ServiceName = "crud"
+
+// exporters of spans
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterMemory = "memory"
+	ExporterOTLP   = "otlp"
+)
+
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+// Config of tracing, Exporter is none (default), stdout, memory or otlp
+type Config struct {
+	Exporter string
+	// SampleRatio of root spans to record, 0 records all of them
+	SampleRatio float64
+	// MemorySpans is the number of spans the memory exporter keeps, DefaultMemorySpans if 0
+	MemorySpans int
+	// OTLPEndpoint is the host:port of the collector receiving OTLP over http, the OTEL_EXPORTER_OTLP_*
+	// environment variables apply when it is empty. OTLPInsecure sends the spans without TLS.
+	OTLPEndpoint string
+	OTLPInsecure bool
+}
+
+// Tracing owns the tracer provider, Memory keeps the spans when the memory exporter is used
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+	Memory   *MemoryExporter
+}
+
+// New creates the tracer provider and installs it with the W3C trace-context propagator as the global one
+func New(ctx context.Context, config Config) (*Tracing, error) {
+	t := &Tracing{}
+
+	var exporter sdktrace.SpanExporter
+	switch config.Exporter {
+	case "", ExporterNone:
+	case ExporterStdout:
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+	case ExporterMemory:
+		t.Memory = NewMemoryExporter(config.MemorySpans)
+		exporter = t.Memory
+	case ExporterOTLP:
+		options := make([]otlptracehttp.Option, 0)
+		if config.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+		}
+		if config.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		var err error
+		exporter, err = otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnknownExporter
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio > 0 && config.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(config.SampleRatio)
+	}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", ServiceName))),
+	}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	t.provider = sdktrace.NewTracerProvider(options...)
+
+	otel.SetTracerProvider(t.provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return t, nil
+}
+
+// Shutdown flushes the spans
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// Handler serves the spans kept by the memory exporter as json
+func (t *Tracing) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.Memory == nil {
+			http.Error(w, "memory exporter is not enabled", http.StatusNotFound)
+			return
+		}
+		if err := t.provider.ForceFlush(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		spans := make([]map[string]interface{}, 0)
+		for _, span := range t.Memory.GetSpans() {
+			attributes := make(map[string]interface{})
+			for _, kv := range span.Attributes {
+				attributes[string(kv.Key)] = kv.Value.AsInterface()
+			}
+			spans = append(spans, map[string]interface{}{
+				"name":       span.Name,
+				"trace_id":   span.SpanContext.TraceID().String(),
+				"span_id":    span.SpanContext.SpanID().String(),
+				"parent_id":  span.Parent.SpanID().String(),
+				"start":      span.StartTime,
+				"end":        span.EndTime,
+				"status":     span.Status.Code.String(),
+				"attributes": attributes,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(spans)
+	})
+}
@@ -0,0 +1,303 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// statuses of a delivery, a dead one exhausted its attempts and waits for a manual retry
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+const (
+	// MaxAttempts of a delivery before it is dead
+	MaxAttempts     = 8
+	firstBackoff    = 30 * time.Second
+	maxBackoff      = 6 * time.Hour
+	deliveryTimeout = 10 * time.Second
+	// a claimed delivery is retried after the lease if the instance sending it dies
+	deliveryLease = time.Minute
+	batchSize     = 50
+	// the batch is sent by the workers within sendWindow, well inside the lease,
+	// so no other instance claims a delivery still being sent
+	deliveryWorkers = 10
+	sendWindow      = deliveryLease / 2
+)
+
+// Delivery of an event of the outbox to a subscription
+type Delivery struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int64      `json:"subscription_id"`
+	URL            string     `json:"url"`
+	EventID        int64      `json:"event_id"`
+	Event          string     `json:"event"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttempt    time.Time  `json:"next_attempt"`
+	LastStatus     int        `json:"last_status"`
+	LastError      string     `json:"last_error"`
+	Delivered      *time.Time `json:"delivered"`
+	Created        time.Time  `json:"created"`
+}
+
+// Payload is the body of a delivery, Data is the payload of the event
+type Payload struct {
+	ID      int64           `json:"id"`
+	Event   string          `json:"event"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Backoff returns the wait after the failed attempt, doubling from 30s up to 6h
+func Backoff(attempt int) time.Duration {
+	backoff := firstBackoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// Enqueue is the handler of the bus, it adds a delivery of the event for each active subscription to it
+// in the tx publishing the event
+func (s *Service) Enqueue(ctx context.Context, tx pgx.Tx, envelope *events.Envelope) error {
+	ctx, span := tracer.Start(ctx, "webhooks.Enqueue")
+	defer span.End()
+
+	// a republished event finds its deliveries already there
+	_, err := tx.Exec(ctx, `
+	insert into webhook_deliveries (subscription_id, event_id)
+	select id, $1 from webhook_subscriptions where active and ($2 = any(events) or $3 = any(events))
+	on conflict do nothing`, envelope.ID, envelope.Name, AllEvents)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("enqueue", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+type claimed struct {
+	id      int64
+	url     string
+	secret  string
+	payload *Payload
+	attempt int
+}
+
+// Deliver sends the due deliveries and returns how many succeeded, failed ones are retried with backoff
+func (s *Service) Deliver(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.Deliver")
+	defer span.End()
+
+	// claiming moves next_attempt past the lease, so other instances don't send the same deliveries meanwhile
+	rows, err := s.pool.Query(ctx, `
+	update webhook_deliveries d set next_attempt = current_timestamp + $1 * interval '1 second', attempts = d.attempts + 1
+	from webhook_subscriptions ws, outbox_events e
+	where d.id in (
+		select id from webhook_deliveries where status = 'pending' and next_attempt <= current_timestamp
+		order by next_attempt, id limit $2 for update skip locked
+	) and ws.id = d.subscription_id and e.id = d.event_id
+	returning d.id, ws.url, ws.secret, e.id, e.event, e.created, e.payload, d.attempts`, int(deliveryLease.Seconds()), batchSize)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("deliver", zap.Error(err))
+		return 0, ErrInternal
+	}
+	items := make([]*claimed, 0)
+	for rows.Next() {
+		item := &claimed{payload: &Payload{}}
+		err = rows.Scan(&item.id, &item.url, &item.secret, &item.payload.ID, &item.payload.Event, &item.payload.Created,
+			&item.payload.Data, &item.attempt)
+		if err != nil {
+			rows.Close()
+			logging.Ctx(ctx, s.logger).Error("deliver", zap.Error(err))
+			return 0, ErrInternal
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("deliver", zap.Error(err))
+		return 0, ErrInternal
+	}
+
+	results := s.sendAll(ctx, items)
+	delivered := 0
+	for i, item := range items {
+		if err = s.record(ctx, item, results[i].status, results[i].err); err != nil {
+			return delivered, err
+		}
+		if results[i].err == nil {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+type sendResult struct {
+	status int
+	err    error
+}
+
+// sendAll sends the items concurrently, a send still running after sendWindow is cancelled and fails
+func (s *Service) sendAll(ctx context.Context, items []*claimed) []sendResult {
+	ctx, cancel := context.WithTimeout(ctx, sendWindow)
+	defer cancel()
+
+	results := make([]sendResult, len(items))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < deliveryWorkers && w < len(items); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].status, results[i].err = s.send(ctx, items[i])
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// send posts the signed payload, any status but 2xx is a failure
+func (s *Service) send(ctx context.Context, item *claimed) (int, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.send")
+	defer span.End()
+	span.SetAttributes(attribute.String("webhook.event", item.payload.Event), attribute.Int64("webhook.delivery", item.id))
+
+	body, err := json.Marshal(item.payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, item.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crud-webhooks")
+	req.Header.Set(EventHeader, item.payload.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(item.id, 10))
+	req.Header.Set(SignatureHeader, Sign(item.secret, time.Now(), body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver responded %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// record saves the result of the attempt, the delivery is dead after MaxAttempts failures
+func (s *Service) record(ctx context.Context, item *claimed, status int, sendErr error) error {
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = s.pool.Exec(ctx, `
+		update webhook_deliveries set status = 'delivered', delivered = current_timestamp, last_status = $2, last_error = ''
+		where id = $1`, item.id, status)
+	case item.attempt >= MaxAttempts:
+		logging.Ctx(ctx, s.logger).Warn("webhook delivery dead", zap.Int64("delivery_id", item.id),
+			zap.Int("attempts", item.attempt), zap.Error(sendErr))
+		_, err = s.pool.Exec(ctx, `
+		update webhook_deliveries set status = 'dead', last_status = nullif($2, 0), last_error = $3 where id = $1`,
+			item.id, status, sendErr.Error())
+	default:
+		_, err = s.pool.Exec(ctx, `
+		update webhook_deliveries set next_attempt = current_timestamp + $4 * interval '1 second',
+			last_status = nullif($2, 0), last_error = $3
+		where id = $1`, item.id, status, sendErr.Error(), int(Backoff(item.attempt).Seconds()))
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("record delivery", zap.Error(err))
+		return ErrInternal
+	}
+	return nil
+}
+
+// Deliveries returns the newest deliveries, all of them when status is empty
+func (s *Service) Deliveries(ctx context.Context, status string) ([]*Delivery, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.Deliveries")
+	defer span.End()
+
+	items := make([]*Delivery, 0)
+	rows, err := s.pool.Query(ctx, `
+	select d.id, d.subscription_id, ws.url, d.event_id, e.event, d.status, d.attempts, d.next_attempt,
+		coalesce(d.last_status, 0), d.last_error, d.delivered, d.created
+	from webhook_deliveries d
+	join webhook_subscriptions ws on ws.id = d.subscription_id
+	join outbox_events e on e.id = d.event_id
+	where $1 = '' or d.status = $1
+	order by d.id desc limit 500`, status)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("deliveries", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Delivery{}
+		err = rows.Scan(&item.ID, &item.SubscriptionID, &item.URL, &item.EventID, &item.Event, &item.Status,
+			&item.Attempts, &item.NextAttempt, &item.LastStatus, &item.LastError, &item.Delivered, &item.Created)
+		if err != nil {
+			logging.Ctx(ctx, s.logger).Error("deliveries", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("deliveries", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// RetryDelivery sends the dead delivery again with a fresh set of attempts
+func (s *Service) RetryDelivery(ctx context.Context, id int64) (*Delivery, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.RetryDelivery")
+	defer span.End()
+
+	item := &Delivery{}
+	err := s.pool.QueryRow(ctx, `
+	update webhook_deliveries set status = 'pending', attempts = 0, next_attempt = current_timestamp
+	where id = $1 and status = 'dead'
+	returning id, subscription_id, event_id, status, attempts, next_attempt, coalesce(last_status, 0), last_error, created`, id).
+		Scan(&item.ID, &item.SubscriptionID, &item.EventID, &item.Status, &item.Attempts, &item.NextAttempt,
+			&item.LastStatus, &item.LastError, &item.Created)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("retry delivery", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
@@ -0,0 +1,130 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestService(server *httptest.Server) *Service {
+	client := server.Client()
+	client.Timeout = deliveryTimeout
+	return &Service{logger: zap.NewNop(), client: client}
+}
+
+func newClaimed(id int64, url string) *claimed {
+	return &claimed{
+		id:      id,
+		url:     url,
+		secret:  "secret",
+		attempt: 1,
+		payload: &Payload{ID: id, Event: "sale.created", Created: time.Now(), Data: json.RawMessage(`{"id":1}`)},
+	}
+}
+
+func TestSendSigned(t *testing.T) {
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if err = Verify("secret", r.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("signature %q: %v", r.Header.Get(SignatureHeader), err)
+		}
+		if err = Verify("other", r.Header.Get(SignatureHeader), body, time.Minute); err != ErrInvalidSignature {
+			t.Errorf("signature verified with another secret: %v", err)
+		}
+		if r.Header.Get(EventHeader) != "sale.created" || r.Header.Get(DeliveryHeader) != "7" {
+			t.Errorf("headers %v", r.Header)
+		}
+
+		payload := &Payload{}
+		if err = json.Unmarshal(body, payload); err != nil || payload.ID != 7 || string(payload.Data) != `{"id":1}` {
+			t.Errorf("payload %s: %v", body, err)
+		}
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	s := newTestService(server)
+
+	status, err := s.send(context.Background(), newClaimed(7, server.URL))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("status %d: %v", status, err)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	status, err = s.send(context.Background(), newClaimed(7, server.URL))
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("status %d: %v", status, err)
+	}
+}
+
+func TestSendAllWithinWindow(t *testing.T) {
+	var running, maxRunning int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+	s := newTestService(server)
+
+	items := make([]*claimed, batchSize)
+	for i := range items {
+		items[i] = newClaimed(int64(i), server.URL)
+	}
+	results := s.sendAll(context.Background(), items)
+	for i, result := range results {
+		if result.err != nil || result.status != http.StatusOK {
+			t.Errorf("delivery %d: status %d: %v", i, result.status, result.err)
+		}
+	}
+	if maxRunning < 2 || maxRunning > deliveryWorkers {
+		t.Errorf("%d sends at once", maxRunning)
+	}
+
+	// the deadline of the batch cancels the sends
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range s.sendAll(ctx, items[:3]) {
+		if result.err == nil {
+			t.Error("cancelled send succeeded")
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{
+		1:           30 * time.Second,
+		2:           time.Minute,
+		3:           2 * time.Minute,
+		MaxAttempts: 64 * time.Minute,
+		100:         6 * time.Hour,
+	} {
+		if got := Backoff(attempt); got != want {
+			t.Errorf("attempt %d: backoff %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestSendWindowInsideLease(t *testing.T) {
+	if sendWindow+deliveryTimeout >= deliveryLease {
+		t.Errorf("sends of %s may outlast the lease of %s", sendWindow+deliveryTimeout, deliveryLease)
+	}
+}
@@ -0,0 +1,171 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shodikhuja83/crud/pkg/events"
+	"github.com/shodikhuja83/crud/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/shodikhuja83/crud/pkg/webhooks")
+
+var (
+	//ErrNotFound ...
+	ErrNotFound = errors.New("item not found")
+	//ErrInternal ...
+	ErrInternal = errors.New("internal error")
+	//ErrInvalidURL ...
+	ErrInvalidURL = errors.New("invalid webhook url")
+	//ErrInvalidEvent ...
+	ErrInvalidEvent = errors.New("invalid webhook event")
+)
+
+// AllEvents subscribes to every event
+const AllEvents = "*"
+
+// Subscription of an external system to events, the secret signs the deliveries
+// and is returned only when the subscription is created
+type Subscription struct {
+	ID      int64     `json:"id"`
+	URL     string    `json:"url"`
+	Events  []string  `json:"events"`
+	Secret  string    `json:"secret,omitempty"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+// Service manages the subscriptions and delivers the events of the bus to them
+type Service struct {
+	pool   *pgxpool.Pool
+	logger *zap.Logger
+	client *http.Client
+}
+
+func NewService(pool *pgxpool.Pool, logger *zap.Logger) *Service {
+	return &Service{pool: pool, logger: logger, client: &http.Client{Timeout: deliveryTimeout}}
+}
+
+// Subscriptions returns the subscriptions without their secrets
+func (s *Service) Subscriptions(ctx context.Context) ([]*Subscription, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.Subscriptions")
+	defer span.End()
+
+	items := make([]*Subscription, 0)
+	rows, err := s.pool.Query(ctx, `select id, url, events, active, created from webhook_subscriptions order by id`)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("subscriptions", zap.Error(err))
+		return nil, ErrInternal
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Subscription{}
+		if err = rows.Scan(&item.ID, &item.URL, &item.Events, &item.Active, &item.Created); err != nil {
+			logging.Ctx(ctx, s.logger).Error("subscriptions", zap.Error(err))
+			return nil, ErrInternal
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		logging.Ctx(ctx, s.logger).Error("subscriptions", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return items, nil
+}
+
+// SaveSubscription creates the subscription with a new secret when its ID is 0,
+// otherwise changes its url, events and active flag keeping the secret
+func (s *Service) SaveSubscription(ctx context.Context, item *Subscription) (*Subscription, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.SaveSubscription")
+	defer span.End()
+
+	if err := validSubscription(item); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if item.ID == 0 {
+		if item.Secret, err = newSecret(); err != nil {
+			logging.Ctx(ctx, s.logger).Error("save subscription", zap.Error(err))
+			return nil, ErrInternal
+		}
+		err = s.pool.QueryRow(ctx, `
+		insert into webhook_subscriptions (url, events, secret) values ($1, $2, $3) returning id, active, created`,
+			item.URL, item.Events, item.Secret).Scan(&item.ID, &item.Active, &item.Created)
+	} else {
+		item.Secret = ""
+		err = s.pool.QueryRow(ctx, `
+		update webhook_subscriptions set url = $2, events = $3, active = $4 where id = $1 returning created`,
+			item.ID, item.URL, item.Events, item.Active).Scan(&item.Created)
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		logging.Ctx(ctx, s.logger).Error("save subscription", zap.Error(err))
+		return nil, ErrInternal
+	}
+	return item, nil
+}
+
+// RemoveSubscription deletes the subscription with its deliveries
+func (s *Service) RemoveSubscription(ctx context.Context, id int64) error {
+	ctx, span := tracer.Start(ctx, "webhooks.RemoveSubscription")
+	defer span.End()
+
+	tag, err := s.pool.Exec(ctx, `delete from webhook_subscriptions where id = $1`, id)
+	if err != nil {
+		logging.Ctx(ctx, s.logger).Error("remove subscription", zap.Error(err))
+		return ErrInternal
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func validSubscription(item *Subscription) error {
+	u, err := url.Parse(item.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if len(item.Events) == 0 {
+		return ErrInvalidEvent
+	}
+	for _, event := range item.Events {
+		if !knownEvent(event) {
+			return ErrInvalidEvent
+		}
+	}
+	return nil
+}
+
+func knownEvent(event string) bool {
+	if event == AllEvents {
+		return true
+	}
+	for _, known := range events.Names {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() (string, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buffer), nil
+}
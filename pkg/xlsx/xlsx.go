@@ -0,0 +1,193 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ContentType of an xlsx workbook
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// MaxRows of a worksheet
+const MaxRows = 1048576
+
+var ErrTooManyRows = errors.New("too many rows for a worksheet")
+
+// the parts of the workbook besides the worksheet, the first row is bold (style 1)
+var parts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+// Writer streams a workbook of one worksheet, the rows are written as they come
+// so a large sheet doesn't stay in memory
+type Writer struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	name  string
+	rows  int
+	text  map[int]bool
+	err   error
+}
+
+// NewWriter starts a workbook with a worksheet of the name
+func NewWriter(w io.Writer, name string) *Writer {
+	return &Writer{zip: zip.NewWriter(w), name: name}
+}
+
+// Text makes the cells of the columns, by index from 0, strings even when the values look like numbers,
+// e.g. phones and codes. It is called before the rows are written.
+func (x *Writer) Text(columns ...int) {
+	if x.text == nil {
+		x.text = make(map[int]bool, len(columns))
+	}
+	for _, i := range columns {
+		x.text[i] = true
+	}
+}
+
+// start writes the parts before the worksheet, the workbook part needs the name of the sheet
+func (x *Writer) start() error {
+	for _, part := range parts {
+		w, err := x.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+
+	w, err := x.zip.Create("xl/workbook.xml")
+	if err != nil {
+		return err
+	}
+	io.WriteString(w, xml.Header+`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `+
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="`)
+	xml.EscapeText(w, []byte(x.name))
+	if _, err = io.WriteString(w, `" sheetId="1" r:id="rId1"/></sheets></workbook>`); err != nil {
+		return err
+	}
+
+	w, err = x.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	x.sheet = bufio.NewWriter(w)
+	_, err = x.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return err
+}
+
+// Write adds a row, the first one is the bold header. Values that look like plain numbers
+// become numeric cells unless their column is Text, the others strings, so codes with leading zeros stay text.
+func (x *Writer) Write(values []string) error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.sheet == nil {
+		if x.err = x.start(); x.err != nil {
+			return x.err
+		}
+	}
+	if x.rows == MaxRows {
+		x.err = ErrTooManyRows
+		return x.err
+	}
+	x.rows++
+
+	row := strconv.Itoa(x.rows)
+	x.sheet.WriteString(`<row r="` + row + `">`)
+	for i, value := range values {
+		x.sheet.WriteString(`<c r="` + column(i) + row + `"`)
+		switch {
+		case x.rows == 1:
+			x.sheet.WriteString(` s="1" t="inlineStr"><is><t>`)
+			xml.EscapeText(x.sheet, []byte(value))
+			x.sheet.WriteString(`</t></is></c>`)
+		case value == "":
+			x.sheet.WriteString(`/>`)
+		case !x.text[i] && isNumber(value):
+			x.sheet.WriteString(`><v>` + value + `</v></c>`)
+		default:
+			x.sheet.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(x.sheet, []byte(value))
+			x.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, x.err = x.sheet.WriteString(`</row>`)
+	return x.err
+}
+
+// Close ends the worksheet and the workbook, it doesn't close the underlying writer
+func (x *Writer) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.sheet == nil {
+		if x.err = x.start(); x.err != nil {
+			return x.err
+		}
+	}
+	x.sheet.WriteString(`</sheetData></worksheet>`)
+	if x.err = x.sheet.Flush(); x.err != nil {
+		return x.err
+	}
+	x.err = x.zip.Close()
+	return x.err
+}
+
+// column returns the letters of the column of the index from 0, e.g. A, Z, AA
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// isNumber reports whether the value is an integer or a decimal without leading zeros, exponent or sign but minus
+func isNumber(value string) bool {
+	if value[0] == '-' {
+		value = value[1:]
+	}
+	if value == "" || len(value) > 15 {
+		return false
+	}
+	dot := false
+	for i, c := range value {
+		switch {
+		case c == '.' && !dot && i > 0 && i < len(value)-1:
+			dot = true
+		case c < '0' || c > '9':
+			return false
+		}
+	}
+	return !(value[0] == '0' && len(value) > 1 && value[1] != '.')
+}
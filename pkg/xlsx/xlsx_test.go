@@ -0,0 +1,168 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+)
+
+func TestColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 1: "B", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := column(i); got != want {
+			t.Errorf("column(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestIsNumber(t *testing.T) {
+	for value, want := range map[string]bool{
+		"0":                true,
+		"42":               true,
+		"-42":              true,
+		"12.50":            true,
+		"0.5":              true,
+		"-0.5":             true,
+		"007":              false,
+		"00.5":             false,
+		"1e5":              false,
+		"+1":               false,
+		"-":                false,
+		".5":               false,
+		"5.":               false,
+		"1.2.3":            false,
+		"12 50":            false,
+		"1234567890123456": false,
+		"992900000000":     true,
+		"abc":              false,
+	} {
+		if got := isNumber(value); got != want {
+			t.Errorf("isNumber(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+type cell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	String string `xml:"is>t"`
+}
+
+type sheet struct {
+	Rows []struct {
+		Ref   string `xml:"r,attr"`
+		Cells []cell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readSheet reads back the worksheet and the name of the sheet in the workbook
+func readSheet(t *testing.T, data []byte) (*sheet, string) {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files[file.Name], err = ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+	for _, part := range parts {
+		if _, ok := files[part.name]; !ok {
+			t.Errorf("no part %s", part.name)
+		}
+	}
+
+	workbook := &struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}{}
+	if err = xml.Unmarshal(files["xl/workbook.xml"], workbook); err != nil {
+		t.Fatal(err)
+	}
+	if len(workbook.Sheets) != 1 {
+		t.Fatalf("%d sheets", len(workbook.Sheets))
+	}
+
+	result := &sheet{}
+	if err = xml.Unmarshal(files["xl/worksheets/sheet1.xml"], result); err != nil {
+		t.Fatal(err)
+	}
+	return result, workbook.Sheets[0].Name
+}
+
+func TestWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewWriter(out, "sales & returns")
+	w.Text(1)
+	for _, row := range [][]string{
+		{"id", "phone", "name", "price", "note"},
+		{"1", "992900000001", "Чай <зелёный>", "12.50", ""},
+		{"2", "0042", "Coffee", "-3", " spaced "},
+	} {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, name := readSheet(t, out.Bytes())
+	if name != "sales & returns" {
+		t.Errorf("sheet name %q", name)
+	}
+	if len(result.Rows) != 3 {
+		t.Fatalf("%d rows", len(result.Rows))
+	}
+
+	header := result.Rows[0].Cells
+	if header[0].Ref != "A1" || header[0].Style != "1" || header[0].Type != "inlineStr" || header[0].String != "id" {
+		t.Errorf("header cell %+v", header[0])
+	}
+	for _, want := range []cell{
+		{Ref: "A2", Value: "1"},
+		{Ref: "B2", Type: "inlineStr", String: "992900000001"},
+		{Ref: "C2", Type: "inlineStr", String: "Чай <зелёный>"},
+		{Ref: "D2", Value: "12.50"},
+		{Ref: "E2"},
+		{Ref: "B3", Type: "inlineStr", String: "0042"},
+		{Ref: "D3", Value: "-3"},
+		{Ref: "E3", Type: "inlineStr", String: " spaced "},
+	} {
+		found := false
+		for _, row := range result.Rows {
+			for _, got := range row.Cells {
+				if got.Ref == want.Ref {
+					found = true
+					if got != want {
+						t.Errorf("cell %+v, want %+v", got, want)
+					}
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no cell %s", want.Ref)
+		}
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := NewWriter(out, "data").Close(); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := readSheet(t, out.Bytes()); len(result.Rows) != 0 {
+		t.Errorf("%d rows", len(result.Rows))
+	}
+}